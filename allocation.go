@@ -0,0 +1,408 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/klog/v2"
+
+	frrv1alpha1 "github.com/guohao117/frr-controller/pkg/apis/frrcontroller/v1alpha1"
+	rangemanager "github.com/guohao117/frr-controller/pkg/range_manager"
+)
+
+// rangeManagers returns the allocators of every pool, keyed by kind/name
+func (c *Controller) rangeManagers() map[string]*rangemanager.RangeManager {
+	managers := make(map[string]*rangemanager.RangeManager)
+	for _, kind := range []string{vniPoolKind, asnPoolKind} {
+		pools, _ := c.pools(kind)
+		for name, manager := range pools.List() {
+			managers[kind+"/"+name] = manager
+		}
+	}
+	return managers
+}
+
+// restoreAllocations loads the allocator snapshots saved by persistAllocations
+// into the range managers. Names the managers already hold are kept.
+func (c *Controller) restoreAllocations() error {
+	if c.allocationStorage == nil {
+		return nil
+	}
+	snapshots, err := c.allocationStorage.Load()
+	if err != nil {
+		return err
+	}
+	managers := c.rangeManagers()
+	for pool, snapshot := range snapshots {
+		manager, ok := managers[pool]
+		if !ok {
+			klog.Warningf("Dropping saved allocations of unknown pool %s", pool)
+			continue
+		}
+		if err := manager.Restore(snapshot); err != nil {
+			// Numbers which no longer fit the configured range are dropped,
+			// recoverAllocations reports them if they are still in use.
+			klog.Warningf("Failed to restore some %s allocations: %v", pool, err)
+		}
+	}
+	return nil
+}
+
+// persistAllocations saves the state of the range managers. Only the leader
+// allocates, so if the stored state was changed behind our back it is
+// overwritten: merging it back would hand the numbers released since the
+// last save to their former owners again.
+func (c *Controller) persistAllocations() error {
+	if c.allocationStorage == nil {
+		return nil
+	}
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		snapshots := make(map[string]*rangemanager.Snapshot)
+		for pool, manager := range c.rangeManagers() {
+			snapshot, err := manager.Snapshot()
+			if err != nil {
+				return err
+			}
+			snapshots[pool] = snapshot
+		}
+		err := c.allocationStorage.Save(snapshots)
+		if errors.IsConflict(err) {
+			if refreshErr := c.allocationStorage.Refresh(); refreshErr != nil {
+				return refreshErr
+			}
+		}
+		return err
+	})
+}
+
+// numberAllocation is a number held by a Frr and where it comes from
+type numberAllocation struct {
+	number int
+	source frrv1alpha1.AllocationSource
+	pool   string
+}
+
+// status returns the allocation as reported in the Frr status
+func (a numberAllocation) status() frrv1alpha1.NumberAllocation {
+	return frrv1alpha1.NumberAllocation{AllocationSource: a.source, Pool: a.pool}
+}
+
+// allocateNumbers gives the Frr its AS number, the VNI of every L2VNI and
+// the L3VNI of every VRF. Numbers set in the spec are reserved, the others
+// are allocated from the pools. A reservation that fails is reported as a
+// Warning event and in the Allocated condition. The VNIs of L2VNIs and VRFs
+// no longer listed, or replaced by another requested VNI, are released, or
+// retired until they are removed from the nodes if connect-frr built them.
+func (c *Controller) allocateNumbers(frr *frrv1alpha1.Frr) (asn numberAllocation, vnis []l2vni, vrfs []l3vni, err error) {
+	frrscopedName := frr.Namespace + "/" + frr.Name
+	asn, changed, err := c.allocateNumber(frr, asnPoolKind, "AS number", frrscopedName, frr.Spec.ASNumber)
+	if err != nil {
+		return asn, nil, nil, err
+	}
+	vnis = specL2VNIs(frr)
+	names := make(map[string]bool)
+	for i := range vnis {
+		name := vnis[i].allocationName(frrscopedName)
+		names[name] = true
+		retired, err := c.retireReplacedVNI(frr, name, vnis[i].requested)
+		if err != nil {
+			return asn, nil, nil, err
+		}
+		allocation, allocated, err := c.allocateNumber(frr, vniPoolKind, "VNI", name, vnis[i].requested)
+		if err != nil {
+			return asn, nil, nil, err
+		}
+		vnis[i].numberAllocation = allocation
+		changed = changed || allocated || retired
+	}
+	vrfs = specL3VNIs(frr)
+	for i := range vrfs {
+		name := vrfAllocationName(frrscopedName, vrfs[i].name)
+		names[name] = true
+		retired, err := c.retireReplacedVNI(frr, name, vrfs[i].requested)
+		if err != nil {
+			return asn, nil, nil, err
+		}
+		allocation, allocated, err := c.allocateNumber(frr, vniPoolKind, "L3VNI", name, vrfs[i].requested)
+		if err != nil {
+			return asn, nil, nil, err
+		}
+		vrfs[i].numberAllocation = allocation
+		changed = changed || allocated || retired
+	}
+	manager, _ := c.rangeManagerFor(frr, vniPoolKind)
+	teardown := tearsDownNetwork(frr)
+	for name, number := range manager.Held(frrscopedName) {
+		if names[name] || isRetiredAllocationName(frrscopedName, name) {
+			continue
+		}
+		if teardown {
+			if err := c.retireVNI(frr, name, number); err != nil {
+				return asn, nil, nil, err
+			}
+			changed = true
+			continue
+		}
+		manager.Release(name)
+		klog.Infof("Released VNI %d of '%s' to pool %q", number, name, poolName(frr, vniPoolKind))
+		c.enqueuePool(vniPoolKind, poolName(frr, vniPoolKind))
+		changed = true
+	}
+	if changed {
+		// Save the allocation before anything refers to it
+		if err := c.persistAllocations(); err != nil {
+			return asn, nil, nil, err
+		}
+	}
+	return asn, vnis, vrfs, nil
+}
+
+// retireReplacedVNI retires the VNI held by name when the spec requests
+// another one and connect-frr built it on the nodes. A requested VNI retired
+// by the Frr before is handed back to name. It tells whether anything moved.
+func (c *Controller) retireReplacedVNI(frr *frrv1alpha1.Frr, name string, requested int) (bool, error) {
+	if requested == 0 || !tearsDownNetwork(frr) {
+		return false, nil
+	}
+	manager, err := c.rangeManagerFor(frr, vniPoolKind)
+	if err != nil {
+		// reported by allocateNumber
+		return false, nil
+	}
+	previous, held := manager.Get(name)
+	if held && previous == requested {
+		return false, nil
+	}
+	if held {
+		if err := c.retireVNI(frr, name, previous); err != nil {
+			return false, err
+		}
+	}
+	retired := retiredAllocationName(frr.Namespace+"/"+frr.Name, requested)
+	if _, ok := manager.Get(retired); !ok {
+		return held, nil
+	}
+	if err := manager.Rename(retired, name); err != nil {
+		return false, err
+	}
+	klog.Infof("VNI %d retired by '%s' is used again", requested, name)
+	return true, nil
+}
+
+// allocateNumber gives name a number of the given kind from the pool of the
+// Frr: the requested one, or the next free one if none is. It tells whether
+// the number held by name changed.
+func (c *Controller) allocateNumber(frr *frrv1alpha1.Frr, kind, desc, name string, requested int) (numberAllocation, bool, error) {
+	manager, err := c.rangeManagerFor(frr, kind)
+	if err != nil {
+		c.recorder.Event(frr, corev1.EventTypeWarning, ErrPoolNotFound, err.Error())
+		return numberAllocation{}, false, c.setAllocationFailed(frr, ReasonPoolNotFound, err.Error(), err)
+	}
+	pool := poolName(frr, kind)
+	previous, _ := manager.Get(name)
+	var allocation numberAllocation
+	if requested == 0 {
+		number, err := manager.Allocate(name)
+		if err != nil {
+			msg := fmt.Sprintf(MessagePoolExhausted, desc, pool, err)
+			c.recorder.Event(frr, corev1.EventTypeWarning, ErrPoolExhausted, msg)
+			return allocation, false, c.setAllocationFailed(frr, ErrPoolExhausted, msg, err)
+		}
+		allocation = numberAllocation{number, frrv1alpha1.AllocationSourcePool, pool}
+	} else {
+		if err := manager.Reassign(name, requested); err != nil {
+			if owner, found := manager.Owner(requested); found {
+				err = fmt.Errorf("already allocated to %s", owner)
+			}
+			msg := fmt.Sprintf(MessageReservationFailed, desc, requested, pool, err)
+			c.recorder.Event(frr, corev1.EventTypeWarning, ErrReservationFailed, msg)
+			return allocation, false, c.setAllocationFailed(frr, ErrReservationFailed, msg, err)
+		}
+		allocation = numberAllocation{requested, frrv1alpha1.AllocationSourceUser, pool}
+	}
+	if previous == allocation.number {
+		return allocation, false, nil
+	}
+	c.enqueuePool(kind, pool)
+	return allocation, true, nil
+}
+
+// setAllocationFailed records a failed allocation in the Allocated and
+// Degraded conditions of the Frr and returns err, so that the Frr is retried
+// later.
+func (c *Controller) setAllocationFailed(frr *frrv1alpha1.Frr, reason, message string, err error) error {
+	if updateErr := c.updateFrrConditions(frr, metav1.Condition{
+		Type:    frrv1alpha1.FrrConditionAllocated,
+		Status:  metav1.ConditionFalse,
+		Reason:  reason,
+		Message: message,
+	}, metav1.Condition{
+		Type:    frrv1alpha1.FrrConditionDegraded,
+		Status:  metav1.ConditionTrue,
+		Reason:  reason,
+		Message: message,
+	}); updateErr != nil {
+		return updateErr
+	}
+	return err
+}
+
+// releaseAllocations gives back every number held by the named Frr, or by
+// its L2VNIs, in any pool, and saves the result.
+func (c *Controller) releaseAllocations(frrscopedName string) error {
+	released := false
+	for _, kind := range []string{vniPoolKind, asnPoolKind} {
+		pools, _ := c.pools(kind)
+		for name, manager := range pools.List() {
+			for held, number := range manager.Held(frrscopedName) {
+				manager.Release(held)
+				klog.Infof("Released %s %d of '%s' to pool %q", kind, number, held, name)
+				c.enqueuePool(kind, name)
+				released = true
+			}
+		}
+	}
+	if !released {
+		return nil
+	}
+	return c.persistAllocations()
+}
+
+// recoverAllocations walks every Frr and the Deployment it owns and reserves
+// the VNI and ASN found there, so that numbers handed out by a previous run
+// of the controller are not given to another Frr. Numbers which cannot be
+// reserved, because they are out of range or already held by an older Frr,
+// are reported as Warning events on the Frr.
+func (c *Controller) recoverAllocations() error {
+	frrs, err := c.frrsLister.List(labels.Everything())
+	if err != nil {
+		return err
+	}
+	// Oldest Frrs win when two of them claim the same number
+	sort.Slice(frrs, func(i, j int) bool {
+		ti, tj := frrs[i].CreationTimestamp, frrs[j].CreationTimestamp
+		if ti.Equal(&tj) {
+			return frrs[i].Namespace+"/"+frrs[i].Name < frrs[j].Namespace+"/"+frrs[j].Name
+		}
+		return ti.Before(&tj)
+	})
+
+	for _, frr := range frrs {
+		if frr.Spec.DeploymentName == "" {
+			continue
+		}
+		deployment, err := c.deploymentsLister.Deployments(frr.Namespace).Get(frr.Spec.DeploymentName)
+		if errors.IsNotFound(err) {
+			// Nothing was handed out yet, syncHandler will allocate
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if !metav1.IsControlledBy(deployment, frr) {
+			continue
+		}
+
+		frrscopedName := frr.Namespace + "/" + frr.Name
+		reserve := func(kind, env, name string, number int) {
+			manager, err := c.rangeManagerFor(frr, kind)
+			if err == nil {
+				err = manager.Reserve(name, number)
+				if owner, found := manager.Owner(number); err != nil && found {
+					err = fmt.Errorf("already allocated to %s", owner)
+				}
+			}
+			if err != nil {
+				msg := fmt.Sprintf(MessageAllocationConflict, env, number, deployment.Name, err)
+				c.recorder.Event(frr, corev1.EventTypeWarning, ErrAllocationConflict, msg)
+				klog.Warningf("%s: %s", name, msg)
+				return
+			}
+			klog.V(4).Infof("Recovered %s %d for '%s'", env, number, name)
+		}
+		if value, ok := deploymentEnv(deployment, vnisEnv); ok {
+			vnis, err := parseVNIsEnv(value)
+			if err != nil {
+				klog.Warningf("%s: deployment %s: %v", frrscopedName, deployment.Name, err)
+			}
+			for name, number := range vnis {
+				reserve(vniPoolKind, vnisEnv, frrscopedName+"/"+name, number)
+			}
+		} else if number, ok := deploymentEnvInt(deployment, "VNI"); ok {
+			reserve(vniPoolKind, "VNI", frrscopedName, number)
+		}
+		if value, ok := deploymentEnv(deployment, vrfsEnv); ok {
+			vrfs, err := parseVRFsEnv(value)
+			if err != nil {
+				klog.Warningf("%s: deployment %s: %v", frrscopedName, deployment.Name, err)
+			}
+			for name, number := range vrfs {
+				reserve(vniPoolKind, vrfsEnv, vrfAllocationName(frrscopedName, name), number)
+			}
+		}
+		// ASNUMBER holds the ASN in effect. Deployments built before it did
+		// hold spec.asNumber, 0 for an ASN taken from the pool, whose value
+		// is found in the status instead.
+		number, ok := deploymentEnvInt(deployment, "ASNUMBER")
+		if !ok && frr.Status.ASNumber > 0 {
+			number, ok = frr.Status.ASNumber, true
+		}
+		if ok {
+			reserve(asnPoolKind, "ASNUMBER", frrscopedName, number)
+		}
+	}
+	return nil
+}
+
+// deploymentEnv returns the value of the named environment variable on the
+// frr container of the Deployment, as set by newDeployment.
+func deploymentEnv(deployment *appsv1.Deployment, name string) (string, bool) {
+	for _, container := range deployment.Spec.Template.Spec.Containers {
+		if container.Name != "frr" {
+			continue
+		}
+		for _, env := range container.Env {
+			if env.Name == name {
+				return env.Value, true
+			}
+		}
+	}
+	return "", false
+}
+
+// deploymentEnvInt returns the integer value of the named environment
+// variable on the frr container of the Deployment, as set by newDeployment.
+func deploymentEnvInt(deployment *appsv1.Deployment, name string) (int, bool) {
+	value, ok := deploymentEnv(deployment, name)
+	if !ok {
+		return 0, false
+	}
+	number, err := strconv.Atoi(value)
+	if err != nil || number <= 0 {
+		return 0, false
+	}
+	return number, true
+}
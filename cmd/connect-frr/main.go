@@ -0,0 +1,103 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// connect-frr runs as an init container of the Frr pods. It builds on the
+// node the vxlan interface and the bridge of every L2VNI and VRF of the Frr
+// and plugs the L2VNIs into the br-int port of their logical switch. With
+// -teardown it removes them instead.
+package main
+
+import (
+	"flag"
+	"os"
+	"time"
+
+	"github.com/vishvananda/netlink"
+	"k8s.io/klog/v2"
+
+	"github.com/guohao117/frr-controller/pkg/netagent"
+)
+
+var (
+	ovsdb             string
+	integrationBridge string
+	vxlanPort         int
+	vxlanMTU          int
+	vxlanLearning     bool
+	vxlanTTL          int
+	portTimeout       time.Duration
+	teardown          bool
+)
+
+func main() {
+	klog.InitFlags(nil)
+	flag.Parse()
+
+	network, err := netagent.NetworkFromEnv(os.Getenv)
+	if err != nil {
+		klog.Exitf("Error reading the network of the Frr: %s", err.Error())
+	}
+	handle, err := netlink.NewHandle()
+	if err != nil {
+		klog.Exitf("Error opening netlink: %s", err.Error())
+	}
+	defer handle.Delete()
+	ovs, err := netagent.NewOVSDB(ovsdb)
+	if err != nil {
+		klog.Exitf("Error connecting to Open vSwitch: %s", err.Error())
+	}
+
+	agent := &netagent.Agent{
+		Handle:            handle,
+		Switch:            ovs,
+		IntegrationBridge: integrationBridge,
+		VXLANPort:         vxlanPort,
+		VXLANMTU:          vxlanMTU,
+		VXLANLearning:     vxlanLearning,
+		VXLANTTL:          vxlanTTL,
+		PortTimeout:       portTimeout,
+	}
+	run, verb := agent.Ensure, "setting up"
+	if teardown {
+		run, verb = agent.Delete, "tearing down"
+	} else {
+		if agent.VTEPLocal, err = netagent.VTEPLocalFromEnv(os.Getenv); err != nil {
+			klog.Exitf("Error reading the local address of the VTEP: %s", err.Error())
+		}
+	}
+
+	changes, err := run(network)
+	for _, change := range changes {
+		klog.Info(change.String())
+	}
+	if err != nil {
+		klog.Exitf("Error %s the network: %s", verb, err.Error())
+	}
+	if len(changes) == 0 {
+		klog.Info("The network is up to date")
+	}
+}
+
+func init() {
+	flag.StringVar(&ovsdb, "ovsdb", netagent.DefaultOVSDB, "The database server of Open vSwitch, unix:<path> or tcp:<host>:<port>.")
+	flag.StringVar(&integrationBridge, "integration_bridge", netagent.DefaultIntegrationBridge, "The OVS bridge of OVN the L2VNIs are plugged into.")
+	flag.IntVar(&vxlanPort, "vxlan_port", netagent.DefaultVXLANPort, "The UDP port of the vxlan interfaces.")
+	flag.IntVar(&vxlanMTU, "vxlan_mtu", 0, "The MTU of the vxlan interfaces, the kernel default if 0.")
+	flag.BoolVar(&vxlanLearning, "vxlan_learning", false, "Learn remote MAC addresses from the traffic, besides EVPN.")
+	flag.IntVar(&vxlanTTL, "vxlan_ttl", 0, "The TTL of the tunnel packets, the kernel default if 0.")
+	flag.DurationVar(&portTimeout, "port_timeout", 10*time.Second, "How long to wait for Open vSwitch to create the interface of a port.")
+	flag.BoolVar(&teardown, "teardown", false, "Remove the network of the Frr from the node instead of building it.")
+}
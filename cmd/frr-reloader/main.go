@@ -0,0 +1,96 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// frr-reloader runs next to the frr container of a Frr pod. It applies the
+// frr.conf published by the controller whenever it changes and reports the
+// outcome in an annotation of the pod.
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+	"time"
+
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/klog/v2"
+
+	"github.com/guohao117/frr-controller/pkg/netagent"
+	"github.com/guohao117/frr-controller/pkg/reloader"
+	"github.com/guohao117/frr-controller/pkg/signals"
+	"github.com/guohao117/frr-controller/pkg/utils"
+)
+
+var (
+	masterURL  string
+	kubeconfig string
+	config     string
+	output     string
+	vtysh      string
+	frrReload  string
+	interval   time.Duration
+)
+
+func main() {
+	klog.InitFlags(nil)
+	flag.Parse()
+
+	stopCh := signals.SetupSignalHandler()
+
+	podName := os.Getenv("POD_NAME")
+	podNamespace := os.Getenv("POD_NAMESPACE")
+	if podName == "" || podNamespace == "" {
+		klog.Fatalf("POD_NAME and POD_NAMESPACE must be set")
+	}
+
+	vtepLocal, err := netagent.VTEPLocalFromEnv(os.Getenv)
+	if err != nil {
+		klog.Fatalf("Error reading the local address of the VTEP: %s", err.Error())
+	}
+
+	cfg, err := clientcmd.BuildConfigFromFlags(masterURL, kubeconfig)
+	if err != nil {
+		klog.Fatalf("Error building kubeconfig: %s", err.Error())
+	}
+	kubeClient, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		klog.Fatalf("Error building kubernetes clientset: %s", err.Error())
+	}
+
+	r := &reloader.Reloader{
+		ConfigPath: config,
+		OutputPath: output,
+		VTEPLocal:  vtepLocal.String(),
+		Vtysh:      vtysh,
+		FrrReload:  frrReload,
+		Report: func(status utils.FrrConfigStatus) error {
+			return utils.SetFrrConfigStatus(context.TODO(), kubeClient, podNamespace, podName, status)
+		},
+	}
+	klog.Infof("Watching %s", config)
+	r.Run(interval, stopCh)
+}
+
+func init() {
+	flag.StringVar(&kubeconfig, "kubeconfig", "", "Path to a kubeconfig. Only required if out-of-cluster.")
+	flag.StringVar(&masterURL, "master", "", "The address of the Kubernetes API server. Overrides any value in kubeconfig. Only required if out-of-cluster.")
+	flag.StringVar(&config, "config", "/etc/frr-controller/frr.conf", "The frr.conf published by the controller.")
+	flag.StringVar(&output, "output", "/tmp/frr.conf", "Where frr.conf of the pod is written before it is applied.")
+	flag.StringVar(&vtysh, "vtysh", "/usr/bin/vtysh", "The path of vtysh.")
+	flag.StringVar(&frrReload, "frr_reload", "/usr/lib/frr/frr-reload.py", "The path of frr-reload.py.")
+	flag.DurationVar(&interval, "interval", 5*time.Second, "How often frr.conf is checked for changes.")
+}
@@ -0,0 +1,232 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	frrv1alpha1 "github.com/guohao117/frr-controller/pkg/apis/frrcontroller/v1alpha1"
+)
+
+const (
+	// ReasonPoolNotFound is the condition reason used when the pool a Frr
+	// allocates from does not exist
+	ReasonPoolNotFound = "PoolNotFound"
+	// ReasonAllocated is the condition reason used when a Frr holds its
+	// numbers
+	ReasonAllocated = "Allocated"
+	// ReasonDeploymentNotOwned is the condition reason used when the
+	// Deployment named by a Frr belongs to someone else
+	ReasonDeploymentNotOwned = "DeploymentNotOwned"
+	// ReasonReplicasAvailable and ReasonReplicasUnavailable are the
+	// DeploymentReady condition reasons
+	ReasonReplicasAvailable   = "ReplicasAvailable"
+	ReasonReplicasUnavailable = "ReplicasUnavailable"
+	// ReasonConfigApplied and ReasonReloadInProgress are the ConfigRendered
+	// condition reasons
+	ReasonConfigApplied    = "ConfigApplied"
+	ReasonReloadInProgress = "ReloadInProgress"
+	// ReasonReloadFailed is the condition reason used when frr-reloader
+	// could not apply frr.conf in a pod
+	ReasonReloadFailed = "ReloadFailed"
+	// ReasonRenderFailed is the condition reason used when frr.conf of a Frr
+	// cannot be rendered from its spec
+	ReasonRenderFailed = "RenderFailed"
+	// ReasonNetworkSetupFailed is the condition reason used when connect-frr
+	// could not set up the network of a pod
+	ReasonNetworkSetupFailed = "NetworkSetupFailed"
+	// ReasonAsExpected is the Degraded condition reason when nothing failed
+	ReasonAsExpected = "AsExpected"
+	// ReasonReady and ReasonNotReady are the Ready condition reasons
+	ReasonReady    = "Ready"
+	ReasonNotReady = "NotReady"
+	// ReasonRangeApplied and ReasonShrinkRefused are the Resized condition
+	// reasons of the pools
+	ReasonRangeApplied  = "RangeApplied"
+	ReasonShrinkRefused = "ShrinkRefused"
+)
+
+// readyConditions are the conditions which must be true for a Frr to be Ready
+var readyConditions = []string{
+	frrv1alpha1.FrrConditionAllocated,
+	frrv1alpha1.FrrConditionDeploymentReady,
+	frrv1alpha1.FrrConditionConfigRendered,
+}
+
+// setFrrConditions sets the given conditions on the status of frr, which
+// must be a copy, and derives the Ready condition from them. Every condition
+// is stamped with the generation of frr.
+func setFrrConditions(frr *frrv1alpha1.Frr, conditions ...metav1.Condition) {
+	frr.Status.ObservedGeneration = frr.Generation
+	for _, condition := range conditions {
+		condition.ObservedGeneration = frr.Generation
+		meta.SetStatusCondition(&frr.Status.Conditions, condition)
+	}
+
+	var waiting []string
+	for _, conditionType := range readyConditions {
+		if !meta.IsStatusConditionTrue(frr.Status.Conditions, conditionType) {
+			waiting = append(waiting, conditionType)
+		}
+	}
+	if meta.IsStatusConditionTrue(frr.Status.Conditions, frrv1alpha1.FrrConditionDegraded) {
+		waiting = append(waiting, "not "+frrv1alpha1.FrrConditionDegraded)
+	}
+	ready := metav1.Condition{
+		Type:               frrv1alpha1.FrrConditionReady,
+		Status:             metav1.ConditionTrue,
+		Reason:             ReasonReady,
+		ObservedGeneration: frr.Generation,
+	}
+	if len(waiting) > 0 {
+		ready.Status = metav1.ConditionFalse
+		ready.Reason = ReasonNotReady
+		ready.Message = "Waiting for " + strings.Join(waiting, ", ")
+	}
+	meta.SetStatusCondition(&frr.Status.Conditions, ready)
+}
+
+// allocatedCondition returns the Allocated condition of a Frr holding the
+// given numbers.
+func allocatedCondition(asn numberAllocation, vnis []l2vni, vrfs []l3vni) metav1.Condition {
+	message := fmt.Sprintf("AS number %d, VNI %d", asn.number, vnis[0].number)
+	if len(vnis) > 1 {
+		numbers := make([]string, 0, len(vnis))
+		for i := range vnis {
+			numbers = append(numbers, strconv.Itoa(vnis[i].number))
+		}
+		message = fmt.Sprintf("AS number %d, VNIs %s", asn.number, strings.Join(numbers, ", "))
+	}
+	if len(vrfs) > 0 {
+		numbers := make([]string, 0, len(vrfs))
+		for i := range vrfs {
+			numbers = append(numbers, strconv.Itoa(vrfs[i].number))
+		}
+		message += fmt.Sprintf(", L3VNIs %s", strings.Join(numbers, ", "))
+	}
+	return metav1.Condition{
+		Type:    frrv1alpha1.FrrConditionAllocated,
+		Status:  metav1.ConditionTrue,
+		Reason:  ReasonAllocated,
+		Message: message,
+	}
+}
+
+// deploymentConditions returns the DeploymentReady, ConfigRendered and
+// Degraded conditions of a Frr from the state of its Deployment and of its
+// pods, configHash being the hash of the current frr.conf.
+func deploymentConditions(deployment *appsv1.Deployment, pods []frrv1alpha1.FrrPodStatus, configHash string) []metav1.Condition {
+	var replicas int32 = 1
+	if deployment.Spec.Replicas != nil {
+		replicas = *deployment.Spec.Replicas
+	}
+	status := deployment.Status
+
+	available := metav1.Condition{
+		Type:    frrv1alpha1.FrrConditionDeploymentReady,
+		Status:  metav1.ConditionFalse,
+		Reason:  ReasonReplicasUnavailable,
+		Message: fmt.Sprintf("%d of %d replicas available", status.AvailableReplicas, replicas),
+	}
+	if status.AvailableReplicas >= replicas {
+		available.Status = metav1.ConditionTrue
+		available.Reason = ReasonReplicasAvailable
+	}
+
+	// The configuration is published in the Secret of the Frr, it is in
+	// effect once the frr-reloader of every replica applied it.
+	var applied int32
+	var failed []string
+	for _, pod := range pods {
+		if pod.ConfigHash != configHash {
+			continue
+		}
+		if pod.ConfigError != "" {
+			failed = append(failed, fmt.Sprintf("%s: %s", pod.Name, pod.ConfigError))
+			continue
+		}
+		applied++
+	}
+	rendered := metav1.Condition{
+		Type:    frrv1alpha1.FrrConditionConfigRendered,
+		Status:  metav1.ConditionFalse,
+		Reason:  ReasonReloadInProgress,
+		Message: fmt.Sprintf("%d of %d replicas run the current configuration", applied, replicas),
+	}
+	switch {
+	case len(failed) > 0:
+		rendered.Reason = ReasonReloadFailed
+		rendered.Message = strings.Join(failed, "; ")
+	case applied >= replicas:
+		rendered.Status = metav1.ConditionTrue
+		rendered.Reason = ReasonConfigApplied
+	}
+
+	degraded := metav1.Condition{
+		Type:   frrv1alpha1.FrrConditionDegraded,
+		Status: metav1.ConditionFalse,
+		Reason: ReasonAsExpected,
+	}
+	if rendered.Reason == ReasonReloadFailed {
+		degraded.Status = metav1.ConditionTrue
+		degraded.Reason = ReasonReloadFailed
+		degraded.Message = rendered.Message
+	}
+	for _, c := range status.Conditions {
+		failed := (c.Type == appsv1.DeploymentReplicaFailure && c.Status == corev1.ConditionTrue) ||
+			(c.Type == appsv1.DeploymentProgressing && c.Status == corev1.ConditionFalse)
+		if failed {
+			degraded.Status = metav1.ConditionTrue
+			degraded.Reason = c.Reason
+			degraded.Message = c.Message
+			break
+		}
+	}
+	// A pod whose network cannot be set up never starts, which is the cause
+	// of the Deployment not progressing
+	var networkFailed []string
+	for _, pod := range pods {
+		if pod.NetworkError != "" {
+			networkFailed = append(networkFailed, fmt.Sprintf("%s: %s", pod.Name, pod.NetworkError))
+		}
+	}
+	if len(networkFailed) > 0 {
+		degraded.Status = metav1.ConditionTrue
+		degraded.Reason = ReasonNetworkSetupFailed
+		degraded.Message = strings.Join(networkFailed, "; ")
+	}
+
+	return []metav1.Condition{available, rendered, degraded}
+}
+
+// updateFrrConditions sets the given conditions on the status of the Frr and
+// saves it.
+func (c *Controller) updateFrrConditions(frr *frrv1alpha1.Frr, conditions ...metav1.Condition) error {
+	// NEVER modify objects from the store. It's a read-only, local cache.
+	frrCopy := frr.DeepCopy()
+	setFrrConditions(frrCopy, conditions...)
+	_, err := c.frrclientset.FrrcontrollerV1alpha1().Frrs(frr.Namespace).UpdateStatus(context.TODO(), frrCopy, metav1.UpdateOptions{})
+	return err
+}
@@ -0,0 +1,153 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+
+	frrv1alpha1 "github.com/guohao117/frr-controller/pkg/apis/frrcontroller/v1alpha1"
+	"github.com/guohao117/frr-controller/pkg/frrconf"
+)
+
+const (
+	// frrConfKey is the key of frr.conf in the Secret of a Frr
+	frrConfKey = "frr.conf"
+	// frrConfMountPath is where the Secret of a Frr is mounted in the frr
+	// container
+	frrConfMountPath = "/etc/frr-controller"
+)
+
+// configSecretName returns the name of the Secret frr.conf of a Frr is
+// published in. frr.conf holds the BGP passwords, so it is not published in a
+// ConfigMap.
+func configSecretName(frr *frrv1alpha1.Frr) string {
+	return frr.Name + "-frr-conf"
+}
+
+// renderConfig renders frr.conf of a Frr holding the given AS number, L2VNIs
+// and VRFs, with the passwords of its peers keyed by address
+func renderConfig(frr *frrv1alpha1.Frr, asn int, vnis []l2vni, vrfs []l3vni, passwords map[string]string) ([]byte, error) {
+	config := frrconf.FromSpec(&frr.Spec, asn)
+	for i := range config.Peers {
+		config.Peers[i].Password = passwords[config.Peers[i].Address]
+	}
+	// FromSpec lists the L2VNIs of spec.vnis and the VRFs, in the same order
+	for i := range config.L2VNIs {
+		config.L2VNIs[i].VNI = vnis[i].number
+		config.L2VNIs[i].EVPNRouting = configRouting(&vnis[i].routing)
+	}
+	for i := range config.VRFs {
+		config.VRFs[i].VNI = vrfs[i].number
+		config.VRFs[i].EVPNRouting = configRouting(&vrfs[i].routing)
+	}
+	return frrconf.Render(config)
+}
+
+func configRouting(routing *frrv1alpha1.EVPNRouting) frrconf.EVPNRouting {
+	return frrconf.EVPNRouting{
+		RD:        routing.RD,
+		ImportRTs: routing.ImportRTs,
+		ExportRTs: routing.ExportRTs,
+	}
+}
+
+// newConfigSecret creates a new Secret holding frr.conf of a Frr. It also
+// sets the appropriate OwnerReferences on the resource so handleObject can
+// discover the Frr resource that 'owns' it.
+func newConfigSecret(frr *frrv1alpha1.Frr, config []byte) *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      configSecretName(frr),
+			Namespace: frr.Namespace,
+			Labels:    podLabels(frr),
+			OwnerReferences: []metav1.OwnerReference{
+				*metav1.NewControllerRef(frr, frrv1alpha1.SchemeGroupVersion.WithKind("Frr")),
+			},
+		},
+		Type: corev1.SecretTypeOpaque,
+		Data: map[string][]byte{
+			frrConfKey: config,
+		},
+	}
+}
+
+// syncConfig renders frr.conf of the Frr, publishes it in the Secret of the
+// Frr, where the frr-reloader of every pod picks it up, and returns it. A
+// configuration which cannot be rendered, or whose passwords cannot be read,
+// is reported as a Warning event and in the ConfigRendered condition, and nil
+// is returned so that the Deployment is left alone.
+func (c *Controller) syncConfig(frr *frrv1alpha1.Frr, asn int, vnis []l2vni, vrfs []l3vni) ([]byte, error) {
+	passwords, err := c.peerPasswords(frr)
+	var config []byte
+	if err == nil {
+		config, err = renderConfig(frr, asn, vnis, vrfs, passwords)
+	}
+	if err != nil {
+		msg := fmt.Sprintf(MessageRenderFailed, err)
+		c.recorder.Event(frr, corev1.EventTypeWarning, ErrRenderFailed, msg)
+		if updateErr := c.updateFrrConditions(frr, metav1.Condition{
+			Type:    frrv1alpha1.FrrConditionConfigRendered,
+			Status:  metav1.ConditionFalse,
+			Reason:  ReasonRenderFailed,
+			Message: msg,
+		}, metav1.Condition{
+			Type:    frrv1alpha1.FrrConditionDegraded,
+			Status:  metav1.ConditionTrue,
+			Reason:  ReasonRenderFailed,
+			Message: msg,
+		}); updateErr != nil {
+			return nil, updateErr
+		}
+		// The spec or a Secret it refers to has to change for the
+		// configuration to render, which enqueues the Frr again
+		return nil, nil
+	}
+
+	desired := newConfigSecret(frr, config)
+	secret, err := c.secretsLister.Secrets(frr.Namespace).Get(desired.Name)
+	if errors.IsNotFound(err) {
+		if _, err = c.kubeclientset.CoreV1().Secrets(frr.Namespace).Create(context.TODO(), desired, metav1.CreateOptions{}); err != nil {
+			return nil, err
+		}
+		return config, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !metav1.IsControlledBy(secret, frr) {
+		msg := fmt.Sprintf(MessageResourceExists, secret.Name)
+		c.recorder.Event(frr, corev1.EventTypeWarning, ErrResourceExists, msg)
+		return nil, fmt.Errorf("%s", msg)
+	}
+	if bytes.Equal(secret.Data[frrConfKey], desired.Data[frrConfKey]) {
+		return config, nil
+	}
+	klog.V(4).Infof("Frr %s/%s: updating secret %s", frr.Namespace, frr.Name, secret.Name)
+	secretCopy := secret.DeepCopy()
+	secretCopy.Data = desired.Data
+	if _, err = c.kubeclientset.CoreV1().Secrets(frr.Namespace).Update(context.TODO(), secretCopy, metav1.UpdateOptions{}); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
@@ -18,21 +18,34 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
-	"strings"
+	"hash/fnv"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/rand"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/apimachinery/pkg/util/wait"
 	appsinformers "k8s.io/client-go/informers/apps/v1"
+	batchinformers "k8s.io/client-go/informers/batch/v1"
+	coreinformers "k8s.io/client-go/informers/core/v1"
+	rbacinformers "k8s.io/client-go/informers/rbac/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/scheme"
 	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
 	appslisters "k8s.io/client-go/listers/apps/v1"
+	batchlisters "k8s.io/client-go/listers/batch/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	rbaclisters "k8s.io/client-go/listers/rbac/v1"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/record"
 	"k8s.io/client-go/util/workqueue"
@@ -44,10 +57,12 @@ import (
 	informers "github.com/guohao117/frr-controller/pkg/generated/informers/externalversions/frrcontroller/v1alpha1"
 	listers "github.com/guohao117/frr-controller/pkg/generated/listers/frrcontroller/v1alpha1"
 
+	"github.com/guohao117/frr-controller/pkg/frrconf"
+	"github.com/guohao117/frr-controller/pkg/metrics"
 	"github.com/guohao117/frr-controller/pkg/range_manager"
 )
 
-const controllerAgentName = "sample-controller"
+const controllerAgentName = "frr-controller"
 
 const (
 	// SuccessSynced is used as part of the Event 'reason' when a Frr is synced
@@ -62,28 +77,106 @@ const (
 	// MessageResourceSynced is the message used for an Event fired when a Frr
 	// is synced successfully
 	MessageResourceSynced = "Frr synced successfully"
-)
 
-var (
-	frrUID int64 = 100
-	frrGID int64 = 101
+	// ErrAllocationConflict is used as part of the Event 'reason' when a
+	// number found on an existing Deployment cannot be reserved again
+	// because it is out of range or already held by another Frr.
+	ErrAllocationConflict = "ErrAllocationConflict"
+	// MessageAllocationConflict is the message used for Events when a
+	// number recovered from the cluster cannot be reserved
+	MessageAllocationConflict = "Failed to reserve %s %d found on Deployment %q: %v"
+	// ErrReservationFailed is used as part of the Event 'reason' when a
+	// number set in the Frr spec cannot be reserved
+	ErrReservationFailed = "ErrReservationFailed"
+	// MessageReservationFailed is the message used for Events when a number
+	// set in the Frr spec cannot be reserved
+	MessageReservationFailed = "Cannot reserve %s %d from pool %q: %v"
+	// ErrPoolExhausted is used as part of the Event 'reason' when no number
+	// is left in the pool of a Frr
+	ErrPoolExhausted = "ErrPoolExhausted"
+	// MessagePoolExhausted is the message used for Events when no number is
+	// left in the pool of a Frr
+	MessagePoolExhausted = "Cannot allocate %s from pool %q: %v"
+	// ErrPoolNotFound is used as part of the Event 'reason' when the pool a
+	// Frr allocates from does not exist
+	ErrPoolNotFound = "ErrPoolNotFound"
+	// ErrRenderFailed is used as part of the Event 'reason' when frr.conf of
+	// a Frr cannot be rendered
+	ErrRenderFailed = "ErrRenderFailed"
+	// MessageRenderFailed is the message used for Events when frr.conf of a
+	// Frr cannot be rendered
+	MessageRenderFailed = "Failed to render frr.conf: %v"
+	// ErrPoolInvalid is used as part of the Event 'reason' when the range of
+	// a pool cannot be used
+	ErrPoolInvalid = "ErrPoolInvalid"
+	// MessagePoolInvalid is the message used for Events when the range of a
+	// pool cannot be used
+	MessagePoolInvalid = "Invalid pool range: %v"
+	// ErrPoolShrinkRefused is used as part of the Event 'reason' when a pool
+	// is not resized because allocated numbers would fall outside of it
+	ErrPoolShrinkRefused = "ErrPoolShrinkRefused"
+	// MessagePoolShrinkRefused is the message used for Events when a pool is
+	// not resized
+	MessagePoolShrinkRefused = "Refusing to resize pool to %d-%d: %v"
+	// ErrTeardownFailed is used as part of the Event 'reason' when the
+	// network of a Frr cannot be removed from a node
+	ErrTeardownFailed = "ErrTeardownFailed"
+	// MessageTeardownFailed is the message used for Events when the network
+	// of a Frr cannot be removed from a node
+	MessageTeardownFailed = "Failed to remove the network from the nodes, delete the Job to try again: %s"
 )
 
+// specHashAnnotation is set on the pod template of a Deployment to the hash
+// of the spec it was built from
+const specHashAnnotation = "frrcontroller.nocsys.cn/spec-hash"
+
 // Controller is the controller implementation for Frr resources
 type Controller struct {
-	// vni allocator
-	vniManager *rangemanager.RangeManager
-	// asn allocator
-	asnManager *rangemanager.RangeManager
+	// vni allocators, one per VNIPool
+	vniPools *rangemanager.Pools
+	// asn allocators, one per ASNPool
+	asnPools *rangemanager.Pools
+	// ranges of the default pools given on the command line
+	staticVNIRange poolRange
+	staticASNRange poolRange
+	// allocationStorage persists the allocator state, nil keeps it in
+	// memory only
+	allocationStorage rangemanager.Storage
+	// allocationsRestored is set while Run holds the allocator state
+	// rebuilt from the cluster
+	allocationsRestored atomic.Bool
 	// kubeclientset is a standard kubernetes clientset
 	kubeclientset kubernetes.Interface
-	// sampleclientset is a clientset for our own API group
+	// frrclientset is a clientset for our own API group
 	frrclientset clientset.Interface
 
-	deploymentsLister appslisters.DeploymentLister
-	deploymentsSynced cache.InformerSynced
-	frrsLister        listers.FrrLister
-	frrsSynced        cache.InformerSynced
+	deploymentsLister     appslisters.DeploymentLister
+	deploymentsSynced     cache.InformerSynced
+	podsLister            corelisters.PodLister
+	podsSynced            cache.InformerSynced
+	secretsLister         corelisters.SecretLister
+	secretsSynced         cache.InformerSynced
+	frrsLister            listers.FrrLister
+	frrsIndexer           cache.Indexer
+	frrsSynced            cache.InformerSynced
+	vniPoolsLister        listers.VNIPoolLister
+	vniPoolsSynced        cache.InformerSynced
+	asnPoolsLister        listers.ASNPoolLister
+	asnPoolsSynced        cache.InformerSynced
+	jobsLister            batchlisters.JobLister
+	jobsSynced            cache.InformerSynced
+	nodesLister           corelisters.NodeLister
+	nodesSynced           cache.InformerSynced
+	serviceAccountsLister corelisters.ServiceAccountLister
+	serviceAccountsSynced cache.InformerSynced
+	roleBindingsLister    rbaclisters.RoleBindingLister
+	roleBindingsSynced    cache.InformerSynced
+	// passwordSecrets caches the Secrets the BGP passwords are read from
+	passwordSecrets *passwordSecrets
+	// deletedFrrs holds the last state seen of deleted Frrs, keyed by
+	// namespace/name, until the numbers they held are released
+	deletedFrrsLock sync.Mutex
+	deletedFrrs     map[string]*frrv1alpha1.Frr
 
 	// workqueue is a rate limited work queue. This is used to queue work to be
 	// processed instead of performing it as soon as a change happens. This
@@ -91,23 +184,35 @@ type Controller struct {
 	// time, and makes it easy to ensure we are never processing the same item
 	// simultaneously in two different workers.
 	workqueue workqueue.RateLimitingInterface
+	// poolqueue holds the VNIPool and ASNPool keys, as kind/name, whose
+	// allocator or status needs to be synced.
+	poolqueue workqueue.RateLimitingInterface
 	// recorder is an event recorder for recording Event resources to the
 	// Kubernetes API.
 	recorder record.EventRecorder
 }
 
-// NewController returns a new sample controller
+// NewController returns a new frr controller
 func NewController(
 	kubeclientset kubernetes.Interface,
 	frrclientset clientset.Interface,
 	deploymentInformer appsinformers.DeploymentInformer,
+	podInformer coreinformers.PodInformer,
+	secretInformer coreinformers.SecretInformer,
 	frrInformer informers.FrrInformer,
+	vniPoolInformer informers.VNIPoolInformer,
+	asnPoolInformer informers.ASNPoolInformer,
+	jobInformer batchinformers.JobInformer,
+	nodeInformer coreinformers.NodeInformer,
+	serviceAccountInformer coreinformers.ServiceAccountInformer,
+	roleBindingInformer rbacinformers.RoleBindingInformer,
 	minVNI, maxVNI int,
-	minASN, maxASN int) *Controller {
+	minASN, maxASN int,
+	allocationStorage rangemanager.Storage) *Controller {
 
 	// Create event broadcaster
-	// Add sample-controller types to the default Kubernetes Scheme so Events can be
-	// logged for sample-controller types.
+	// Add frr-controller types to the default Kubernetes Scheme so Events can be
+	// logged for frr-controller types.
 	utilruntime.Must(frrscheme.AddToScheme(scheme.Scheme))
 	klog.V(4).Info("Creating event broadcaster")
 	eventBroadcaster := record.NewBroadcaster()
@@ -115,27 +220,60 @@ func NewController(
 	eventBroadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: kubeclientset.CoreV1().Events("")})
 	recorder := eventBroadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: controllerAgentName})
 
-	vniMan, err := rangemanager.NewRangeManager(minVNI, maxVNI)
-	if err != nil {
-		return nil
-	}
-	asnMan, err := rangemanager.NewRangeManager(minASN, maxASN)
-	if err != nil {
-		return nil
-	}
 	controller := &Controller{
-		vniManager:        vniMan,
-		asnManager:        asnMan,
-		kubeclientset:     kubeclientset,
-		frrclientset:      frrclientset,
-		deploymentsLister: deploymentInformer.Lister(),
-		deploymentsSynced: deploymentInformer.Informer().HasSynced,
-		frrsLister:        frrInformer.Lister(),
-		frrsSynced:        frrInformer.Informer().HasSynced,
-		workqueue:         workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "Frrs"),
-		recorder:          recorder,
+		vniPools:              rangemanager.NewPools(),
+		asnPools:              rangemanager.NewPools(),
+		staticVNIRange:        poolRange{start: minVNI, end: maxVNI},
+		staticASNRange:        poolRange{start: minASN, end: maxASN},
+		allocationStorage:     allocationStorage,
+		kubeclientset:         kubeclientset,
+		frrclientset:          frrclientset,
+		deploymentsLister:     deploymentInformer.Lister(),
+		deploymentsSynced:     deploymentInformer.Informer().HasSynced,
+		podsLister:            podInformer.Lister(),
+		podsSynced:            podInformer.Informer().HasSynced,
+		secretsLister:         secretInformer.Lister(),
+		secretsSynced:         secretInformer.Informer().HasSynced,
+		frrsLister:            frrInformer.Lister(),
+		frrsIndexer:           frrInformer.Informer().GetIndexer(),
+		frrsSynced:            frrInformer.Informer().HasSynced,
+		vniPoolsLister:        vniPoolInformer.Lister(),
+		vniPoolsSynced:        vniPoolInformer.Informer().HasSynced,
+		asnPoolsLister:        asnPoolInformer.Lister(),
+		asnPoolsSynced:        asnPoolInformer.Informer().HasSynced,
+		jobsLister:            jobInformer.Lister(),
+		jobsSynced:            jobInformer.Informer().HasSynced,
+		nodesLister:           nodeInformer.Lister(),
+		nodesSynced:           nodeInformer.Informer().HasSynced,
+		serviceAccountsLister: serviceAccountInformer.Lister(),
+		serviceAccountsSynced: serviceAccountInformer.Informer().HasSynced,
+		roleBindingsLister:    roleBindingInformer.Lister(),
+		roleBindingsSynced:    roleBindingInformer.Informer().HasSynced,
+		deletedFrrs:           make(map[string]*frrv1alpha1.Frr),
+		workqueue:             workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "Frrs"),
+		poolqueue:             workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "Pools"),
+		recorder:              recorder,
 	}
 
+	utilruntime.Must(frrInformer.Informer().AddIndexers(cache.Indexers{
+		passwordSecretIndex: passwordSecretKeys,
+		poolIndex:           frrPoolKeys,
+	}))
+	// Set up an event handler for when the password Secrets change, so that
+	// rotated passwords are rendered
+	controller.passwordSecrets = newPasswordSecrets(kubeclientset, cache.ResourceEventHandlerFuncs{
+		AddFunc: controller.handlePasswordSecret,
+		UpdateFunc: func(old, new interface{}) {
+			newSecret := new.(*corev1.Secret)
+			oldSecret := old.(*corev1.Secret)
+			if newSecret.ResourceVersion == oldSecret.ResourceVersion {
+				return
+			}
+			controller.handlePasswordSecret(new)
+		},
+		DeleteFunc: controller.handlePasswordSecret,
+	})
+
 	klog.Info("Setting up event handlers")
 	// Set up an event handler for when Frr resources change
 	frrInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
@@ -143,6 +281,7 @@ func NewController(
 		UpdateFunc: func(old, new interface{}) {
 			controller.enqueueFrr(new)
 		},
+		DeleteFunc: controller.enqueueDeletedFrr,
 	})
 	// Set up an event handler for when Deployment resources change. This
 	// handler will lookup the owner of the given Deployment, and if it is
@@ -164,6 +303,73 @@ func NewController(
 		},
 		DeleteFunc: controller.handleObject,
 	})
+	// Set up an event handler for when Secrets change, so that edits of the
+	// frr.conf of a Frr are reverted
+	secretInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: controller.handleSecret,
+		UpdateFunc: func(old, new interface{}) {
+			newSecret := new.(*corev1.Secret)
+			oldSecret := old.(*corev1.Secret)
+			if newSecret.ResourceVersion == oldSecret.ResourceVersion {
+				return
+			}
+			controller.handleSecret(new)
+		},
+		DeleteFunc: controller.handleSecret,
+	})
+	// Set up an event handler for when the pods of a Frr change, so that
+	// its status tells where they run
+	podInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: controller.handlePod,
+		UpdateFunc: func(old, new interface{}) {
+			newPod := new.(*corev1.Pod)
+			oldPod := old.(*corev1.Pod)
+			if newPod.ResourceVersion == oldPod.ResourceVersion {
+				return
+			}
+			controller.handlePod(new)
+		},
+		DeleteFunc: controller.handlePod,
+	})
+	// Set up an event handler for when the teardown Jobs of a Frr change, so
+	// that it is synced again once they are done
+	jobInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: controller.handleObject,
+		UpdateFunc: func(old, new interface{}) {
+			newJob := new.(*batchv1.Job)
+			oldJob := old.(*batchv1.Job)
+			if newJob.ResourceVersion == oldJob.ResourceVersion {
+				return
+			}
+			controller.handleObject(new)
+		},
+		DeleteFunc: controller.handleObject,
+	})
+	// Set up event handlers for when the service accounts of the pods of a
+	// Frr and their RoleBindings change, so that they are restored
+	for _, informer := range []cache.SharedIndexInformer{serviceAccountInformer.Informer(), roleBindingInformer.Informer()} {
+		informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc: controller.handleObject,
+			UpdateFunc: func(old, new interface{}) {
+				if new.(metav1.Object).GetResourceVersion() == old.(metav1.Object).GetResourceVersion() {
+					return
+				}
+				controller.handleObject(new)
+			},
+			DeleteFunc: controller.handleObject,
+		})
+	}
+	// Set up event handlers for when the pools change, so that their
+	// allocators follow the spec
+	for _, informer := range []cache.SharedIndexInformer{vniPoolInformer.Informer(), asnPoolInformer.Informer()} {
+		informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc: controller.handlePool,
+			UpdateFunc: func(old, new interface{}) {
+				controller.handlePool(new)
+			},
+			DeleteFunc: controller.handlePool,
+		})
+	}
 
 	return controller
 }
@@ -175,21 +381,46 @@ func NewController(
 func (c *Controller) Run(workers int, stopCh <-chan struct{}) error {
 	defer utilruntime.HandleCrash()
 	defer c.workqueue.ShutDown()
+	defer c.poolqueue.ShutDown()
+	defer c.passwordSecrets.stop()
 
 	// Start the informer factories to begin populating the informer caches
 	klog.Info("Starting Frr controller")
 
 	// Wait for the caches to be synced before starting workers
 	klog.Info("Waiting for informer caches to sync")
-	if ok := cache.WaitForCacheSync(stopCh, c.deploymentsSynced, c.frrsSynced); !ok {
+	if ok := cache.WaitForCacheSync(stopCh, c.deploymentsSynced, c.podsSynced, c.secretsSynced, c.frrsSynced, c.vniPoolsSynced, c.asnPoolsSynced, c.jobsSynced, c.nodesSynced, c.serviceAccountsSynced, c.roleBindingsSynced); !ok {
 		return fmt.Errorf("failed to wait for caches to sync")
 	}
 
+	klog.Info("Building VNI and ASN pools")
+	if err := c.initPools(); err != nil {
+		return fmt.Errorf("failed to build pools: %v", err)
+	}
+
+	// Rebuild the allocator state from the saved snapshot and the cluster
+	// before any worker gets a chance to hand out a number that is already
+	// in use
+	klog.Info("Recovering VNI and ASN allocations")
+	if err := c.restoreAllocations(); err != nil {
+		return fmt.Errorf("failed to restore allocations: %v", err)
+	}
+	if err := c.recoverAllocations(); err != nil {
+		return fmt.Errorf("failed to recover allocations: %v", err)
+	}
+	if err := c.persistAllocations(); err != nil {
+		return fmt.Errorf("failed to persist allocations: %v", err)
+	}
+	c.allocationsRestored.Store(true)
+	defer c.allocationsRestored.Store(false)
+
 	klog.Info("Starting workers")
 	// Launch two workers to process Frr resources
 	for i := 0; i < workers; i++ {
 		go wait.Until(c.runWorker, time.Second, stopCh)
 	}
+	// Pools are cheap to sync, a single worker is enough
+	go wait.Until(c.runPoolWorker, time.Second, stopCh)
 
 	klog.Info("Started workers")
 	<-stopCh
@@ -241,7 +472,10 @@ func (c *Controller) processNextWorkItem() bool {
 		}
 		// Run the syncHandler, passing it the namespace/name string of the
 		// Frr resource to be synced.
-		if err := c.syncHandler(key); err != nil {
+		start := time.Now()
+		err := c.syncHandler(key)
+		metrics.ObserveReconcile(start, err)
+		if err != nil {
 			// Put the item back on the workqueue to handle any transient errors.
 			c.workqueue.AddRateLimited(key)
 			return fmt.Errorf("error syncing '%s': %s, requeuing", key, err.Error())
@@ -279,12 +513,24 @@ func (c *Controller) syncHandler(key string) error {
 		// processing.
 		if errors.IsNotFound(err) {
 			utilruntime.HandleError(fmt.Errorf("frr '%s' in work queue no longer exists", key))
-			return nil
+			c.syncPasswordSecrets()
+			// Normally the finalizer released everything already, this
+			// covers Frrs whose finalizer was removed by hand.
+			return c.releaseDeletedFrr(key)
 		}
 
 		return err
 	}
-	frrscopedName := frr.Namespace + "/" + frr.Name
+
+	// A Frr being deleted gives its numbers back once its Deployment is gone
+	if frr.DeletionTimestamp != nil {
+		return c.finalizeFrr(frr)
+	}
+	if !hasFinalizer(frr) {
+		if frr, err = c.addFinalizer(frr); err != nil {
+			return err
+		}
+	}
 
 	deploymentName := frr.Spec.DeploymentName
 	if deploymentName == "" {
@@ -295,23 +541,41 @@ func (c *Controller) syncHandler(key string) error {
 		return nil
 	}
 
+	// Reserve or allocate the numbers of the Frr before anything uses them
+	asn, vnis, vrfs, err := c.allocateNumbers(frr)
+	if err != nil {
+		return err
+	}
+	deriveRouteTargets(frr, asn.number, vnis, vrfs)
+
+	// Publish frr.conf before the Deployment mounting it
+	config, err := c.syncConfig(frr, asn.number, vnis, vrfs)
+	if err != nil || config == nil {
+		return err
+	}
+	// The pods run as a service account frr-reloader may annotate them with
+	if err := c.syncReloaderAccess(frr); err != nil {
+		return err
+	}
+
+	// changed tells whether the sync did anything worth a Synced event, as
+	// the Frr is synced again on every event of its pods and Secrets
+	changed := false
+
 	// Get the deployment with the name specified in Frr.spec
 	deployment, err := c.deploymentsLister.Deployments(frr.Namespace).Get(deploymentName)
 	// If the resource doesn't exist, we'll create it
 	if errors.IsNotFound(err) {
-		asn, err := c.asnManager.Allocate(frrscopedName)
-		if err != nil {
-			return err
-		}
-		vni, err := c.vniManager.Allocate(frrscopedName)
-		if err != nil {
+		var desired *appsv1.Deployment
+		if desired, err = newDeployment(frr, asn.number, vnis, vrfs); err != nil {
 			return err
 		}
-		deployment, err = c.kubeclientset.AppsV1().Deployments(frr.Namespace).Create(context.TODO(), newDeployment(frr, asn, vni), metav1.CreateOptions{})
+		deployment, err = c.kubeclientset.AppsV1().Deployments(frr.Namespace).Create(context.TODO(), desired, metav1.CreateOptions{})
 		if err != nil {
 			klog.Errorf("Failed to create deployment: %v", err)
 			return err
 		}
+		changed = true
 	}
 
 	// If an error occurs during Get/Create, we'll requeue the item so we can
@@ -326,16 +590,37 @@ func (c *Controller) syncHandler(key string) error {
 	if !metav1.IsControlledBy(deployment, frr) {
 		msg := fmt.Sprintf(MessageResourceExists, deployment.Name)
 		c.recorder.Event(frr, corev1.EventTypeWarning, ErrResourceExists, msg)
+		if err := c.updateFrrConditions(frr, allocatedCondition(asn, vnis, vrfs), metav1.Condition{
+			Type:    frrv1alpha1.FrrConditionDeploymentReady,
+			Status:  metav1.ConditionFalse,
+			Reason:  ReasonDeploymentNotOwned,
+			Message: msg,
+		}, metav1.Condition{
+			Type:    frrv1alpha1.FrrConditionDegraded,
+			Status:  metav1.ConditionTrue,
+			Reason:  ReasonDeploymentNotOwned,
+			Message: msg,
+		}); err != nil {
+			return err
+		}
 		return fmt.Errorf("%s", msg)
 	}
 
-	// If this number of the replicas on the Frr resource is specified, and the
-	// number does not equal the current desired replicas on the Deployment, we
-	// should update the Deployment resource.
-	// if frr.Spec.Replicas != nil && *frr.Spec.Replicas != *deployment.Spec.Replicas {
-	// 	klog.V(4).Infof("Frr %s replicas: %d, deployment replicas: %d", name, *frr.Spec.Replicas, *deployment.Spec.Replicas)
-	// 	deployment, err = c.kubeclientset.AppsV1().Deployments(frr.Namespace).Update(context.TODO(), newDeployment(frr), metav1.UpdateOptions{})
-	// }
+	// If the Deployment differs from the one the Frr asks for, because the
+	// spec of the Frr changed or the Deployment was edited, we should update
+	// the Deployment resource. A changed pod template rolls the replicas.
+	desired, err := newDeployment(frr, asn.number, vnis, vrfs)
+	if err != nil {
+		return err
+	}
+	if deploymentNeedsUpdate(deployment, desired) {
+		klog.V(4).Infof("Frr %s: updating deployment %s, spec hash %s", key, deployment.Name, desired.Spec.Template.Annotations[specHashAnnotation])
+		deploymentCopy := deployment.DeepCopy()
+		deploymentCopy.Spec.Replicas = desired.Spec.Replicas
+		deploymentCopy.Spec.Template = desired.Spec.Template
+		deployment, err = c.kubeclientset.AppsV1().Deployments(frr.Namespace).Update(context.TODO(), deploymentCopy, metav1.UpdateOptions{})
+		changed = true
+	}
 
 	// If an error occurs during Update, we'll requeue the item so we can
 	// attempt processing again later. This could have been caused by a
@@ -346,29 +631,68 @@ func (c *Controller) syncHandler(key string) error {
 
 	// Finally, we update the status block of the Frr resource to reflect the
 	// current state of the world
-	err = c.updateFrrStatus(frr, deployment)
+	updated, err := c.updateFrrStatus(frr, deployment, asn, vnis, vrfs, frrconf.Hash(config))
 	if err != nil {
 		return err
 	}
+	changed = changed || !equality.Semantic.DeepEqual(frr.Status, updated.Status)
 
-	c.recorder.Event(frr, corev1.EventTypeNormal, SuccessSynced, MessageResourceSynced)
+	// The VNIs the Frr no longer uses are given back once the pods moved
+	// off them
+	if err := c.releaseRetiredVNIs(updated, deployment); err != nil {
+		return err
+	}
+
+	if changed {
+		c.recorder.Event(frr, corev1.EventTypeNormal, SuccessSynced, MessageResourceSynced)
+	}
 	return nil
 }
 
-func (c *Controller) updateFrrStatus(frr *frrv1alpha1.Frr, deployment *appsv1.Deployment) error {
+// updateFrrStatus saves the status of the Frr holding the given numbers and
+// running the given Deployment, and returns the updated Frr
+func (c *Controller) updateFrrStatus(frr *frrv1alpha1.Frr, deployment *appsv1.Deployment, asn numberAllocation, vnis []l2vni, vrfs []l3vni, configHash string) (*frrv1alpha1.Frr, error) {
 	// NEVER modify objects from the store. It's a read-only, local cache.
 	// You can use DeepCopy() to make a deep copy of original object and modify this copy
 	// Or create a copy manually for better performance
 	frrCopy := frr.DeepCopy()
-	frrCopy.Status.VNI = frr.Spec.VNI
+	frrCopy.Status.VNI = vnis[0].number
+	frrCopy.Status.VNIAllocation = vnis[0].status()
+	frrCopy.Status.VNIs = nil
+	if len(frr.Spec.VNIs) > 0 {
+		for i := range vnis {
+			frrCopy.Status.VNIs = append(frrCopy.Status.VNIs, vnis[i].l2vniStatus())
+		}
+	}
+	frrCopy.Status.VRFs = nil
+	for i := range vrfs {
+		frrCopy.Status.VRFs = append(frrCopy.Status.VRFs, vrfs[i].vrfStatus())
+	}
+	frrCopy.Status.ASNumber = asn.number
+	frrCopy.Status.ASNumberAllocation = asn.status()
 	frrCopy.Status.AvailableReplicas = deployment.Status.AvailableReplicas
+	nodes, pods, err := c.frrPodStatus(frr)
+	if err != nil {
+		return nil, err
+	}
+	frrCopy.Status.Nodes = nodes
+	frrCopy.Status.Pods = pods
+	// The nodes connect-frr set up the network on are kept until it is
+	// removed from them, wherever the pods run now
+	podList, err := c.podsLister.Pods(frr.Namespace).List(labels.SelectorFromSet(podLabels(frr)))
+	if err != nil {
+		return nil, err
+	}
+	frrCopy.Status.NetworkNodes = networkNodes(frr, podList)
+	frrCopy.Status.RetiredVNIs = c.retiredVNIStatus(frr, frrCopy.Status.NetworkNodes)
+	conditions := append([]metav1.Condition{allocatedCondition(asn, vnis, vrfs)}, deploymentConditions(deployment, pods, configHash)...)
+	setFrrConditions(frrCopy, conditions...)
 
 	// If the CustomResourceSubresources feature gate is not enabled,
 	// we must use Update instead of UpdateStatus to update the Status block of the Frr resource.
 	// UpdateStatus will not allow changes to the Spec of the resource,
 	// which is ideal for ensuring nothing other than resource status has been updated.
-	_, err := c.frrclientset.FrrcontrollerV1alpha1().Frrs(frr.Namespace).UpdateStatus(context.TODO(), frrCopy, metav1.UpdateOptions{})
-	return err
+	return c.frrclientset.FrrcontrollerV1alpha1().Frrs(frr.Namespace).UpdateStatus(context.TODO(), frrCopy, metav1.UpdateOptions{})
 }
 
 // enqueueFrr takes a Frr resource and converts it into a namespace/name
@@ -384,6 +708,28 @@ func (c *Controller) enqueueFrr(obj interface{}) {
 	c.workqueue.Add(key)
 }
 
+// enqueueDeletedFrr is the DeleteFunc counterpart of enqueueFrr. It also
+// accepts the DeletedFinalStateUnknown tombstones the informer hands out when
+// it missed the deletion, so that the allocations of the Frr are released.
+// The last state of the Frr is kept for releaseDeletedFrr.
+func (c *Controller) enqueueDeletedFrr(obj interface{}) {
+	var key string
+	var err error
+	if key, err = cache.DeletionHandlingMetaNamespaceKeyFunc(obj); err != nil {
+		utilruntime.HandleError(err)
+		return
+	}
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	if frr, ok := obj.(*frrv1alpha1.Frr); ok {
+		c.deletedFrrsLock.Lock()
+		c.deletedFrrs[key] = frr.DeepCopy()
+		c.deletedFrrsLock.Unlock()
+	}
+	c.workqueue.Add(key)
+}
+
 // handleObject will take any resource implementing metav1.Object and attempt
 // to find the Frr resource that 'owns' it. It does this by looking at the
 // objects metadata.ownerReferences field for an appropriate OwnerReference.
@@ -422,46 +768,46 @@ func (c *Controller) handleObject(obj interface{}) {
 		c.enqueueFrr(frr)
 		return
 	}
+	// The teardown Jobs of a Frr which is gone have no owner
+	if labels := object.GetLabels(); labels["app"] == teardownApp && labels["controller"] != "" {
+		c.workqueue.Add(object.GetNamespace() + "/" + labels["controller"])
+	}
 }
 
-// func newInitContainers(frr *frrv1alpha1.Frr) []corev1.Container {
-// }
-
-// newDeployment creates a new Deployment for a Frr resource. It also sets
-// the appropriate OwnerReferences on the resource so handleObject can discover
-// the Frr resource that 'owns' it.
-func newDeployment(frr *frrv1alpha1.Frr, asn, vni int) *appsv1.Deployment {
-	labels := map[string]string{
-		"app":        "frr",
-		"controller": frr.Name,
-	}
+// newDeployment creates a new Deployment for a Frr resource holding the given
+// AS number, L2VNIs and VRFs. It also sets the appropriate OwnerReferences on the
+// resource so handleObject can discover the Frr resource that 'owns' it.
+func newDeployment(frr *frrv1alpha1.Frr, asn int, vnis []l2vni, vrfs []l3vni) (*appsv1.Deployment, error) {
+	labels := podLabels(frr)
 	frrContainerEnv := make([]corev1.EnvVar, 0)
 	frrContainerEnv = append(frrContainerEnv, corev1.EnvVar{
 		Name:  "ASNUMBER",
-		Value: fmt.Sprintf("%d", frr.Spec.ASNumber),
-	})
-	frrContainerEnv = append(frrContainerEnv, corev1.EnvVar{
-		Name:  "NEIGHBORS",
-		Value: strings.Join(frr.Spec.Neighbors, ","),
-	})
-	frrContainerEnv = append(frrContainerEnv, corev1.EnvVar{
-		Name:  "VNI",
-		Value: fmt.Sprintf("%d", vni),
+		Value: fmt.Sprintf("%d", asn),
 	})
+	if len(frr.Spec.VNIs) == 0 {
+		frrContainerEnv = append(frrContainerEnv, corev1.EnvVar{
+			Name:  "VNI",
+			Value: fmt.Sprintf("%d", vnis[0].number),
+		})
+	} else {
+		frrContainerEnv = append(frrContainerEnv, corev1.EnvVar{
+			Name:  vnisEnv,
+			Value: formatVNIsEnv(vnis),
+		})
+	}
+	if len(vrfs) > 0 {
+		frrContainerEnv = append(frrContainerEnv, corev1.EnvVar{
+			Name:  vrfsEnv,
+			Value: formatVRFsEnv(vrfs),
+		})
+	}
 	frrContainerEnv = append(frrContainerEnv, corev1.EnvVar{
 		Name:  "TINT_SUBREAPER",
 		Value: "true",
 	})
-	// add an envfrom status.podIP
-	frrContainerEnv = append(frrContainerEnv, corev1.EnvVar{
-		Name: "VTEP_LOCAL",
-		ValueFrom: &corev1.EnvVarSource{
-			FieldRef: &corev1.ObjectFieldSelector{
-				APIVersion: "v1",
-				FieldPath:  "status.podIP",
-			},
-		},
-	})
+	// add the local address of the VTEP, status.podIP unless spec.vxlan
+	// says otherwise
+	frrContainerEnv = append(frrContainerEnv, vtepLocalEnv(frr)...)
 	frrContainerSecurityContext := &corev1.SecurityContext{}
 	frrContainerSecurityContext.Capabilities = &corev1.Capabilities{
 		Add: []corev1.Capability{
@@ -471,31 +817,25 @@ func newDeployment(frr *frrv1alpha1.Frr, asn, vni int) *appsv1.Deployment {
 	}
 
 	volumes := make([]corev1.Volume, 0)
-	// add a emptyDir volume for frr-conf
+	// add a secret volume for the frr.conf rendered by the controller, which
+	// holds the BGP passwords
 	volumes = append(volumes, corev1.Volume{
-		Name: "frr-startup",
+		Name: "frr-conf",
 		VolumeSource: corev1.VolumeSource{
-			EmptyDir: &corev1.EmptyDirVolumeSource{},
-		},
-	})
-
-	ovsVols := make([]corev1.Volume, 0)
-	ovsVols = append(ovsVols, corev1.Volume{
-		Name: "host-var-run-ovs",
-		VolumeSource: corev1.VolumeSource{
-			HostPath: &corev1.HostPathVolumeSource{
-				Path: "/var/run/openvswitch",
+			Secret: &corev1.SecretVolumeSource{
+				SecretName: configSecretName(frr),
 			},
 		},
 	})
-	ovsVols = append(ovsVols, corev1.Volume{
-		Name: "host-run-ovs",
+	// add a volume sharing the vty sockets of the daemons with frr-reloader
+	volumes = append(volumes, corev1.Volume{
+		Name: frrRunVolume,
 		VolumeSource: corev1.VolumeSource{
-			HostPath: &corev1.HostPathVolumeSource{
-				Path: "/run/openvswitch",
-			},
+			EmptyDir: &corev1.EmptyDirVolumeSource{},
 		},
 	})
+
+	ovsVols := ovsVolumes()
 	ovsVols = append(ovsVols, corev1.Volume{
 		Name: "host-modules",
 		VolumeSource: corev1.VolumeSource{
@@ -505,18 +845,17 @@ func newDeployment(frr *frrv1alpha1.Frr, asn, vni int) *appsv1.Deployment {
 		},
 	})
 
-	initContainerVolumeMounts := make([]corev1.VolumeMount, 0)
-	initContainerVolumeMounts = append(initContainerVolumeMounts, corev1.VolumeMount{
-		Name:      "frr-startup",
-		MountPath: "/tmp/frr",
-	})
-
 	frrContainerVolumeMounts := make([]corev1.VolumeMount, 0)
 	// add a volume mount for frr-conf
-	// frrContainerVolumeMounts = append(frrContainerVolumeMounts, corev1.VolumeMount{
-	// 	Name:      "frr-conf",
-	// 	MountPath: "/etc/frr",
-	// })
+	frrContainerVolumeMounts = append(frrContainerVolumeMounts, corev1.VolumeMount{
+		Name:      "frr-conf",
+		MountPath: frrConfMountPath,
+		ReadOnly:  true,
+	})
+	frrContainerVolumeMounts = append(frrContainerVolumeMounts, corev1.VolumeMount{
+		Name:      frrRunVolume,
+		MountPath: frrRunPath,
+	})
 	frrContainerVolumeMounts = append(frrContainerVolumeMounts, corev1.VolumeMount{
 		Name:      "host-var-run-ovs",
 		MountPath: "/var/run/openvswitch",
@@ -530,9 +869,8 @@ func newDeployment(frr *frrv1alpha1.Frr, asn, vni int) *appsv1.Deployment {
 		MountPath: "/lib/modules",
 		ReadOnly:  true,
 	})
-	frrContainerVolumeMounts = append(frrContainerVolumeMounts, initContainerVolumeMounts...)
 
-	return &appsv1.Deployment{
+	deployment := &appsv1.Deployment{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      frr.Spec.DeploymentName,
 			Namespace: frr.Namespace,
@@ -550,24 +888,9 @@ func newDeployment(frr *frrv1alpha1.Frr, asn, vni int) *appsv1.Deployment {
 					Labels: labels,
 				},
 				Spec: corev1.PodSpec{
-					HostNetwork: true,
-					Volumes:     append(volumes, ovsVols...),
-					InitContainers: []corev1.Container{
-						{
-							Name:            "frr-conf-init",
-							Image:           frr.Spec.InitConfigImage,
-							ImagePullPolicy: corev1.PullIfNotPresent,
-							Env:             frrContainerEnv,
-							VolumeMounts:    initContainerVolumeMounts,
-							SecurityContext: &corev1.SecurityContext{
-								RunAsUser:  &frrUID,
-								RunAsGroup: &frrGID,
-							},
-							Args: []string{
-								"/tmp/frr/frr.conf",
-							},
-						},
-					},
+					ServiceAccountName: reloaderServiceAccountName(frr),
+					HostNetwork:        true,
+					Volumes:            append(volumes, ovsVols...),
 					Containers: []corev1.Container{
 						{
 							Name:            "frr",
@@ -580,7 +903,9 @@ func newDeployment(frr *frrv1alpha1.Frr, asn, vni int) *appsv1.Deployment {
 							},
 							Args: []string{
 								"-c",
-								"/sbin/tini -- cp /tmp/frr/frr.conf /etc/frr/ && /usr/lib/frr/docker-start",
+								// every replica fills in its own address
+								fmt.Sprintf("%ssed 's/%s/'\"$VTEP_LOCAL\"'/g' %s/%s > /etc/frr/frr.conf && /sbin/tini -- /usr/lib/frr/docker-start",
+									vtepLocalCommand(frr), frrconf.VTEPLocalPlaceholder, frrConfMountPath, frrConfKey),
 								// `/sbin/tini -- /usr/lib/frr/docker-start &
 								// attempts=0
 								// until [[ -f /var/log/frr/frr.log || $attempts -eq 60 ]]; do
@@ -591,10 +916,75 @@ func newDeployment(frr *frrv1alpha1.Frr, asn, vni int) *appsv1.Deployment {
 							},
 							SecurityContext: frrContainerSecurityContext,
 						},
+						reloaderContainer(frr),
 					},
 					NodeSelector: frr.Spec.NodeSelector.MatchLabels,
 				},
 			},
 		},
 	}
+	if setup := networkSetupContainer(frr, vnis, vrfs); setup != nil {
+		deployment.Spec.Template.Spec.InitContainers = []corev1.Container{*setup}
+	}
+	// frr.conf is left out of the hash, frr-reloader applies a new one to
+	// the running pods
+	hash, err := deploymentSpecHash(&deployment.Spec)
+	if err != nil {
+		return nil, err
+	}
+	deployment.Spec.Template.Annotations = map[string]string{
+		specHashAnnotation: hash,
+	}
+	return deployment, nil
+}
+
+// deploymentSpecHash returns a hash of the spec of a Deployment built by
+// newDeployment, leaving out the replicas so that scaling does not roll the
+// pods.
+func deploymentSpecHash(spec *appsv1.DeploymentSpec) (string, error) {
+	specCopy := spec.DeepCopy()
+	specCopy.Replicas = nil
+	data, err := json.Marshal(specCopy)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash the deployment spec: %v", err)
+	}
+	hasher := fnv.New32a()
+	hasher.Write(data)
+	return rand.SafeEncodeString(fmt.Sprint(hasher.Sum32())), nil
+}
+
+// deploymentNeedsUpdate tells whether the Deployment differs from the
+// desired one built by newDeployment. The pod template is compared through
+// its spec hash, as the API server fills in defaults newDeployment leaves
+// out.
+func deploymentNeedsUpdate(deployment, desired *appsv1.Deployment) bool {
+	if desired.Spec.Replicas != nil &&
+		(deployment.Spec.Replicas == nil || *deployment.Spec.Replicas != *desired.Spec.Replicas) {
+		return true
+	}
+	template := deployment.Spec.Template
+	if template.Annotations[specHashAnnotation] != desired.Spec.Template.Annotations[specHashAnnotation] {
+		return true
+	}
+	// Catch edits of the fields the Frr controls, which leave the hash as is
+	if !equality.Semantic.DeepEqual(template.Labels, desired.Spec.Template.Labels) ||
+		!equality.Semantic.DeepEqual(template.Spec.NodeSelector, desired.Spec.Template.Spec.NodeSelector) {
+		return true
+	}
+	return !containersMatch(template.Spec.InitContainers, desired.Spec.Template.Spec.InitContainers) ||
+		!containersMatch(template.Spec.Containers, desired.Spec.Template.Spec.Containers)
+}
+
+// containersMatch compares the names, images and environment of containers
+func containersMatch(actual, desired []corev1.Container) bool {
+	if len(actual) != len(desired) {
+		return false
+	}
+	for i := range desired {
+		if actual[i].Name != desired[i].Name || actual[i].Image != desired[i].Image ||
+			!equality.Semantic.DeepEqual(actual[i].Env, desired[i].Env) {
+			return false
+		}
+	}
+	return true
 }
@@ -17,25 +17,40 @@ limitations under the License.
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"reflect"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
 	apps "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/util/diff"
+	"k8s.io/apimachinery/pkg/util/wait"
 	kubeinformers "k8s.io/client-go/informers"
 	k8sfake "k8s.io/client-go/kubernetes/fake"
+	batchlisters "k8s.io/client-go/listers/batch/v1"
 	core "k8s.io/client-go/testing"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/record"
 
 	frrcontroller "github.com/guohao117/frr-controller/pkg/apis/frrcontroller/v1alpha1"
+	"github.com/guohao117/frr-controller/pkg/frrconf"
 	"github.com/guohao117/frr-controller/pkg/generated/clientset/versioned/fake"
 	informers "github.com/guohao117/frr-controller/pkg/generated/informers/externalversions"
+	"github.com/guohao117/frr-controller/pkg/metrics"
+	rangemanager "github.com/guohao117/frr-controller/pkg/range_manager"
+	"github.com/guohao117/frr-controller/pkg/utils"
 )
 
 var (
@@ -43,6 +58,13 @@ var (
 	noResyncPeriodFunc = func() time.Duration { return 0 }
 )
 
+const (
+	testMinVNI = 1000
+	testMaxVNI = 2000
+	testMinASN = 65001
+	testMaxASN = 65534
+)
+
 type fixture struct {
 	t *testing.T
 
@@ -51,12 +73,26 @@ type fixture struct {
 	// Objects to put in the store.
 	frrLister        []*frrcontroller.Frr
 	deploymentLister []*apps.Deployment
+	podLister        []*corev1.Pod
+	secretLister     []*corev1.Secret
+	vniPoolLister    []*frrcontroller.VNIPool
+	asnPoolLister    []*frrcontroller.ASNPool
+	jobLister        []*batchv1.Job
+	nodeLister       []*corev1.Node
+	// serviceAccountLister and roleBindingLister hold the reloader access
+	// of the Frrs
+	serviceAccountLister []*corev1.ServiceAccount
+	roleBindingLister    []*rbacv1.RoleBinding
 	// Actions expected to happen on the client.
 	kubeactions []core.Action
 	actions     []core.Action
 	// Objects from here preloaded into NewSimpleFake.
 	kubeobjects []runtime.Object
 	objects     []runtime.Object
+	// Storage the controller persists allocations to, if any.
+	allocationStorage rangemanager.Storage
+	// prepare is called on the controller before it is run, if set.
+	prepare func(c *Controller)
 }
 
 func newFixture(t *testing.T) *fixture {
@@ -71,8 +107,9 @@ func newFrr(name string, replicas *int32) *frrcontroller.Frr {
 	return &frrcontroller.Frr{
 		TypeMeta: metav1.TypeMeta{APIVersion: frrcontroller.SchemeGroupVersion.String()},
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      name,
-			Namespace: metav1.NamespaceDefault,
+			Name:       name,
+			Namespace:  metav1.NamespaceDefault,
+			Finalizers: []string{frrFinalizer},
 		},
 		Spec: frrcontroller.FrrSpec{
 			DeploymentName: fmt.Sprintf("%s-deployment", name),
@@ -89,11 +126,23 @@ func (f *fixture) newController() (*Controller, informers.SharedInformerFactory,
 	k8sI := kubeinformers.NewSharedInformerFactory(f.kubeclient, noResyncPeriodFunc())
 
 	c := NewController(f.kubeclient, f.client,
-		k8sI.Apps().V1().Deployments(), i.Frrcontroller().V1alpha1().Frrs())
+		k8sI.Apps().V1().Deployments(), k8sI.Core().V1().Pods(), k8sI.Core().V1().Secrets(),
+		i.Frrcontroller().V1alpha1().Frrs(),
+		i.Frrcontroller().V1alpha1().VNIPools(), i.Frrcontroller().V1alpha1().ASNPools(),
+		k8sI.Batch().V1().Jobs(), k8sI.Core().V1().Nodes(),
+		k8sI.Core().V1().ServiceAccounts(), k8sI.Rbac().V1().RoleBindings(),
+		testMinVNI, testMaxVNI, testMinASN, testMaxASN, f.allocationStorage)
 
 	c.frrsSynced = alwaysReady
 	c.deploymentsSynced = alwaysReady
+	c.podsSynced = alwaysReady
+	c.secretsSynced = alwaysReady
+	c.jobsSynced = alwaysReady
+	c.nodesSynced = alwaysReady
+	c.serviceAccountsSynced = alwaysReady
+	c.roleBindingsSynced = alwaysReady
 	c.recorder = &record.FakeRecorder{}
+	f.t.Cleanup(c.passwordSecrets.stop)
 
 	for _, f := range f.frrLister {
 		i.Frrcontroller().V1alpha1().Frrs().Informer().GetIndexer().Add(f)
@@ -103,6 +152,42 @@ func (f *fixture) newController() (*Controller, informers.SharedInformerFactory,
 		k8sI.Apps().V1().Deployments().Informer().GetIndexer().Add(d)
 	}
 
+	for _, p := range f.podLister {
+		k8sI.Core().V1().Pods().Informer().GetIndexer().Add(p)
+	}
+
+	for _, s := range f.secretLister {
+		k8sI.Core().V1().Secrets().Informer().GetIndexer().Add(s)
+	}
+
+	for _, j := range f.jobLister {
+		k8sI.Batch().V1().Jobs().Informer().GetIndexer().Add(j)
+	}
+
+	for _, n := range f.nodeLister {
+		k8sI.Core().V1().Nodes().Informer().GetIndexer().Add(n)
+	}
+
+	for _, a := range f.serviceAccountLister {
+		k8sI.Core().V1().ServiceAccounts().Informer().GetIndexer().Add(a)
+	}
+
+	for _, b := range f.roleBindingLister {
+		k8sI.Rbac().V1().RoleBindings().Informer().GetIndexer().Add(b)
+	}
+
+	for _, p := range f.vniPoolLister {
+		i.Frrcontroller().V1alpha1().VNIPools().Informer().GetIndexer().Add(p)
+	}
+
+	for _, p := range f.asnPoolLister {
+		i.Frrcontroller().V1alpha1().ASNPools().Informer().GetIndexer().Add(p)
+	}
+
+	if err := c.initPools(); err != nil {
+		f.t.Fatalf("error building pools: %v", err)
+	}
+
 	return c, i, k8sI
 }
 
@@ -116,6 +201,9 @@ func (f *fixture) runExpectError(frrName string) {
 
 func (f *fixture) runController(frrName string, startInformers bool, expectError bool) {
 	c, i, k8sI := f.newController()
+	if f.prepare != nil {
+		f.prepare(c)
+	}
 	if startInformers {
 		stopCh := make(chan struct{})
 		defer close(stopCh)
@@ -186,13 +274,20 @@ func checkAction(expected, actual core.Action, t *testing.T) {
 		}
 	case core.UpdateActionImpl:
 		e, _ := expected.(core.UpdateActionImpl)
-		expObject := e.GetObject()
-		object := a.GetObject()
+		expObject := withoutTransitionTimes(e.GetObject())
+		object := withoutTransitionTimes(a.GetObject())
 
 		if !reflect.DeepEqual(expObject, object) {
 			t.Errorf("Action %s %s has wrong object\nDiff:\n %s",
 				a.GetVerb(), a.GetResource().Resource, diff.ObjectGoPrintSideBySide(expObject, object))
 		}
+	case core.DeleteActionImpl:
+		e, _ := expected.(core.DeleteActionImpl)
+
+		if e.GetName() != a.GetName() || e.GetNamespace() != a.GetNamespace() {
+			t.Errorf("Action %s %s has wrong object: expected %s/%s, got %s/%s",
+				a.GetVerb(), a.GetResource().Resource, e.GetNamespace(), e.GetName(), a.GetNamespace(), a.GetName())
+		}
 	case core.PatchActionImpl:
 		e, _ := expected.(core.PatchActionImpl)
 		expPatch := e.GetPatch()
@@ -208,17 +303,58 @@ func checkAction(expected, actual core.Action, t *testing.T) {
 	}
 }
 
+// withoutTransitionTimes returns a copy of obj whose condition transition
+// times are cleared, as they are set from the clock by the controller.
+func withoutTransitionTimes(obj runtime.Object) runtime.Object {
+	var conditions []metav1.Condition
+	switch o := obj.(type) {
+	case *frrcontroller.Frr:
+		o = o.DeepCopy()
+		obj, conditions = o, o.Status.Conditions
+	case *frrcontroller.VNIPool:
+		o = o.DeepCopy()
+		obj, conditions = o, o.Status.Conditions
+	case *frrcontroller.ASNPool:
+		o = o.DeepCopy()
+		obj, conditions = o, o.Status.Conditions
+	}
+	for i := range conditions {
+		conditions[i].LastTransitionTime = metav1.Time{}
+	}
+	return obj
+}
+
 // filterInformerActions filters list and watch actions for testing resources.
 // Since list and watch don't change resource state we can filter it to lower
 // nose level in our tests.
 func filterInformerActions(actions []core.Action) []core.Action {
 	ret := []core.Action{}
 	for _, action := range actions {
+		// the password Secrets are watched in their namespace
+		if action.Matches("list", "secrets") || action.Matches("watch", "secrets") {
+			continue
+		}
 		if len(action.GetNamespace()) == 0 &&
 			(action.Matches("list", "frrs") ||
 				action.Matches("watch", "frrs") ||
 				action.Matches("list", "deployments") ||
-				action.Matches("watch", "deployments")) {
+				action.Matches("watch", "deployments") ||
+				action.Matches("list", "pods") ||
+				action.Matches("watch", "pods") ||
+				action.Matches("list", "secrets") ||
+				action.Matches("watch", "secrets") ||
+				action.Matches("list", "vnipools") ||
+				action.Matches("watch", "vnipools") ||
+				action.Matches("list", "asnpools") ||
+				action.Matches("watch", "asnpools") ||
+				action.Matches("list", "jobs") ||
+				action.Matches("watch", "jobs") ||
+				action.Matches("list", "nodes") ||
+				action.Matches("watch", "nodes") ||
+				action.Matches("list", "serviceaccounts") ||
+				action.Matches("watch", "serviceaccounts") ||
+				action.Matches("list", "rolebindings") ||
+				action.Matches("watch", "rolebindings")) {
 			continue
 		}
 		ret = append(ret, action)
@@ -235,11 +371,135 @@ func (f *fixture) expectUpdateDeploymentAction(d *apps.Deployment) {
 	f.kubeactions = append(f.kubeactions, core.NewUpdateAction(schema.GroupVersionResource{Resource: "deployments"}, d.Namespace, d))
 }
 
+func (f *fixture) expectCreateConfigSecretAction(frr *frrcontroller.Frr, asn int) {
+	f.expectCreateConfigSecretActionFor(frr, asn, nil, nil)
+}
+
+// expectCreateConfigSecretActionFor expects the Secret of a Frr listing
+// L2VNIs or VRFs, which frr.conf refers to
+func (f *fixture) expectCreateConfigSecretActionFor(frr *frrcontroller.Frr, asn int, vnis []l2vni, vrfs []l3vni) {
+	config, err := renderConfig(frr, asn, vnis, vrfs, nil)
+	if err != nil {
+		f.t.Fatalf("error rendering frr.conf: %v", err)
+	}
+	f.kubeactions = append(f.kubeactions, core.NewCreateAction(schema.GroupVersionResource{Resource: "secrets"}, frr.Namespace, newConfigSecret(frr, config)))
+}
+
+// expectCreateReloaderAccessActions expects the service account the pods of
+// a Frr run as and its RoleBinding
+func (f *fixture) expectCreateReloaderAccessActions(frr *frrcontroller.Frr) {
+	sa := newReloaderServiceAccount(frr)
+	rb := newReloaderRoleBinding(frr)
+	f.kubeactions = append(f.kubeactions, core.NewCreateAction(schema.GroupVersionResource{Resource: "serviceaccounts"}, sa.Namespace, sa))
+	f.kubeactions = append(f.kubeactions, core.NewCreateAction(schema.GroupVersionResource{Resource: "rolebindings"}, rb.Namespace, rb))
+}
+
+// addReloaderAccess adds the service account and RoleBinding of a Frr
+// to the fixture, as a previous sync created them
+func (f *fixture) addReloaderAccess(frr *frrcontroller.Frr) {
+	f.serviceAccountLister = append(f.serviceAccountLister, newReloaderServiceAccount(frr))
+	f.roleBindingLister = append(f.roleBindingLister, newReloaderRoleBinding(frr))
+	f.kubeobjects = append(f.kubeobjects, newReloaderServiceAccount(frr), newReloaderRoleBinding(frr))
+}
+
+func (f *fixture) expectDeleteDeploymentAction(d *apps.Deployment) {
+	f.kubeactions = append(f.kubeactions, core.NewDeleteAction(schema.GroupVersionResource{Resource: "deployments"}, d.Namespace, d.Name))
+}
+
+func (f *fixture) expectUpdateFrrAction(frr *frrcontroller.Frr) {
+	f.actions = append(f.actions, core.NewUpdateAction(schema.GroupVersionResource{Resource: "frrs"}, frr.Namespace, frr))
+}
+
 func (f *fixture) expectUpdateFrrStatusAction(frr *frrcontroller.Frr) {
 	action := core.NewUpdateSubresourceAction(schema.GroupVersionResource{Resource: "frrs"}, "status", frr.Namespace, frr)
 	f.actions = append(f.actions, action)
 }
 
+// allocatedFrr returns the Frr as updateFrrStatus reports it when it holds
+// the given numbers of the default pools. Numbers set in the spec are
+// reported as chosen by the user.
+func allocatedFrr(frr *frrcontroller.Frr, asn, vni int) *frrcontroller.Frr {
+	frr = frr.DeepCopy()
+	frr.Status.ASNumber = asn
+	frr.Status.ASNumberAllocation = frrcontroller.NumberAllocation{AllocationSource: frrcontroller.AllocationSourcePool, Pool: defaultPool}
+	if frr.Spec.ASNumber != 0 {
+		frr.Status.ASNumberAllocation.AllocationSource = frrcontroller.AllocationSourceUser
+	}
+	frr.Status.VNI = vni
+	frr.Status.VNIAllocation = frrcontroller.NumberAllocation{AllocationSource: frrcontroller.AllocationSourcePool, Pool: defaultPool}
+	if frr.Spec.VNI != 0 {
+		frr.Status.VNIAllocation.AllocationSource = frrcontroller.AllocationSourceUser
+	}
+	frr.Status.ObservedGeneration = frr.Generation
+	// The Deployments of the tests never roll out and no frr-reloader
+	// reports a configuration
+	frr.Status.Conditions = []metav1.Condition{{
+		Type:    frrcontroller.FrrConditionAllocated,
+		Status:  metav1.ConditionTrue,
+		Reason:  ReasonAllocated,
+		Message: fmt.Sprintf("AS number %d, VNI %d", asn, vni),
+	}, {
+		Type:    frrcontroller.FrrConditionDeploymentReady,
+		Status:  metav1.ConditionFalse,
+		Reason:  ReasonReplicasUnavailable,
+		Message: fmt.Sprintf("0 of %d replicas available", *frr.Spec.Replicas),
+	}, {
+		Type:    frrcontroller.FrrConditionConfigRendered,
+		Status:  metav1.ConditionFalse,
+		Reason:  ReasonReloadInProgress,
+		Message: fmt.Sprintf("0 of %d replicas run the current configuration", *frr.Spec.Replicas),
+	}, {
+		Type:   frrcontroller.FrrConditionDegraded,
+		Status: metav1.ConditionFalse,
+		Reason: ReasonAsExpected,
+	}, {
+		Type:    frrcontroller.FrrConditionReady,
+		Status:  metav1.ConditionFalse,
+		Reason:  ReasonNotReady,
+		Message: "Waiting for DeploymentReady, ConfigRendered",
+	}}
+	return frr
+}
+
+// allocationFailedFrr returns the Frr as reported when its numbers cannot
+// be allocated.
+func allocationFailedFrr(frr *frrcontroller.Frr, reason, message string) *frrcontroller.Frr {
+	frr = frr.DeepCopy()
+	frr.Status.ObservedGeneration = frr.Generation
+	frr.Status.Conditions = []metav1.Condition{{
+		Type:    frrcontroller.FrrConditionAllocated,
+		Status:  metav1.ConditionFalse,
+		Reason:  reason,
+		Message: message,
+	}, {
+		Type:    frrcontroller.FrrConditionDegraded,
+		Status:  metav1.ConditionTrue,
+		Reason:  reason,
+		Message: message,
+	}, {
+		Type:    frrcontroller.FrrConditionReady,
+		Status:  metav1.ConditionFalse,
+		Reason:  ReasonNotReady,
+		Message: "Waiting for Allocated, DeploymentReady, ConfigRendered, not Degraded",
+	}}
+	return frr
+}
+
+// specVNI returns the single L2VNI of a Frr which lists no spec.vnis
+func specVNI(vni int) []l2vni {
+	return []l2vni{{numberAllocation: numberAllocation{number: vni}}}
+}
+
+// mustNewDeployment returns the Deployment newDeployment builds, failing the
+// test if it cannot
+func mustNewDeployment(t *testing.T, frr *frrcontroller.Frr, asn int, vnis []l2vni, vrfs []l3vni) *apps.Deployment {
+	d, err := newDeployment(frr, asn, vnis, vrfs)
+	if err != nil {
+		t.Fatalf("error building deployment: %v", err)
+	}
+	return d
+}
+
 func getKey(frr *frrcontroller.Frr, t *testing.T) string {
 	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(frr)
 	if err != nil {
@@ -256,9 +516,143 @@ func TestCreatesDeployment(t *testing.T) {
 	f.frrLister = append(f.frrLister, frr)
 	f.objects = append(f.objects, frr)
 
-	expDeployment := newDeployment(frr)
+	expDeployment := mustNewDeployment(t, frr, testMinASN, specVNI(testMinVNI), nil)
+	f.expectCreateConfigSecretAction(frr, testMinASN)
+	f.expectCreateReloaderAccessActions(frr)
+	f.expectCreateDeploymentAction(expDeployment)
+	f.expectUpdateFrrStatusAction(allocatedFrr(frr, testMinASN, testMinVNI))
+
+	f.run(getKey(frr, t))
+}
+
+func TestCreatesDeploymentWithVNIs(t *testing.T) {
+	f := newFixture(t)
+	frr := newFrr("test", int32Ptr(1))
+	frr.Spec.VNIs = []frrcontroller.L2VNI{
+		{Name: "blue", LogicalSwitch: "ls-blue"},
+		{Name: "red", ID: testMinVNI + 10, BridgeName: "br-red"},
+	}
+
+	f.frrLister = append(f.frrLister, frr)
+	f.objects = append(f.objects, frr)
+
+	vnis := specL2VNIs(frr)
+	vnis[0].numberAllocation = numberAllocation{testMinVNI, frrcontroller.AllocationSourcePool, defaultPool}
+	vnis[1].numberAllocation = numberAllocation{testMinVNI + 10, frrcontroller.AllocationSourceUser, defaultPool}
+	expDeployment := mustNewDeployment(t, frr, testMinASN, vnis, nil)
+	if value, _ := deploymentEnv(expDeployment, vnisEnv); value != "blue:1000:br-vx1000:ls-blue red:1010:br-red:" {
+		t.Errorf("unexpected %s: %q", vnisEnv, value)
+	}
+	if _, ok := deploymentEnv(expDeployment, "VNI"); ok {
+		t.Errorf("expected no VNI env on a Frr listing spec.vnis")
+	}
+	f.expectCreateConfigSecretActionFor(frr, testMinASN, vnis, nil)
+	f.expectCreateReloaderAccessActions(frr)
+	f.expectCreateDeploymentAction(expDeployment)
+	expFrr := allocatedFrr(frr, testMinASN, testMinVNI)
+	expFrr.Status.VNIs = []frrcontroller.L2VNIStatus{
+		{Name: "blue", VNI: testMinVNI, BridgeName: "br-vx1000", LogicalSwitch: "ls-blue", Allocation: vnis[0].status()},
+		{Name: "red", VNI: testMinVNI + 10, BridgeName: "br-red", Allocation: vnis[1].status()},
+	}
+	expFrr.Status.Conditions[0].Message = fmt.Sprintf("AS number %d, VNIs %d, %d", testMinASN, testMinVNI, testMinVNI+10)
+	f.expectUpdateFrrStatusAction(expFrr)
+
+	f.run(getKey(frr, t))
+}
+
+func TestReleasesRemovedVNIs(t *testing.T) {
+	f := newFixture(t)
+	frr := newFrr("test", int32Ptr(1))
+	frr.Spec.VNIs = []frrcontroller.L2VNI{{Name: "blue", ID: testMinVNI + 1}}
+
+	f.frrLister = append(f.frrLister, frr)
+	f.objects = append(f.objects, frr)
+
+	var c *Controller
+	f.prepare = func(controller *Controller) {
+		c = controller
+		// The single VNI held before spec.vnis was set, and a L2VNI since
+		// removed from the list
+		defaultPoolManager(c, vniPoolKind).Reserve(getKey(frr, t), testMinVNI)
+		defaultPoolManager(c, vniPoolKind).Reserve(getKey(frr, t)+"/old", testMinVNI+2)
+	}
+	vnis := specL2VNIs(frr)
+	vnis[0].numberAllocation = numberAllocation{testMinVNI + 1, frrcontroller.AllocationSourceUser, defaultPool}
+	f.expectCreateConfigSecretActionFor(frr, testMinASN, vnis, nil)
+	f.expectCreateReloaderAccessActions(frr)
+	f.expectCreateDeploymentAction(mustNewDeployment(t, frr, testMinASN, vnis, nil))
+	expFrr := allocatedFrr(frr, testMinASN, testMinVNI+1)
+	expFrr.Status.VNIAllocation = vnis[0].status()
+	expFrr.Status.VNIs = []frrcontroller.L2VNIStatus{vnis[0].l2vniStatus()}
+	f.expectUpdateFrrStatusAction(expFrr)
+	f.run(getKey(frr, t))
+
+	held := defaultPoolManager(c, vniPoolKind).Held(getKey(frr, t))
+	if len(held) != 1 || held[getKey(frr, t)+"/blue"] != testMinVNI+1 {
+		t.Errorf("expected the frr to hold only VNI %d of blue, got %v", testMinVNI+1, held)
+	}
+}
+
+func TestCreatesDeploymentWithVRFs(t *testing.T) {
+	f := newFixture(t)
+	frr := newFrr("test", int32Ptr(1))
+	frr.Spec.VRFs = []frrcontroller.VRF{
+		{Name: "tenant-a", AdvertisedPrefixes: []string{"10.10.0.0/24"}},
+		{Name: "tenant-b", L3VNI: testMinVNI + 20, RouterMAC: "02:00:00:00:00:01"},
+	}
+
+	f.frrLister = append(f.frrLister, frr)
+	f.objects = append(f.objects, frr)
+
+	// The L3VNIs come from the VNI pool, after the L2VNI
+	vrfs := specL3VNIs(frr)
+	vrfs[0].numberAllocation = numberAllocation{testMinVNI + 1, frrcontroller.AllocationSourcePool, defaultPool}
+	vrfs[1].numberAllocation = numberAllocation{testMinVNI + 20, frrcontroller.AllocationSourceUser, defaultPool}
+	expDeployment := mustNewDeployment(t, frr, testMinASN, specVNI(testMinVNI), vrfs)
+	if value, _ := deploymentEnv(expDeployment, vrfsEnv); value != "tenant-a:1001: tenant-b:1020:02:00:00:00:00:01" {
+		t.Errorf("unexpected %s: %q", vrfsEnv, value)
+	}
+	f.expectCreateConfigSecretActionFor(frr, testMinASN, nil, vrfs)
+	f.expectCreateReloaderAccessActions(frr)
 	f.expectCreateDeploymentAction(expDeployment)
-	f.expectUpdateFrrStatusAction(frr)
+	expFrr := allocatedFrr(frr, testMinASN, testMinVNI)
+	expFrr.Status.VRFs = []frrcontroller.VRFStatus{vrfs[0].vrfStatus(), vrfs[1].vrfStatus()}
+	expFrr.Status.Conditions[0].Message = fmt.Sprintf("AS number %d, VNI %d, L3VNIs %d, %d", testMinASN, testMinVNI, testMinVNI+1, testMinVNI+20)
+	f.expectUpdateFrrStatusAction(expFrr)
+
+	f.run(getKey(frr, t))
+}
+
+func TestDerivesRouteTargets(t *testing.T) {
+	f := newFixture(t)
+	frr := newFrr("test", int32Ptr(1))
+	frr.Spec.RouteTargetDerivation = frrcontroller.RouteTargetDerivationController
+	frr.Spec.VNIs = []frrcontroller.L2VNI{
+		{Name: "blue"},
+		{Name: "red", EVPNRouting: frrcontroller.EVPNRouting{RD: "65001:7", ExportRTs: []string{"65100:7"}}},
+	}
+	frr.Spec.VRFs = []frrcontroller.VRF{{Name: "tenant-a"}}
+
+	f.frrLister = append(f.frrLister, frr)
+	f.objects = append(f.objects, frr)
+
+	// Only the route targets left empty are derived, as AS:VNI
+	vnis := specL2VNIs(frr)
+	vnis[0].numberAllocation = numberAllocation{testMinVNI, frrcontroller.AllocationSourcePool, defaultPool}
+	vnis[0].routing = frrcontroller.EVPNRouting{ImportRTs: []string{"65001:1000"}, ExportRTs: []string{"65001:1000"}}
+	vnis[1].numberAllocation = numberAllocation{testMinVNI + 1, frrcontroller.AllocationSourcePool, defaultPool}
+	vnis[1].routing = frrcontroller.EVPNRouting{RD: "65001:7", ImportRTs: []string{"65001:1001"}, ExportRTs: []string{"65100:7"}}
+	vrfs := specL3VNIs(frr)
+	vrfs[0].numberAllocation = numberAllocation{testMinVNI + 2, frrcontroller.AllocationSourcePool, defaultPool}
+	vrfs[0].routing = frrcontroller.EVPNRouting{ImportRTs: []string{"65001:1002"}, ExportRTs: []string{"65001:1002"}}
+	f.expectCreateConfigSecretActionFor(frr, testMinASN, vnis, vrfs)
+	f.expectCreateReloaderAccessActions(frr)
+	f.expectCreateDeploymentAction(mustNewDeployment(t, frr, testMinASN, vnis, vrfs))
+	expFrr := allocatedFrr(frr, testMinASN, testMinVNI)
+	expFrr.Status.VNIs = []frrcontroller.L2VNIStatus{vnis[0].l2vniStatus(), vnis[1].l2vniStatus()}
+	expFrr.Status.VRFs = []frrcontroller.VRFStatus{vrfs[0].vrfStatus()}
+	expFrr.Status.Conditions[0].Message = fmt.Sprintf("AS number %d, VNIs %d, %d, L3VNIs %d", testMinASN, testMinVNI, testMinVNI+1, testMinVNI+2)
+	f.expectUpdateFrrStatusAction(expFrr)
 
 	f.run(getKey(frr, t))
 }
@@ -266,49 +660,1934 @@ func TestCreatesDeployment(t *testing.T) {
 func TestDoNothing(t *testing.T) {
 	f := newFixture(t)
 	frr := newFrr("test", int32Ptr(1))
-	d := newDeployment(frr)
+	d := mustNewDeployment(t, frr, testMinASN, specVNI(testMinVNI), nil)
 
 	f.frrLister = append(f.frrLister, frr)
 	f.objects = append(f.objects, frr)
 	f.deploymentLister = append(f.deploymentLister, d)
 	f.kubeobjects = append(f.kubeobjects, d)
 
-	f.expectUpdateFrrStatusAction(frr)
+	f.expectCreateConfigSecretAction(frr, testMinASN)
+	f.expectCreateReloaderAccessActions(frr)
+	f.expectUpdateFrrStatusAction(allocatedFrr(frr, testMinASN, testMinVNI))
 	f.run(getKey(frr, t))
 }
 
-func TestUpdateDeployment(t *testing.T) {
+func TestSyncedEventOnlyOnChange(t *testing.T) {
 	f := newFixture(t)
 	frr := newFrr("test", int32Ptr(1))
-	d := newDeployment(frr)
+	d := mustNewDeployment(t, frr, testMinASN, specVNI(testMinVNI), nil)
 
-	// Update replicas
-	frr.Spec.Replicas = int32Ptr(2)
-	expDeployment := newDeployment(frr)
+	f.frrLister = append(f.frrLister, frr)
+	f.objects = append(f.objects, frr)
+	f.deploymentLister = append(f.deploymentLister, d)
+	f.kubeobjects = append(f.kubeobjects, d)
+
+	c, i, k8sI := f.newController()
+	recorder := record.NewFakeRecorder(10)
+	c.recorder = recorder
+	if err := c.syncHandler(getKey(frr, t)); err != nil {
+		t.Fatalf("error syncing frr: %v", err)
+	}
+	select {
+	case event := <-recorder.Events:
+		if !strings.Contains(event, SuccessSynced) {
+			t.Errorf("expected a %s event, got %q", SuccessSynced, event)
+		}
+	default:
+		t.Errorf("expected a %s event", SuccessSynced)
+	}
+
+	// The caches catch up with the first sync, the second one changes nothing
+	updated, err := f.client.FrrcontrollerV1alpha1().Frrs(frr.Namespace).Get(context.TODO(), frr.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	i.Frrcontroller().V1alpha1().Frrs().Informer().GetIndexer().Update(updated)
+	secret, err := f.kubeclient.CoreV1().Secrets(frr.Namespace).Get(context.TODO(), configSecretName(frr), metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	k8sI.Core().V1().Secrets().Informer().GetIndexer().Add(secret)
+	k8sI.Core().V1().ServiceAccounts().Informer().GetIndexer().Add(newReloaderServiceAccount(frr))
+	k8sI.Rbac().V1().RoleBindings().Informer().GetIndexer().Add(newReloaderRoleBinding(frr))
+	if err := c.syncHandler(getKey(frr, t)); err != nil {
+		t.Fatalf("error syncing frr: %v", err)
+	}
+	select {
+	case event := <-recorder.Events:
+		t.Errorf("expected no event, got %q", event)
+	default:
+	}
+}
+
+func TestFrrReady(t *testing.T) {
+	f := newFixture(t)
+	frr := newFrr("test", int32Ptr(1))
+	frr.Generation = 3
+	d := mustNewDeployment(t, frr, testMinASN, specVNI(testMinVNI), nil)
+	d.Status.AvailableReplicas = 1
+	d.Status.UpdatedReplicas = 1
+	hash := configHash(t, frr, testMinASN)
 
 	f.frrLister = append(f.frrLister, frr)
 	f.objects = append(f.objects, frr)
 	f.deploymentLister = append(f.deploymentLister, d)
 	f.kubeobjects = append(f.kubeobjects, d)
+	f.podLister = append(f.podLister, withConfigStatus(newPod(frr, "test-a", "node1", "10.0.0.1", corev1.ConditionTrue), hash, ""))
 
-	f.expectUpdateFrrStatusAction(frr)
-	f.expectUpdateDeploymentAction(expDeployment)
+	ready := allocatedFrr(frr, testMinASN, testMinVNI)
+	ready.Status.AvailableReplicas = 1
+	ready.Status.Nodes = "node1"
+	ready.Status.Pods = []frrcontroller.FrrPodStatus{
+		{Name: "test-a", Node: "node1", VTEPAddress: "10.0.0.1", Phase: corev1.PodRunning, Ready: true, ConfigHash: hash},
+	}
+	ready.Status.Conditions[1].Status = metav1.ConditionTrue
+	ready.Status.Conditions[1].Reason = ReasonReplicasAvailable
+	ready.Status.Conditions[1].Message = "1 of 1 replicas available"
+	ready.Status.Conditions[2].Status = metav1.ConditionTrue
+	ready.Status.Conditions[2].Reason = ReasonConfigApplied
+	ready.Status.Conditions[2].Message = "1 of 1 replicas run the current configuration"
+	ready.Status.Conditions[4].Status = metav1.ConditionTrue
+	ready.Status.Conditions[4].Reason = ReasonReady
+	ready.Status.Conditions[4].Message = ""
+	for i := range ready.Status.Conditions {
+		ready.Status.Conditions[i].ObservedGeneration = 3
+	}
+	f.expectCreateConfigSecretAction(frr, testMinASN)
+	f.expectCreateReloaderAccessActions(frr)
+	f.expectUpdateFrrStatusAction(ready)
 	f.run(getKey(frr, t))
 }
 
-func TestNotControlledByUs(t *testing.T) {
+func TestDeploymentConditionsDegraded(t *testing.T) {
+	frr := newFrr("test", int32Ptr(1))
+	d := mustNewDeployment(t, frr, testMinASN, specVNI(testMinVNI), nil)
+	d.Status.Conditions = []apps.DeploymentCondition{{
+		Type:    apps.DeploymentProgressing,
+		Status:  corev1.ConditionFalse,
+		Reason:  "ProgressDeadlineExceeded",
+		Message: "deployment exceeded its progress deadline",
+	}}
+
+	conditions := deploymentConditions(d, nil, "")
+	degraded := conditions[len(conditions)-1]
+	if degraded.Type != frrcontroller.FrrConditionDegraded || degraded.Status != metav1.ConditionTrue {
+		t.Fatalf("expected Degraded to be true, got %+v", degraded)
+	}
+	if degraded.Reason != "ProgressDeadlineExceeded" {
+		t.Errorf("expected the reason of the Deployment, got %q", degraded.Reason)
+	}
+
+	setFrrConditions(frr, conditions...)
+	if cond := meta.FindStatusCondition(frr.Status.Conditions, frrcontroller.FrrConditionReady); cond == nil || cond.Status != metav1.ConditionFalse {
+		t.Errorf("expected a degraded frr not to be Ready, got %+v", cond)
+	}
+}
+
+func newPod(frr *frrcontroller.Frr, name, node, ip string, ready corev1.ConditionStatus) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: frr.Namespace,
+			Labels:    podLabels(frr),
+		},
+		Spec: corev1.PodSpec{NodeName: node},
+		Status: corev1.PodStatus{
+			Phase:      corev1.PodRunning,
+			PodIP:      ip,
+			Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: ready}},
+		},
+	}
+}
+
+// withConfigStatus annotates a pod with the frr.conf its frr-reloader applied
+func withConfigStatus(pod *corev1.Pod, hash, configError string) *corev1.Pod {
+	value, _ := json.Marshal(utils.FrrConfigStatus{Hash: hash, Error: configError})
+	pod.Annotations = map[string]string{utils.FrrConfigAnnotation: string(value)}
+	return pod
+}
+
+// configHash returns the hash of frr.conf of a Frr holding the given AS
+// number
+func configHash(t *testing.T, frr *frrcontroller.Frr, asn int) string {
+	config, err := renderConfig(frr, asn, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("error rendering frr.conf: %v", err)
+	}
+	return frrconf.Hash(config)
+}
+
+func TestFrrReloadFailed(t *testing.T) {
+	f := newFixture(t)
+	frr := newFrr("test", int32Ptr(2))
+	d := mustNewDeployment(t, frr, testMinASN, specVNI(testMinVNI), nil)
+	hash := configHash(t, frr, testMinASN)
+
+	f.frrLister = append(f.frrLister, frr)
+	f.objects = append(f.objects, frr)
+	f.deploymentLister = append(f.deploymentLister, d)
+	f.kubeobjects = append(f.kubeobjects, d)
+	// test-b failed to apply a previous configuration, which does not count
+	f.podLister = append(f.podLister,
+		withConfigStatus(newPod(frr, "test-a", "node1", "10.0.0.1", corev1.ConditionTrue), hash, "reload failed"),
+		withConfigStatus(newPod(frr, "test-b", "node2", "10.0.0.2", corev1.ConditionTrue), "previous", "invalid configuration"))
+
+	expFrr := allocatedFrr(frr, testMinASN, testMinVNI)
+	expFrr.Status.Nodes = "node1,node2"
+	expFrr.Status.Pods = []frrcontroller.FrrPodStatus{
+		{Name: "test-a", Node: "node1", VTEPAddress: "10.0.0.1", Phase: corev1.PodRunning, Ready: true, ConfigHash: hash, ConfigError: "reload failed"},
+		{Name: "test-b", Node: "node2", VTEPAddress: "10.0.0.2", Phase: corev1.PodRunning, Ready: true, ConfigHash: "previous", ConfigError: "invalid configuration"},
+	}
+	expFrr.Status.Conditions[2].Reason = ReasonReloadFailed
+	expFrr.Status.Conditions[2].Message = "test-a: reload failed"
+	expFrr.Status.Conditions[3].Status = metav1.ConditionTrue
+	expFrr.Status.Conditions[3].Reason = ReasonReloadFailed
+	expFrr.Status.Conditions[3].Message = "test-a: reload failed"
+	expFrr.Status.Conditions[4].Message = "Waiting for DeploymentReady, ConfigRendered, not Degraded"
+	f.expectCreateConfigSecretAction(frr, testMinASN)
+	f.expectCreateReloaderAccessActions(frr)
+	f.expectUpdateFrrStatusAction(expFrr)
+	f.run(getKey(frr, t))
+}
+
+func TestFrrNetworkSetupFailed(t *testing.T) {
 	f := newFixture(t)
 	frr := newFrr("test", int32Ptr(1))
-	d := newDeployment(frr)
+	frr.Spec.LogicalSwitch = "ls1"
+	d := mustNewDeployment(t, frr, testMinASN, []l2vni{{logicalSwitch: "ls1", numberAllocation: numberAllocation{number: testMinVNI}}}, nil)
 
-	d.ObjectMeta.OwnerReferences = []metav1.OwnerReference{}
+	f.frrLister = append(f.frrLister, frr)
+	f.objects = append(f.objects, frr)
+	f.deploymentLister = append(f.deploymentLister, d)
+	f.kubeobjects = append(f.kubeobjects, d)
+	// connect-frr failed and waits to be restarted
+	pod := newPod(frr, "test-a", "node1", "10.0.0.1", corev1.ConditionFalse)
+	pod.Status.Phase = corev1.PodPending
+	pod.Status.InitContainerStatuses = []corev1.ContainerStatus{{
+		Name: networkSetupContainerName,
+		State: corev1.ContainerState{
+			Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"},
+		},
+		LastTerminationState: corev1.ContainerState{
+			Terminated: &corev1.ContainerStateTerminated{ExitCode: 1, Message: "ovs-vsctl: unix:/var/run/openvswitch/db.sock: database connection failed\n"},
+		},
+	}}
+	f.podLister = append(f.podLister, pod)
+
+	msg := "connect-frr exited with 1: ovs-vsctl: unix:/var/run/openvswitch/db.sock: database connection failed"
+	expFrr := allocatedFrr(frr, testMinASN, testMinVNI)
+	expFrr.Status.Nodes = "node1"
+	expFrr.Status.Pods = []frrcontroller.FrrPodStatus{
+		{Name: "test-a", Node: "node1", VTEPAddress: "10.0.0.1", Phase: corev1.PodPending, NetworkError: msg},
+	}
+	expFrr.Status.Conditions[3].Status = metav1.ConditionTrue
+	expFrr.Status.Conditions[3].Reason = ReasonNetworkSetupFailed
+	expFrr.Status.Conditions[3].Message = "test-a: " + msg
+	expFrr.Status.Conditions[4].Message = "Waiting for DeploymentReady, ConfigRendered, not Degraded"
+	f.expectCreateConfigSecretAction(frr, testMinASN)
+	f.expectCreateReloaderAccessActions(frr)
+	f.expectUpdateFrrStatusAction(expFrr)
+	f.run(getKey(frr, t))
+}
+
+func TestNetworkSetupContainer(t *testing.T) {
+	frr := newFrr("test", int32Ptr(1))
+	if d := mustNewDeployment(t, frr, testMinASN, specVNI(testMinVNI), nil); len(d.Spec.Template.Spec.InitContainers) != 0 {
+		t.Errorf("expected no init container without a logical switch, got %v", d.Spec.Template.Spec.InitContainers)
+	}
+
+	frr.Spec.LogicalSwitch = "ls1"
+	vnis := specL2VNIs(frr)
+	vnis[0].number = testMinVNI
+	d := mustNewDeployment(t, frr, testMinASN, vnis, nil)
+	if len(d.Spec.Template.Spec.InitContainers) != 1 {
+		t.Fatalf("expected the %s init container, got %v", networkSetupContainerName, d.Spec.Template.Spec.InitContainers)
+	}
+	setup := d.Spec.Template.Spec.InitContainers[0]
+	if setup.Name != networkSetupContainerName || setup.Image != defaultNetworkSetupImage {
+		t.Errorf("unexpected init container %s, image %s", setup.Name, setup.Image)
+	}
+	expected := []corev1.EnvVar{
+		{Name: "VNI", Value: "1000"},
+		{Name: "SUBNET", Value: "ls1"},
+		fieldEnv("VTEP_LOCAL", "status.podIP"),
+	}
+	if !reflect.DeepEqual(setup.Env, expected) {
+		t.Errorf("expected env %v, got %v", expected, setup.Env)
+	}
+
+	// The L2VNIs and VRFs of the lists are all set up, along with the one
+	// bridged to a logical switch
+	frr.Spec.LogicalSwitch = ""
+	frr.Spec.NetworkSetupImage = "connect-frr:test"
+	frr.Spec.VNIs = []frrcontroller.L2VNI{{Name: "blue", LogicalSwitch: "ls-blue"}, {Name: "red"}}
+	frr.Spec.VRFs = []frrcontroller.VRF{{Name: "tenant-a"}}
+	vnis = specL2VNIs(frr)
+	vnis[0].number = testMinVNI
+	vnis[1].number = testMinVNI + 1
+	vrfs := specL3VNIs(frr)
+	vrfs[0].number = testMinVNI + 2
+	d = mustNewDeployment(t, frr, testMinASN, vnis, vrfs)
+	if len(d.Spec.Template.Spec.InitContainers) != 1 {
+		t.Fatalf("expected the %s init container, got %v", networkSetupContainerName, d.Spec.Template.Spec.InitContainers)
+	}
+	setup = d.Spec.Template.Spec.InitContainers[0]
+	expected = []corev1.EnvVar{
+		{Name: vnisEnv, Value: "blue:1000:br-vx1000:ls-blue red:1001:br-vx1001:"},
+		{Name: vrfsEnv, Value: "tenant-a:1002:"},
+		fieldEnv("VTEP_LOCAL", "status.podIP"),
+	}
+	if setup.Image != "connect-frr:test" || !reflect.DeepEqual(setup.Env, expected) {
+		t.Errorf("expected image connect-frr:test and env %v, got %s and %v", expected, setup.Image, setup.Env)
+	}
+}
+
+// containerEnv returns the variable of a container of the pods of a
+// Deployment, if it is set
+func containerEnv(d *apps.Deployment, container, name string) (corev1.EnvVar, bool) {
+	spec := d.Spec.Template.Spec
+	for _, c := range append(spec.InitContainers, spec.Containers...) {
+		if c.Name != container {
+			continue
+		}
+		for _, env := range c.Env {
+			if env.Name == name {
+				return env, true
+			}
+		}
+	}
+	return corev1.EnvVar{}, false
+}
+
+func TestVXLANParameters(t *testing.T) {
+	frr := newFrr("test", int32Ptr(1))
+	frr.Spec.LogicalSwitch = "ls1"
+	vnis := specL2VNIs(frr)
+	vnis[0].number = testMinVNI
+	defaults := mustNewDeployment(t, frr, testMinASN, vnis, nil)
+
+	// the defaults leave the pods as they were
+	frr.Spec.VXLAN = &frrcontroller.VXLAN{DstPort: 4789, LocalAddressSource: frrcontroller.VXLANLocalAddressPodIP}
+	if d := mustNewDeployment(t, frr, testMinASN, vnis, nil); !reflect.DeepEqual(d, defaults) {
+		t.Errorf("expected the default parameters to leave the Deployment unchanged")
+	}
+
+	frr.Spec.VXLAN = &frrcontroller.VXLAN{
+		DstPort:            4790,
+		MTU:                1450,
+		Learning:           true,
+		TTL:                16,
+		LocalAddressSource: frrcontroller.VXLANLocalAddressNodeInternalIP,
+	}
+	d := mustNewDeployment(t, frr, testMinASN, vnis, nil)
+	expected := []string{"-vxlan_port=4790", "-vxlan_mtu=1450", "-vxlan_learning", "-vxlan_ttl=16"}
+	if args := d.Spec.Template.Spec.InitContainers[0].Args; !reflect.DeepEqual(args, expected) {
+		t.Errorf("expected args %v, got %v", expected, args)
+	}
+	for _, container := range []string{networkSetupContainerName, "frr", "frr-reloader"} {
+		if env, _ := containerEnv(d, container, "VTEP_LOCAL"); !reflect.DeepEqual(env, fieldEnv("VTEP_LOCAL", "status.hostIP")) {
+			t.Errorf("%s: expected VTEP_LOCAL from status.hostIP, got %v", container, env)
+		}
+	}
+	if d.Spec.Template.Annotations[specHashAnnotation] == defaults.Spec.Template.Annotations[specHashAnnotation] {
+		t.Errorf("expected the parameters to roll the pods")
+	}
+
+	// the frr container reads the address of the interface before filling
+	// in frr.conf
+	frr.Spec.VXLAN = &frrcontroller.VXLAN{LocalAddressSource: frrcontroller.VXLANLocalAddressInterface, LocalInterface: "eth1"}
+	d = mustNewDeployment(t, frr, testMinASN, vnis, nil)
+	for _, container := range []string{networkSetupContainerName, "frr", "frr-reloader"} {
+		if _, ok := containerEnv(d, container, "VTEP_LOCAL"); ok {
+			t.Errorf("%s: expected no VTEP_LOCAL", container)
+		}
+		if env, _ := containerEnv(d, container, "VTEP_INTERFACE"); env.Value != "eth1" {
+			t.Errorf("%s: expected VTEP_INTERFACE eth1, got %v", container, env)
+		}
+	}
+	if command := d.Spec.Template.Spec.Containers[0].Args[1]; !strings.HasPrefix(command, "VTEP_LOCAL=$(ip -4 -o addr show dev \"$VTEP_INTERFACE\"") {
+		t.Errorf("unexpected command %s", command)
+	}
+}
+
+func TestVXLANParametersWithoutLogicalSwitch(t *testing.T) {
+	frr := newFrr("test", int32Ptr(1))
+	frr.Spec.VNIs = []frrcontroller.L2VNI{{Name: "blue"}}
+	vnis := specL2VNIs(frr)
+	vnis[0].number = testMinVNI
+
+	// no L2VNI is bridged, connect-frr only runs for the parameters
+	frr.Spec.VXLAN = &frrcontroller.VXLAN{DstPort: 4789, LocalAddressSource: frrcontroller.VXLANLocalAddressPodIP}
+	if d := mustNewDeployment(t, frr, testMinASN, vnis, nil); len(d.Spec.Template.Spec.InitContainers) != 0 {
+		t.Errorf("expected no %s init container, got %v", networkSetupContainerName, d.Spec.Template.Spec.InitContainers)
+	}
+
+	frr.Spec.VXLAN = &frrcontroller.VXLAN{DstPort: 4790, MTU: 1450}
+	d := mustNewDeployment(t, frr, testMinASN, vnis, nil)
+	if len(d.Spec.Template.Spec.InitContainers) != 1 || d.Spec.Template.Spec.InitContainers[0].Name != networkSetupContainerName {
+		t.Fatalf("expected the %s init container, got %v", networkSetupContainerName, d.Spec.Template.Spec.InitContainers)
+	}
+	expected := []string{"-vxlan_port=4790", "-vxlan_mtu=1450"}
+	if args := d.Spec.Template.Spec.InitContainers[0].Args; !reflect.DeepEqual(args, expected) {
+		t.Errorf("expected args %v, got %v", expected, args)
+	}
+	if env, _ := containerEnv(d, networkSetupContainerName, vnisEnv); env.Value != formatVNIsEnv(vnis) {
+		t.Errorf("expected %s %q, got %q", vnisEnv, formatVNIsEnv(vnis), env.Value)
+	}
+}
+
+func TestFrrPodStatus(t *testing.T) {
+	f := newFixture(t)
+	frr := newFrr("test", int32Ptr(2))
+	d := mustNewDeployment(t, frr, testMinASN, specVNI(testMinVNI), nil)
+	other := newFrr("other", int32Ptr(1))
 
 	f.frrLister = append(f.frrLister, frr)
 	f.objects = append(f.objects, frr)
 	f.deploymentLister = append(f.deploymentLister, d)
 	f.kubeobjects = append(f.kubeobjects, d)
+	f.podLister = append(f.podLister,
+		newPod(frr, "test-b", "node2", "10.0.0.2", corev1.ConditionFalse),
+		newPod(frr, "test-a", "node1", "10.0.0.1", corev1.ConditionTrue),
+		newPod(other, "other-a", "node3", "10.0.0.3", corev1.ConditionTrue))
 
-	f.runExpectError(getKey(frr, t))
+	expFrr := allocatedFrr(frr, testMinASN, testMinVNI)
+	expFrr.Status.Nodes = "node1,node2"
+	expFrr.Status.Pods = []frrcontroller.FrrPodStatus{
+		{Name: "test-a", Node: "node1", VTEPAddress: "10.0.0.1", Phase: corev1.PodRunning, Ready: true},
+		{Name: "test-b", Node: "node2", VTEPAddress: "10.0.0.2", Phase: corev1.PodRunning, Ready: false},
+	}
+	f.expectCreateConfigSecretAction(frr, testMinASN)
+	f.expectCreateReloaderAccessActions(frr)
+	f.expectUpdateFrrStatusAction(expFrr)
+	f.run(getKey(frr, t))
+}
+
+func TestFrrPodStatusVTEPAddress(t *testing.T) {
+	f := newFixture(t)
+	frr := newFrr("test", int32Ptr(2))
+	frr.Spec.VXLAN = &frrcontroller.VXLAN{LocalAddressSource: frrcontroller.VXLANLocalAddressNodeInternalIP}
+	// test-a reported the address it filled into frr.conf, test-b did
+	// not yet
+	reported := newPod(frr, "test-a", "node1", "10.0.0.1", corev1.ConditionTrue)
+	value, _ := json.Marshal(utils.FrrConfigStatus{Hash: "hash", VTEPAddress: "192.168.0.10"})
+	reported.Annotations = map[string]string{utils.FrrConfigAnnotation: string(value)}
+	pending := newPod(frr, "test-b", "node2", "10.0.0.2", corev1.ConditionFalse)
+	pending.Status.HostIP = "192.168.0.2"
+	f.podLister = append(f.podLister, reported, pending)
+
+	c, _, _ := f.newController()
+	_, pods, err := c.frrPodStatus(frr)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for i, expected := range []string{"192.168.0.10", "192.168.0.2"} {
+		if pods[i].VTEPAddress != expected {
+			t.Errorf("expected pod %s to use VTEP address %s, got %q", pods[i].Name, expected, pods[i].VTEPAddress)
+		}
+	}
+
+	// The address of an interface is only known once reported
+	frr.Spec.VXLAN = &frrcontroller.VXLAN{LocalAddressSource: frrcontroller.VXLANLocalAddressInterface, LocalInterface: "eth1"}
+	if _, pods, err = c.frrPodStatus(frr); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if pods[0].VTEPAddress != "192.168.0.10" || pods[1].VTEPAddress != "" {
+		t.Errorf("expected only the reported VTEP address, got %+v", pods)
+	}
+}
+
+func TestHandlePod(t *testing.T) {
+	f := newFixture(t)
+	frr := newFrr("test", int32Ptr(1))
+	c, _, _ := f.newController()
+
+	pod := newPod(frr, "test-a", "node1", "10.0.0.1", corev1.ConditionTrue)
+	c.handlePod(cache.DeletedFinalStateUnknown{Key: "default/test-a", Obj: pod})
+	unrelated := pod.DeepCopy()
+	unrelated.Labels = map[string]string{"app": "other", "controller": "test"}
+	c.handlePod(unrelated)
+
+	if c.workqueue.Len() != 1 {
+		t.Fatalf("expected the frr of the pod to be enqueued once, queue length %d", c.workqueue.Len())
+	}
+	key, _ := c.workqueue.Get()
+	if key != getKey(frr, t) {
+		t.Errorf("expected key %s, got %v", getKey(frr, t), key)
+	}
+}
+
+func TestUpdateDeployment(t *testing.T) {
+	f := newFixture(t)
+	frr := newFrr("test", int32Ptr(1))
+	d := mustNewDeployment(t, frr, testMinASN, specVNI(testMinVNI), nil)
+
+	// Update replicas
+	frr.Spec.Replicas = int32Ptr(2)
+	expDeployment := mustNewDeployment(t, frr, testMinASN, specVNI(testMinVNI), nil)
+
+	f.frrLister = append(f.frrLister, frr)
+	f.objects = append(f.objects, frr)
+	f.deploymentLister = append(f.deploymentLister, d)
+	f.kubeobjects = append(f.kubeobjects, d)
+
+	f.expectCreateConfigSecretAction(frr, testMinASN)
+	f.expectCreateReloaderAccessActions(frr)
+	f.expectUpdateFrrStatusAction(allocatedFrr(frr, testMinASN, testMinVNI))
+	f.expectUpdateDeploymentAction(expDeployment)
+	f.run(getKey(frr, t))
+}
+
+func TestUpdateDeploymentOnSpecChange(t *testing.T) {
+	f := newFixture(t)
+	frr := newFrr("test", int32Ptr(1))
+	frr.Spec.Image = "frr:8.4"
+	d := mustNewDeployment(t, frr, testMinASN, specVNI(testMinVNI), nil)
+
+	// Update the image, which must roll the pods
+	frr.Spec.Image = "frr:8.5"
+	expDeployment := mustNewDeployment(t, frr, testMinASN, specVNI(testMinVNI), nil)
+	if d.Spec.Template.Annotations[specHashAnnotation] == expDeployment.Spec.Template.Annotations[specHashAnnotation] {
+		t.Fatalf("expected the spec hash to change")
+	}
+
+	f.frrLister = append(f.frrLister, frr)
+	f.objects = append(f.objects, frr)
+	f.deploymentLister = append(f.deploymentLister, d)
+	f.kubeobjects = append(f.kubeobjects, d)
+
+	f.expectCreateConfigSecretAction(frr, testMinASN)
+	f.expectCreateReloaderAccessActions(frr)
+	f.expectUpdateFrrStatusAction(allocatedFrr(frr, testMinASN, testMinVNI))
+	f.expectUpdateDeploymentAction(expDeployment)
+	f.run(getKey(frr, t))
+}
+
+func TestUpdateConfigSecretOnSpecChange(t *testing.T) {
+	f := newFixture(t)
+	frr := newFrr("test", int32Ptr(1))
+	config, err := renderConfig(frr, testMinASN, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("error rendering frr.conf: %v", err)
+	}
+	secret := newConfigSecret(frr, config)
+	d := mustNewDeployment(t, frr, testMinASN, specVNI(testMinVNI), nil)
+
+	frr.Spec.Neighbors = []string{"10.0.0.1", "10.0.0.2"}
+	config, err = renderConfig(frr, testMinASN, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("error rendering frr.conf: %v", err)
+	}
+	expSecret := secret.DeepCopy()
+	expSecret.Data = newConfigSecret(frr, config).Data
+	// frr-reloader applies the new configuration, the pods are not rolled
+	if expDeployment := mustNewDeployment(t, frr, testMinASN, specVNI(testMinVNI), nil); deploymentNeedsUpdate(d, expDeployment) {
+		t.Fatalf("expected the Deployment to be left alone")
+	}
+
+	f.frrLister = append(f.frrLister, frr)
+	f.objects = append(f.objects, frr)
+	f.secretLister = append(f.secretLister, secret)
+	f.kubeobjects = append(f.kubeobjects, secret)
+	f.addReloaderAccess(frr)
+	f.deploymentLister = append(f.deploymentLister, d)
+	f.kubeobjects = append(f.kubeobjects, d)
+
+	f.kubeactions = append(f.kubeactions, core.NewUpdateAction(schema.GroupVersionResource{Resource: "secrets"}, frr.Namespace, expSecret))
+	f.expectUpdateFrrStatusAction(allocatedFrr(frr, testMinASN, testMinVNI))
+	f.run(getKey(frr, t))
+}
+
+func TestRenderFailed(t *testing.T) {
+	f := newFixture(t)
+	frr := newFrr("test", int32Ptr(1))
+	frr.Spec.Neighbors = []string{"10.0.0.1", "not-an-address"}
+
+	f.frrLister = append(f.frrLister, frr)
+	f.objects = append(f.objects, frr)
+
+	_, err := renderConfig(frr, testMinASN, nil, nil, nil)
+	if err == nil {
+		t.Fatalf("expected frr.conf not to render")
+	}
+	msg := fmt.Sprintf(MessageRenderFailed, err)
+	expFrr := frr.DeepCopy()
+	expFrr.Status.ObservedGeneration = frr.Generation
+	expFrr.Status.Conditions = []metav1.Condition{{
+		Type:    frrcontroller.FrrConditionConfigRendered,
+		Status:  metav1.ConditionFalse,
+		Reason:  ReasonRenderFailed,
+		Message: msg,
+	}, {
+		Type:    frrcontroller.FrrConditionDegraded,
+		Status:  metav1.ConditionTrue,
+		Reason:  ReasonRenderFailed,
+		Message: msg,
+	}, {
+		Type:    frrcontroller.FrrConditionReady,
+		Status:  metav1.ConditionFalse,
+		Reason:  ReasonNotReady,
+		Message: "Waiting for Allocated, DeploymentReady, ConfigRendered, not Degraded",
+	}}
+	// No Secret nor Deployment is created for a configuration which does
+	// not render
+	f.expectUpdateFrrStatusAction(expFrr)
+	f.run(getKey(frr, t))
+}
+
+// newPasswordSecret returns a Secret holding a BGP password in key
+// "password"
+func newPasswordSecret(name, password string) *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: metav1.NamespaceDefault},
+		Data:       map[string][]byte{"password": []byte(password)},
+	}
+}
+
+func passwordRef(name string) *corev1.SecretKeySelector {
+	return &corev1.SecretKeySelector{
+		LocalObjectReference: corev1.LocalObjectReference{Name: name},
+		Key:                  "password",
+	}
+}
+
+func TestCreatesConfigSecretWithPasswords(t *testing.T) {
+	f := newFixture(t)
+	frr := newFrr("test", int32Ptr(1))
+	frr.Spec.Neighbors = []string{"10.0.0.1"}
+	frr.Spec.PasswordSecretRef = passwordRef("fabric")
+	frr.Spec.Peers = []frrcontroller.BGPPeer{{
+		Address:           "10.0.0.2",
+		PasswordSecretRef: passwordRef("spine"),
+	}, {
+		Address: "10.0.0.3",
+	}}
+
+	f.frrLister = append(f.frrLister, frr)
+	f.objects = append(f.objects, frr)
+	for _, secret := range []*corev1.Secret{newPasswordSecret("fabric", "f4br1c"), newPasswordSecret("spine", "sp1ne")} {
+		f.kubeobjects = append(f.kubeobjects, secret)
+	}
+
+	config, err := renderConfig(frr, testMinASN, nil, nil, map[string]string{
+		"10.0.0.1": "f4br1c",
+		"10.0.0.2": "sp1ne",
+		"10.0.0.3": "f4br1c",
+	})
+	if err != nil {
+		t.Fatalf("error rendering frr.conf: %v", err)
+	}
+	if !strings.Contains(string(config), "neighbor 10.0.0.2 password sp1ne") {
+		t.Fatalf("expected frr.conf to hold the password of 10.0.0.2:\n%s", config)
+	}
+	f.kubeactions = append(f.kubeactions, core.NewCreateAction(schema.GroupVersionResource{Resource: "secrets"}, frr.Namespace, newConfigSecret(frr, config)))
+	f.expectCreateReloaderAccessActions(frr)
+	// The passwords only reach the pods through the Secret
+	f.expectCreateDeploymentAction(mustNewDeployment(t, frr, testMinASN, specVNI(testMinVNI), nil))
+	f.expectUpdateFrrStatusAction(allocatedFrr(frr, testMinASN, testMinVNI))
+	f.run(getKey(frr, t))
+}
+
+func TestPasswordSecretNotFound(t *testing.T) {
+	f := newFixture(t)
+	frr := newFrr("test", int32Ptr(1))
+	frr.Spec.Peers = []frrcontroller.BGPPeer{{
+		Address:           "10.0.0.1",
+		PasswordSecretRef: passwordRef("spine"),
+	}}
+
+	f.frrLister = append(f.frrLister, frr)
+	f.objects = append(f.objects, frr)
+
+	msg := fmt.Sprintf(MessageRenderFailed, `neighbor 10.0.0.1: secret "spine" not found`)
+	expFrr := frr.DeepCopy()
+	expFrr.Status.ObservedGeneration = frr.Generation
+	expFrr.Status.Conditions = []metav1.Condition{{
+		Type:    frrcontroller.FrrConditionConfigRendered,
+		Status:  metav1.ConditionFalse,
+		Reason:  ReasonRenderFailed,
+		Message: msg,
+	}, {
+		Type:    frrcontroller.FrrConditionDegraded,
+		Status:  metav1.ConditionTrue,
+		Reason:  ReasonRenderFailed,
+		Message: msg,
+	}, {
+		Type:    frrcontroller.FrrConditionReady,
+		Status:  metav1.ConditionFalse,
+		Reason:  ReasonNotReady,
+		Message: "Waiting for Allocated, DeploymentReady, ConfigRendered, not Degraded",
+	}}
+	f.expectUpdateFrrStatusAction(expFrr)
+	f.run(getKey(frr, t))
+}
+
+func TestOptionalPasswordSecretNotFound(t *testing.T) {
+	f := newFixture(t)
+	frr := newFrr("test", int32Ptr(1))
+	optional := true
+	frr.Spec.PasswordSecretRef = passwordRef("fabric")
+	frr.Spec.PasswordSecretRef.Optional = &optional
+	frr.Spec.Neighbors = []string{"10.0.0.1"}
+
+	f.frrLister = append(f.frrLister, frr)
+	f.objects = append(f.objects, frr)
+
+	f.expectCreateConfigSecretAction(frr, testMinASN)
+	f.expectCreateReloaderAccessActions(frr)
+	f.expectCreateDeploymentAction(mustNewDeployment(t, frr, testMinASN, specVNI(testMinVNI), nil))
+	f.expectUpdateFrrStatusAction(allocatedFrr(frr, testMinASN, testMinVNI))
+	f.run(getKey(frr, t))
+}
+
+func TestHandleSecretEnqueuesFrrs(t *testing.T) {
+	f := newFixture(t)
+	frr := newFrr("test", int32Ptr(1))
+	referencing := newFrr("referencing", int32Ptr(1))
+	referencing.Spec.Peers = []frrcontroller.BGPPeer{{
+		Address:           "10.0.0.1",
+		PasswordSecretRef: passwordRef("spine"),
+	}}
+	f.frrLister = append(f.frrLister, frr, referencing)
+	f.objects = append(f.objects, frr, referencing)
+	c, _, _ := f.newController()
+
+	// A rotated password renders frr.conf of the Frrs using it again
+	c.handlePasswordSecret(newPasswordSecret("spine", "r0tated"))
+	if c.workqueue.Len() != 1 {
+		t.Fatalf("expected 1 Frr to be enqueued, got %d", c.workqueue.Len())
+	}
+	if key, _ := c.workqueue.Get(); key != getKey(referencing, t) {
+		t.Errorf("expected %s to be enqueued, got %v", getKey(referencing, t), key)
+	}
+	c.workqueue.Done(getKey(referencing, t))
+
+	// An edited frr.conf is reverted
+	c.handleSecret(newConfigSecret(frr, []byte("edited")))
+	if c.workqueue.Len() != 1 {
+		t.Fatalf("expected 1 Frr to be enqueued, got %d", c.workqueue.Len())
+	}
+	if key, _ := c.workqueue.Get(); key != getKey(frr, t) {
+		t.Errorf("expected %s to be enqueued, got %v", getKey(frr, t), key)
+	}
+}
+
+func TestPasswordSecretRotation(t *testing.T) {
+	f := newFixture(t)
+	frr := newFrr("test", int32Ptr(1))
+	frr.Spec.Peers = []frrcontroller.BGPPeer{{
+		Address:           "10.0.0.1",
+		PasswordSecretRef: passwordRef("spine"),
+	}}
+	f.frrLister = append(f.frrLister, frr)
+	f.kubeobjects = append(f.kubeobjects, newPasswordSecret("spine", "sp1ne"))
+	c, _, _ := f.newController()
+
+	waitForFrr := func() {
+		t.Helper()
+		if err := wait.PollImmediate(10*time.Millisecond, wait.ForeverTestTimeout, func() (bool, error) {
+			return c.workqueue.Len() == 1, nil
+		}); err != nil {
+			t.Fatalf("expected the Frr to be enqueued")
+		}
+		key, _ := c.workqueue.Get()
+		c.workqueue.Done(key)
+	}
+	passwords, err := c.peerPasswords(frr)
+	if err != nil || passwords["10.0.0.1"] != "sp1ne" {
+		t.Fatalf("expected the password of 10.0.0.1, got %v, %v", passwords, err)
+	}
+	waitForFrr()
+
+	rotated := newPasswordSecret("spine", "r0tated")
+	rotated.ResourceVersion = "2"
+	if _, err := f.kubeclient.CoreV1().Secrets(metav1.NamespaceDefault).Update(context.TODO(), rotated, metav1.UpdateOptions{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	waitForFrr()
+	if err := wait.PollImmediate(10*time.Millisecond, wait.ForeverTestTimeout, func() (bool, error) {
+		passwords, err := c.peerPasswords(frr)
+		return passwords["10.0.0.1"] == "r0tated", err
+	}); err != nil {
+		t.Errorf("expected the rotated password to be read: %v", err)
+	}
+
+	// The Secret is no longer watched once no Frr refers to it
+	c.frrsIndexer.Delete(frr)
+	c.syncPasswordSecrets()
+	if len(c.passwordSecrets.watches) != 0 {
+		t.Errorf("expected no Secret to be watched, got %v", c.passwordSecrets.watches)
+	}
+}
+
+func TestUpdateDeploymentEditedByHand(t *testing.T) {
+	f := newFixture(t)
+	frr := newFrr("test", int32Ptr(1))
+	d := mustNewDeployment(t, frr, testMinASN, specVNI(testMinVNI), nil)
+	d.Spec.Template.Spec.Containers[0].Image = "frr:edited"
+
+	f.frrLister = append(f.frrLister, frr)
+	f.objects = append(f.objects, frr)
+	f.deploymentLister = append(f.deploymentLister, d)
+	f.kubeobjects = append(f.kubeobjects, d)
+
+	f.expectCreateConfigSecretAction(frr, testMinASN)
+	f.expectCreateReloaderAccessActions(frr)
+	f.expectUpdateFrrStatusAction(allocatedFrr(frr, testMinASN, testMinVNI))
+	f.expectUpdateDeploymentAction(mustNewDeployment(t, frr, testMinASN, specVNI(testMinVNI), nil))
+	f.run(getKey(frr, t))
+}
+
+func TestNotControlledByUs(t *testing.T) {
+	f := newFixture(t)
+	frr := newFrr("test", int32Ptr(1))
+	d := mustNewDeployment(t, frr, testMinASN, specVNI(testMinVNI), nil)
+
+	d.ObjectMeta.OwnerReferences = []metav1.OwnerReference{}
+
+	f.frrLister = append(f.frrLister, frr)
+	f.objects = append(f.objects, frr)
+	f.deploymentLister = append(f.deploymentLister, d)
+	f.kubeobjects = append(f.kubeobjects, d)
+
+	notOwned := frr.DeepCopy()
+	msg := fmt.Sprintf(MessageResourceExists, d.Name)
+	notOwned.Status.Conditions = []metav1.Condition{{
+		Type:    frrcontroller.FrrConditionAllocated,
+		Status:  metav1.ConditionTrue,
+		Reason:  ReasonAllocated,
+		Message: fmt.Sprintf("AS number %d, VNI %d", testMinASN, testMinVNI),
+	}, {
+		Type:    frrcontroller.FrrConditionDeploymentReady,
+		Status:  metav1.ConditionFalse,
+		Reason:  ReasonDeploymentNotOwned,
+		Message: msg,
+	}, {
+		Type:    frrcontroller.FrrConditionDegraded,
+		Status:  metav1.ConditionTrue,
+		Reason:  ReasonDeploymentNotOwned,
+		Message: msg,
+	}, {
+		Type:    frrcontroller.FrrConditionReady,
+		Status:  metav1.ConditionFalse,
+		Reason:  ReasonNotReady,
+		Message: "Waiting for DeploymentReady, ConfigRendered, not Degraded",
+	}}
+	f.expectCreateConfigSecretAction(frr, testMinASN)
+	f.expectCreateReloaderAccessActions(frr)
+	f.expectUpdateFrrStatusAction(notOwned)
+	f.runExpectError(getKey(frr, t))
+}
+
+func TestCreatesReloaderAccessInFrrNamespace(t *testing.T) {
+	f := newFixture(t)
+	frr := newFrr("test", int32Ptr(1))
+	frr.Namespace = "tenant"
+
+	f.frrLister = append(f.frrLister, frr)
+	f.objects = append(f.objects, frr)
+
+	f.expectCreateConfigSecretAction(frr, testMinASN)
+	f.expectCreateReloaderAccessActions(frr)
+	f.expectCreateDeploymentAction(mustNewDeployment(t, frr, testMinASN, specVNI(testMinVNI), nil))
+	f.expectUpdateFrrStatusAction(allocatedFrr(frr, testMinASN, testMinVNI))
+	f.run(getKey(frr, t))
+
+	d, err := f.kubeclient.AppsV1().Deployments(frr.Namespace).Get(context.TODO(), frr.Spec.DeploymentName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := d.Spec.Template.Spec.ServiceAccountName, reloaderServiceAccountName(frr); got != want {
+		t.Errorf("expected the pods to run as %q, got %q", want, got)
+	}
+	b, err := f.kubeclient.RbacV1().RoleBindings(frr.Namespace).Get(context.TODO(), reloaderServiceAccountName(frr), metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b.Subjects) != 1 || b.Subjects[0].Namespace != frr.Namespace || b.Subjects[0].Name != reloaderServiceAccountName(frr) {
+		t.Errorf("expected the RoleBinding to bind %s/%s, got %+v", frr.Namespace, reloaderServiceAccountName(frr), b.Subjects)
+	}
+	if b.RoleRef.Kind != "ClusterRole" || b.RoleRef.Name != reloaderClusterRole {
+		t.Errorf("expected the RoleBinding to refer to ClusterRole %s, got %+v", reloaderClusterRole, b.RoleRef)
+	}
+}
+
+func TestReplacesEditedReloaderRoleBinding(t *testing.T) {
+	f := newFixture(t)
+	frr := newFrr("test", int32Ptr(1))
+	d := mustNewDeployment(t, frr, testMinASN, specVNI(testMinVNI), nil)
+	config, err := renderConfig(frr, testMinASN, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("error rendering frr.conf: %v", err)
+	}
+	secret := newConfigSecret(frr, config)
+	account := newReloaderServiceAccount(frr)
+	binding := newReloaderRoleBinding(frr)
+	binding.RoleRef.Name = "edit"
+
+	f.frrLister = append(f.frrLister, frr)
+	f.objects = append(f.objects, frr)
+	f.secretLister = append(f.secretLister, secret)
+	f.serviceAccountLister = append(f.serviceAccountLister, account)
+	f.roleBindingLister = append(f.roleBindingLister, binding)
+	f.deploymentLister = append(f.deploymentLister, d)
+	f.kubeobjects = append(f.kubeobjects, secret, account, binding, d)
+
+	f.kubeactions = append(f.kubeactions, core.NewDeleteAction(schema.GroupVersionResource{Resource: "rolebindings"}, frr.Namespace, binding.Name))
+	f.kubeactions = append(f.kubeactions, core.NewCreateAction(schema.GroupVersionResource{Resource: "rolebindings"}, frr.Namespace, newReloaderRoleBinding(frr)))
+	f.expectUpdateFrrStatusAction(allocatedFrr(frr, testMinASN, testMinVNI))
+	f.run(getKey(frr, t))
+}
+
+func TestAddsFinalizer(t *testing.T) {
+	f := newFixture(t)
+	frr := newFrr("test", int32Ptr(1))
+	frr.Finalizers = nil
+
+	f.frrLister = append(f.frrLister, frr)
+	f.objects = append(f.objects, frr)
+
+	withFinalizer := frr.DeepCopy()
+	withFinalizer.Finalizers = []string{frrFinalizer}
+	f.expectUpdateFrrAction(withFinalizer)
+	f.expectCreateConfigSecretAction(withFinalizer, testMinASN)
+	f.expectCreateReloaderAccessActions(withFinalizer)
+	f.expectCreateDeploymentAction(mustNewDeployment(t, withFinalizer, testMinASN, specVNI(testMinVNI), nil))
+	f.expectUpdateFrrStatusAction(allocatedFrr(withFinalizer, testMinASN, testMinVNI))
+
+	f.run(getKey(frr, t))
+}
+
+func TestReservesRequestedNumbers(t *testing.T) {
+	f := newFixture(t)
+	frr := newFrr("test", int32Ptr(1))
+	frr.Spec.ASNumber = testMinASN + 10
+	frr.Spec.VNI = testMinVNI + 10
+
+	f.frrLister = append(f.frrLister, frr)
+	f.objects = append(f.objects, frr)
+
+	f.expectCreateConfigSecretAction(frr, testMinASN+10)
+	f.expectCreateReloaderAccessActions(frr)
+	f.expectCreateDeploymentAction(mustNewDeployment(t, frr, testMinASN+10, specVNI(testMinVNI+10), nil))
+	f.expectUpdateFrrStatusAction(allocatedFrr(frr, testMinASN+10, testMinVNI+10))
+
+	f.run(getKey(frr, t))
+}
+
+func TestReassignsChangedRequest(t *testing.T) {
+	f := newFixture(t)
+	frr := newFrr("test", int32Ptr(1))
+	d := mustNewDeployment(t, frr, testMinASN, specVNI(testMinVNI), nil)
+	frr.Spec.VNI = testMinVNI + 10
+
+	f.frrLister = append(f.frrLister, frr)
+	f.objects = append(f.objects, frr)
+	f.deploymentLister = append(f.deploymentLister, d)
+	f.kubeobjects = append(f.kubeobjects, d)
+
+	var c *Controller
+	f.prepare = func(controller *Controller) {
+		c = controller
+		defaultPoolManager(c, vniPoolKind).Reserve(getKey(frr, t), testMinVNI)
+	}
+	f.expectCreateConfigSecretAction(frr, testMinASN)
+	f.expectCreateReloaderAccessActions(frr)
+	f.expectUpdateFrrStatusAction(allocatedFrr(frr, testMinASN, testMinVNI+10))
+	// The new VNI reaches the pods through the Deployment
+	f.expectUpdateDeploymentAction(mustNewDeployment(t, frr, testMinASN, specVNI(testMinVNI+10), nil))
+	f.run(getKey(frr, t))
+
+	if owner, ok := defaultPoolManager(c, vniPoolKind).Owner(testMinVNI); ok {
+		t.Errorf("expected the previous VNI to be released, held by %s", owner)
+	}
+}
+
+func TestReservationConflict(t *testing.T) {
+	f := newFixture(t)
+	frr := newFrr("test", int32Ptr(1))
+	frr.Spec.VNI = testMinVNI + 10
+
+	f.frrLister = append(f.frrLister, frr)
+	f.objects = append(f.objects, frr)
+
+	recorder := record.NewFakeRecorder(10)
+	f.prepare = func(c *Controller) {
+		c.recorder = recorder
+		defaultPoolManager(c, vniPoolKind).Reserve("default/other", testMinVNI+10)
+	}
+	msg := fmt.Sprintf(MessageReservationFailed, "VNI", testMinVNI+10, defaultPool, "already allocated to default/other")
+	f.expectUpdateFrrStatusAction(allocationFailedFrr(frr, ErrReservationFailed, msg))
+	f.runExpectError(getKey(frr, t))
+
+	select {
+	case event := <-recorder.Events:
+		if !strings.Contains(event, ErrReservationFailed) || !strings.Contains(event, "default/other") {
+			t.Errorf("expected %s event naming the owner, got %q", ErrReservationFailed, event)
+		}
+	default:
+		t.Errorf("expected a %s event", ErrReservationFailed)
+	}
+}
+
+func TestReservationOutOfRange(t *testing.T) {
+	f := newFixture(t)
+	frr := newFrr("test", int32Ptr(1))
+	frr.Spec.ASNumber = testMaxASN + 1
+
+	f.frrLister = append(f.frrLister, frr)
+	f.objects = append(f.objects, frr)
+
+	var c *Controller
+	f.prepare = func(controller *Controller) {
+		c = controller
+	}
+	msg := fmt.Sprintf(MessageReservationFailed, "AS number", testMaxASN+1, defaultPool,
+		fmt.Sprintf("%d is not in range %d-%d", testMaxASN+1, testMinASN, testMaxASN))
+	f.expectUpdateFrrStatusAction(allocationFailedFrr(frr, ErrReservationFailed, msg))
+	f.runExpectError(getKey(frr, t))
+
+	if _, ok := defaultPoolManager(c, asnPoolKind).Get(getKey(frr, t)); ok {
+		t.Errorf("expected no AS number to be held")
+	}
+}
+
+func TestDeleteFrrDeletesDeployment(t *testing.T) {
+	f := newFixture(t)
+	frr := newFrr("test", int32Ptr(1))
+	now := metav1.Now()
+	frr.DeletionTimestamp = &now
+	d := mustNewDeployment(t, frr, testMinASN, specVNI(testMinVNI), nil)
+
+	f.frrLister = append(f.frrLister, frr)
+	f.objects = append(f.objects, frr)
+	f.deploymentLister = append(f.deploymentLister, d)
+	f.kubeobjects = append(f.kubeobjects, d)
+
+	// The allocation is kept until the Deployment is gone
+	f.prepare = func(c *Controller) {
+		defaultPoolManager(c, vniPoolKind).Reserve(getKey(frr, t), testMinVNI)
+	}
+	f.expectDeleteDeploymentAction(d)
+	f.run(getKey(frr, t))
+}
+
+func TestDeleteFrrReleasesAllocations(t *testing.T) {
+	f := newFixture(t)
+	frr := newFrr("test", int32Ptr(1))
+	now := metav1.Now()
+	frr.DeletionTimestamp = &now
+
+	f.frrLister = append(f.frrLister, frr)
+	f.objects = append(f.objects, frr)
+
+	var c *Controller
+	f.prepare = func(controller *Controller) {
+		c = controller
+		defaultPoolManager(c, vniPoolKind).Reserve(getKey(frr, t), testMinVNI)
+		defaultPoolManager(c, asnPoolKind).Reserve(getKey(frr, t), testMinASN)
+	}
+	withoutFinalizer := frr.DeepCopy()
+	withoutFinalizer.Finalizers = nil
+	f.expectUpdateFrrAction(withoutFinalizer)
+	f.run(getKey(frr, t))
+
+	if _, ok := defaultPoolManager(c, vniPoolKind).Get(getKey(frr, t)); ok {
+		t.Errorf("expected VNI of deleted frr to be released")
+	}
+	if _, ok := defaultPoolManager(c, asnPoolKind).Get(getKey(frr, t)); ok {
+		t.Errorf("expected ASN of deleted frr to be released")
+	}
+}
+
+func TestDeletedFrrReleasesAllocations(t *testing.T) {
+	f := newFixture(t)
+	frr := newFrr("test", int32Ptr(1))
+
+	// The Frr is already gone from the cache, e.g. its finalizer was
+	// removed by hand
+	var c *Controller
+	f.prepare = func(controller *Controller) {
+		c = controller
+		defaultPoolManager(c, vniPoolKind).Reserve(getKey(frr, t), testMinVNI)
+	}
+	f.run(getKey(frr, t))
+
+	if _, ok := defaultPoolManager(c, vniPoolKind).Get(getKey(frr, t)); ok {
+		t.Errorf("expected VNI of deleted frr to be released")
+	}
+}
+
+// newTeardownFrr returns a Frr being deleted whose network connect-frr built
+// on the given nodes
+func newTeardownFrr(name string, nodes ...string) *frrcontroller.Frr {
+	frr := newFrr(name, int32Ptr(1))
+	frr.Spec.VNIs = []frrcontroller.L2VNI{{Name: "blue", LogicalSwitch: "ls-blue"}}
+	frr.Status.Nodes = strings.Join(nodes, ",")
+	frr.Status.NetworkNodes = nodes
+	now := metav1.Now()
+	frr.DeletionTimestamp = &now
+	return frr
+}
+
+func newNode(name string) *corev1.Node {
+	return &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: name}}
+}
+
+// withJobCondition returns a copy of the Job with the given condition set
+func withJobCondition(job *batchv1.Job, conditionType batchv1.JobConditionType, message string) *batchv1.Job {
+	job = job.DeepCopy()
+	job.Status.Conditions = append(job.Status.Conditions, batchv1.JobCondition{
+		Type:    conditionType,
+		Status:  corev1.ConditionTrue,
+		Message: message,
+	})
+	return job
+}
+
+func (f *fixture) expectCreateJobAction(job *batchv1.Job) {
+	f.kubeactions = append(f.kubeactions, core.NewCreateAction(schema.GroupVersionResource{Resource: "jobs"}, job.Namespace, job))
+}
+
+func (f *fixture) expectDeleteJobAction(job *batchv1.Job) {
+	f.kubeactions = append(f.kubeactions, core.NewDeleteAction(schema.GroupVersionResource{Resource: "jobs"}, job.Namespace, job.Name))
+}
+
+var blueTeardownEnv = []corev1.EnvVar{{Name: vnisEnv, Value: "blue:1000:br-vx1000:ls-blue"}}
+
+func TestDeleteFrrTearsDownNetwork(t *testing.T) {
+	f := newFixture(t)
+	// node-2 is gone, there is nothing to remove there
+	frr := newTeardownFrr("test", "node-1", "node-2")
+
+	f.frrLister = append(f.frrLister, frr)
+	f.objects = append(f.objects, frr)
+	f.nodeLister = append(f.nodeLister, newNode("node-1"))
+
+	var c *Controller
+	f.prepare = func(controller *Controller) {
+		c = controller
+		defaultPoolManager(c, vniPoolKind).Reserve(getKey(frr, t)+"/blue", testMinVNI)
+	}
+	f.expectCreateJobAction(newTeardownJob(frr, "node-1", blueTeardownEnv))
+	f.run(getKey(frr, t))
+
+	if _, ok := defaultPoolManager(c, vniPoolKind).Get(getKey(frr, t) + "/blue"); !ok {
+		t.Errorf("expected the VNI to be held until the network is removed")
+	}
+}
+
+func TestDeleteFrrWaitsForPods(t *testing.T) {
+	f := newFixture(t)
+	frr := newTeardownFrr("test", "node-1")
+
+	f.frrLister = append(f.frrLister, frr)
+	f.objects = append(f.objects, frr)
+	f.nodeLister = append(f.nodeLister, newNode("node-1"))
+	f.podLister = append(f.podLister, newPod(frr, "test-a", "node-1", "10.0.0.1", corev1.ConditionFalse))
+
+	f.prepare = func(c *Controller) {
+		defaultPoolManager(c, vniPoolKind).Reserve(getKey(frr, t)+"/blue", testMinVNI)
+	}
+	f.run(getKey(frr, t))
+}
+
+func TestDeleteFrrTearsDownEarlierNodes(t *testing.T) {
+	f := newFixture(t)
+	// The replica moved from node-1 to node-2, and the VNI retired on
+	// node-1 is not removed yet
+	frr := newTeardownFrr("test", "node-1", "node-2")
+	frr.Status.Nodes = "node-2"
+	frr.Status.RetiredVNIs = []frrcontroller.RetiredVNIStatus{{VNI: testMinVNI + 2, Nodes: []string{"node-1"}}}
+
+	f.frrLister = append(f.frrLister, frr)
+	f.objects = append(f.objects, frr)
+	f.nodeLister = append(f.nodeLister, newNode("node-1"), newNode("node-2"))
+
+	f.prepare = func(c *Controller) {
+		manager := defaultPoolManager(c, vniPoolKind)
+		manager.Reserve(getKey(frr, t)+"/blue", testMinVNI)
+		manager.Reserve(retiredAllocationName(getKey(frr, t), testMinVNI+2), testMinVNI+2)
+	}
+	f.expectCreateJobAction(newTeardownJob(frr, "node-1", []corev1.EnvVar{{Name: vnisEnv, Value: "blue:1000:br-vx1000:ls-blue retired:1002::"}}))
+	f.expectCreateJobAction(newTeardownJob(frr, "node-2", blueTeardownEnv))
+	f.run(getKey(frr, t))
+}
+
+func TestDeleteFrrRecordsNetworkNodes(t *testing.T) {
+	f := newFixture(t)
+	frr := newTeardownFrr("test", "node-1")
+	// connect-frr ran on node-2 before the status listed it
+	pod := newPod(frr, "test-a", "node-2", "10.0.0.2", corev1.ConditionFalse)
+	pod.Spec.InitContainers = []corev1.Container{{Name: networkSetupContainerName}}
+
+	f.frrLister = append(f.frrLister, frr)
+	f.objects = append(f.objects, frr)
+	f.podLister = append(f.podLister, pod)
+
+	f.prepare = func(c *Controller) {
+		defaultPoolManager(c, vniPoolKind).Reserve(getKey(frr, t)+"/blue", testMinVNI)
+	}
+	expected := frr.DeepCopy()
+	expected.Status.NetworkNodes = []string{"node-1", "node-2"}
+	f.expectUpdateFrrStatusAction(expected)
+	f.run(getKey(frr, t))
+}
+
+func TestDeleteFrrReleasesAfterTeardown(t *testing.T) {
+	f := newFixture(t)
+	frr := newTeardownFrr("test", "node-1")
+	job := withJobCondition(newTeardownJob(frr, "node-1", blueTeardownEnv), batchv1.JobComplete, "")
+
+	f.frrLister = append(f.frrLister, frr)
+	f.objects = append(f.objects, frr)
+	f.nodeLister = append(f.nodeLister, newNode("node-1"))
+	f.jobLister = append(f.jobLister, job)
+	f.kubeobjects = append(f.kubeobjects, job)
+
+	var c *Controller
+	f.prepare = func(controller *Controller) {
+		c = controller
+		defaultPoolManager(c, vniPoolKind).Reserve(getKey(frr, t)+"/blue", testMinVNI)
+	}
+	withoutFinalizer := frr.DeepCopy()
+	withoutFinalizer.Finalizers = nil
+	f.expectUpdateFrrAction(withoutFinalizer)
+	f.run(getKey(frr, t))
+
+	if _, ok := defaultPoolManager(c, vniPoolKind).Get(getKey(frr, t) + "/blue"); ok {
+		t.Errorf("expected the VNI to be released")
+	}
+}
+
+func TestDeleteFrrTeardownFailed(t *testing.T) {
+	f := newFixture(t)
+	frr := newTeardownFrr("test", "node-1")
+	job := withJobCondition(newTeardownJob(frr, "node-1", blueTeardownEnv), batchv1.JobFailed, "BackoffLimitExceeded")
+
+	f.frrLister = append(f.frrLister, frr)
+	f.objects = append(f.objects, frr)
+	f.nodeLister = append(f.nodeLister, newNode("node-1"))
+	f.jobLister = append(f.jobLister, job)
+	f.kubeobjects = append(f.kubeobjects, job)
+
+	recorder := record.NewFakeRecorder(10)
+	f.prepare = func(c *Controller) {
+		c.recorder = recorder
+		defaultPoolManager(c, vniPoolKind).Reserve(getKey(frr, t)+"/blue", testMinVNI)
+	}
+	f.runExpectError(getKey(frr, t))
+
+	select {
+	case event := <-recorder.Events:
+		if !strings.Contains(event, ErrTeardownFailed) || !strings.Contains(event, "node-1") {
+			t.Errorf("unexpected event %q", event)
+		}
+	default:
+		t.Error("expected a teardown failure event")
+	}
+}
+
+// orphanedTeardownJob returns the Job tearing down the network of a Frr which
+// is gone, left without owner
+func orphanedTeardownJob(frr *frrcontroller.Frr, node string, env []corev1.EnvVar) *batchv1.Job {
+	job := newTeardownJob(frr, node, env)
+	job.OwnerReferences = nil
+	return job
+}
+
+var retiredBlueTeardownEnv = []corev1.EnvVar{{Name: vnisEnv, Value: fmt.Sprintf("retired:%d::", testMinVNI)}}
+
+func TestDeletedFrrRetiresVNIs(t *testing.T) {
+	f := newFixture(t)
+	// The finalizer of the Frr was removed by hand while its network was
+	// still on node-1
+	frr := newTeardownFrr("test", "node-1")
+	f.nodeLister = append(f.nodeLister, newNode("node-1"))
+
+	var c *Controller
+	f.prepare = func(controller *Controller) {
+		c = controller
+		defaultPoolManager(c, vniPoolKind).Reserve(getKey(frr, t)+"/blue", testMinVNI)
+		defaultPoolManager(c, asnPoolKind).Reserve(getKey(frr, t), testMinASN)
+		c.enqueueDeletedFrr(frr)
+	}
+	f.expectCreateJobAction(orphanedTeardownJob(frr, "node-1", retiredBlueTeardownEnv))
+	f.run(getKey(frr, t))
+
+	retired := retiredAllocationName(getKey(frr, t), testMinVNI)
+	if number, ok := defaultPoolManager(c, vniPoolKind).Get(retired); !ok || number != testMinVNI {
+		t.Errorf("expected VNI %d to be held as %s until the network is removed", testMinVNI, retired)
+	}
+	if _, ok := defaultPoolManager(c, vniPoolKind).Get(getKey(frr, t) + "/blue"); ok {
+		t.Errorf("expected the VNI to be retired")
+	}
+}
+
+func TestDeletedFrrReleasesAfterTeardown(t *testing.T) {
+	f := newFixture(t)
+	frr := newTeardownFrr("test", "node-1")
+	// The controller restarted, the orphaned Job tells what was removed
+	job := withJobCondition(orphanedTeardownJob(frr, "node-1", retiredBlueTeardownEnv), batchv1.JobComplete, "")
+	f.nodeLister = append(f.nodeLister, newNode("node-1"))
+	f.jobLister = append(f.jobLister, job)
+	f.kubeobjects = append(f.kubeobjects, job)
+
+	var c *Controller
+	f.prepare = func(controller *Controller) {
+		c = controller
+		defaultPoolManager(c, vniPoolKind).Reserve(retiredAllocationName(getKey(frr, t), testMinVNI), testMinVNI)
+	}
+	f.expectDeleteJobAction(job)
+	f.run(getKey(frr, t))
+
+	if _, ok := defaultPoolManager(c, vniPoolKind).Get(retiredAllocationName(getKey(frr, t), testMinVNI)); ok {
+		t.Errorf("expected the retired VNI to be released")
+	}
+}
+
+func TestDeletedFrrWaitsForTeardown(t *testing.T) {
+	f := newFixture(t)
+	frr := newTeardownFrr("test", "node-1")
+	job := orphanedTeardownJob(frr, "node-1", retiredBlueTeardownEnv)
+	f.nodeLister = append(f.nodeLister, newNode("node-1"))
+	f.jobLister = append(f.jobLister, job)
+	f.kubeobjects = append(f.kubeobjects, job)
+
+	var c *Controller
+	f.prepare = func(controller *Controller) {
+		c = controller
+		defaultPoolManager(c, vniPoolKind).Reserve(retiredAllocationName(getKey(frr, t), testMinVNI), testMinVNI)
+	}
+	f.run(getKey(frr, t))
+
+	if _, ok := defaultPoolManager(c, vniPoolKind).Get(retiredAllocationName(getKey(frr, t), testMinVNI)); !ok {
+		t.Errorf("expected the retired VNI to be held until the Job completes")
+	}
+}
+
+func TestOrphanedTeardownJobEnqueuesFrr(t *testing.T) {
+	f := newFixture(t)
+	frr := newTeardownFrr("test", "node-1")
+	c, _, _ := f.newController()
+
+	c.handleObject(orphanedTeardownJob(frr, "node-1", retiredBlueTeardownEnv))
+	if c.workqueue.Len() != 1 {
+		t.Fatalf("expected the Frr to be enqueued, got %d items", c.workqueue.Len())
+	}
+	if key, _ := c.workqueue.Get(); key != getKey(frr, t) {
+		t.Errorf("expected %s to be enqueued, got %v", getKey(frr, t), key)
+	}
+}
+
+func TestRetiresRemovedVNIs(t *testing.T) {
+	f := newFixture(t)
+	frr := newTeardownFrr("test", "node-1")
+	frr.DeletionTimestamp = nil
+	frr.Spec.VNIs[0].ID = testMinVNI + 1
+	// the deployment runs the pods which no longer use the removed VNI
+	d := mustNewDeployment(t, frr, testMinASN, nil, nil)
+	d.Status.Replicas = 1
+	d.Status.UpdatedReplicas = 1
+
+	f.nodeLister = append(f.nodeLister, newNode("node-1"))
+	c, _, _ := f.newController()
+	manager := defaultPoolManager(c, vniPoolKind)
+	manager.Reserve(getKey(frr, t)+"/blue", testMinVNI)
+	manager.Reserve(getKey(frr, t)+"/red", testMinVNI+2)
+
+	if _, _, _, err := c.allocateNumbers(frr); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	held := manager.Held(getKey(frr, t))
+	expected := map[string]int{
+		getKey(frr, t) + "/blue":                    testMinVNI + 1,
+		retiredAllocationName(getKey(frr, t), 1000): testMinVNI,
+		retiredAllocationName(getKey(frr, t), 1002): testMinVNI + 2,
+	}
+	if !reflect.DeepEqual(held, expected) {
+		t.Fatalf("expected %v, got %v", expected, held)
+	}
+
+	// the network is removed from node-1 before the VNIs are given back
+	if err := c.releaseRetiredVNIs(frr, d); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	env := []corev1.EnvVar{{Name: vnisEnv, Value: "retired:1000:: retired:1002::"}}
+	job := newTeardownJob(frr, "node-1", env)
+	f.expectCreateJobAction(job)
+	if actions := filterInformerActions(f.kubeclient.Actions()); len(actions) != 1 {
+		t.Fatalf("expected a single action, got %+v", actions)
+	} else {
+		checkAction(f.kubeactions[0], actions[0], t)
+	}
+	if len(manager.Held(getKey(frr, t))) != 3 {
+		t.Errorf("expected the retired VNIs to be held until the Job completes")
+	}
+
+	c.jobsLister = fakeJobLister(t, withJobCondition(job, batchv1.JobComplete, ""))
+	if err := c.releaseRetiredVNIs(frr, d); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if held := manager.Held(getKey(frr, t)); len(held) != 1 {
+		t.Errorf("expected the retired VNIs to be released, got %v", held)
+	}
+	actions := filterInformerActions(f.kubeclient.Actions())
+	if last := actions[len(actions)-1]; !last.Matches("delete", "jobs") {
+		t.Errorf("expected the teardown Job to be deleted, got %+v", last)
+	}
+}
+
+// fakeJobLister returns a JobLister holding the given Jobs
+func fakeJobLister(t *testing.T, jobs ...*batchv1.Job) batchlisters.JobLister {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	for _, job := range jobs {
+		if err := indexer.Add(job); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return batchlisters.NewJobLister(indexer)
+}
+
+func TestRetiresVNIWithoutLogicalSwitch(t *testing.T) {
+	f := newFixture(t)
+	frr := newTeardownFrr("test", "node-1")
+	frr.DeletionTimestamp = nil
+	// The VNI changes and is no longer bridged in the same update, the
+	// one connect-frr set up before is removed all the same
+	frr.Spec.VNIs[0].ID = testMinVNI + 1
+	frr.Spec.VNIs[0].LogicalSwitch = ""
+	d := mustNewDeployment(t, frr, testMinASN, nil, nil)
+	d.Status.Replicas = 1
+	d.Status.UpdatedReplicas = 1
+
+	f.nodeLister = append(f.nodeLister, newNode("node-1"))
+	c, _, _ := f.newController()
+	manager := defaultPoolManager(c, vniPoolKind)
+	manager.Reserve(getKey(frr, t)+"/blue", testMinVNI)
+
+	if _, _, _, err := c.allocateNumbers(frr); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := manager.Get(retiredAllocationName(getKey(frr, t), testMinVNI)); !ok {
+		t.Fatalf("expected VNI %d to be retired, got %v", testMinVNI, manager.Held(getKey(frr, t)))
+	}
+	if err := c.releaseRetiredVNIs(frr, d); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	f.expectCreateJobAction(newTeardownJob(frr, "node-1", []corev1.EnvVar{{Name: vnisEnv, Value: "retired:1000::"}}))
+	if actions := filterInformerActions(f.kubeclient.Actions()); len(actions) != 1 {
+		t.Fatalf("expected a single action, got %+v", actions)
+	} else {
+		checkAction(f.kubeactions[0], actions[0], t)
+	}
+}
+
+func TestRetiredVNIStatus(t *testing.T) {
+	f := newFixture(t)
+	frr := newTeardownFrr("test", "node-1")
+	frr.DeletionTimestamp = nil
+	frr.Status.RetiredVNIs = []frrcontroller.RetiredVNIStatus{
+		{VNI: testMinVNI, Nodes: []string{"node-1"}},
+		// released since
+		{VNI: testMinVNI + 5, Nodes: []string{"node-1"}},
+	}
+
+	c, _, _ := f.newController()
+	manager := defaultPoolManager(c, vniPoolKind)
+	manager.Reserve(retiredAllocationName(getKey(frr, t), testMinVNI), testMinVNI)
+	manager.Reserve(retiredAllocationName(getKey(frr, t), testMinVNI+2), testMinVNI+2)
+
+	// The VNI retired before keeps the nodes it was set up on, the newly
+	// retired one was set up on every node holding the network
+	pod := newPod(frr, "test-a", "node-2", "10.0.0.2", corev1.ConditionTrue)
+	pod.Spec.InitContainers = []corev1.Container{{Name: networkSetupContainerName}}
+	nodes := networkNodes(frr, []*corev1.Pod{pod, newPod(frr, "test-b", "node-3", "10.0.0.3", corev1.ConditionTrue)})
+	if expected := []string{"node-1", "node-2"}; !reflect.DeepEqual(nodes, expected) {
+		t.Errorf("expected network nodes %v, got %v", expected, nodes)
+	}
+	expected := []frrcontroller.RetiredVNIStatus{
+		{VNI: testMinVNI, Nodes: []string{"node-1"}},
+		{VNI: testMinVNI + 2, Nodes: []string{"node-1", "node-2"}},
+	}
+	if retired := c.retiredVNIStatus(frr, nodes); !reflect.DeepEqual(retired, expected) {
+		t.Errorf("expected %+v, got %+v", expected, retired)
+	}
+}
+
+func TestReusesRetiredVNI(t *testing.T) {
+	f := newFixture(t)
+	frr := newTeardownFrr("test", "node-1")
+	frr.DeletionTimestamp = nil
+	frr.Spec.VNIs[0].ID = testMinVNI
+
+	c, _, _ := f.newController()
+	manager := defaultPoolManager(c, vniPoolKind)
+	manager.Reserve(getKey(frr, t)+"/blue", testMinVNI+1)
+	manager.Reserve(retiredAllocationName(getKey(frr, t), testMinVNI), testMinVNI)
+
+	if _, _, _, err := c.allocateNumbers(frr); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	held := manager.Held(getKey(frr, t))
+	expected := map[string]int{
+		getKey(frr, t) + "/blue":                            testMinVNI,
+		retiredAllocationName(getKey(frr, t), testMinVNI+1): testMinVNI + 1,
+	}
+	if !reflect.DeepEqual(held, expected) {
+		t.Errorf("expected %v, got %v", expected, held)
+	}
+}
+
+func TestEnqueueDeletedFrrTombstone(t *testing.T) {
+	f := newFixture(t)
+	frr := newFrr("test", int32Ptr(1))
+	c, _, _ := f.newController()
+
+	c.enqueueDeletedFrr(cache.DeletedFinalStateUnknown{Key: getKey(frr, t), Obj: frr})
+	if c.workqueue.Len() != 1 {
+		t.Fatalf("expected the tombstone to be enqueued, queue length %d", c.workqueue.Len())
+	}
+	key, _ := c.workqueue.Get()
+	if key != getKey(frr, t) {
+		t.Errorf("expected key %s, got %v", getKey(frr, t), key)
+	}
+}
+
+func TestRecoverAllocations(t *testing.T) {
+	f := newFixture(t)
+	older := newFrr("older", int32Ptr(1))
+	older.CreationTimestamp = metav1.NewTime(time.Unix(100, 0))
+	newer := newFrr("newer", int32Ptr(1))
+	newer.CreationTimestamp = metav1.NewTime(time.Unix(200, 0))
+	olderDepl := mustNewDeployment(t, older, testMinASN+1, specVNI(testMinVNI+5), nil)
+	// The newer Frr claims the same VNI, which must be flagged
+	newerDepl := mustNewDeployment(t, newer, testMinASN+2, specVNI(testMinVNI+5), nil)
+
+	f.frrLister = append(f.frrLister, older, newer)
+	f.deploymentLister = append(f.deploymentLister, olderDepl, newerDepl)
+
+	c, _, _ := f.newController()
+	recorder := record.NewFakeRecorder(10)
+	c.recorder = recorder
+	if err := c.recoverAllocations(); err != nil {
+		t.Fatalf("unexpected error recovering allocations: %v", err)
+	}
+
+	if vni, ok := defaultPoolManager(c, vniPoolKind).Get(getKey(older, t)); !ok || vni != testMinVNI+5 {
+		t.Errorf("expected older frr to hold VNI %d, got %d (%v)", testMinVNI+5, vni, ok)
+	}
+	if _, ok := defaultPoolManager(c, vniPoolKind).Get(getKey(newer, t)); ok {
+		t.Errorf("expected newer frr to hold no VNI")
+	}
+	if asn, ok := defaultPoolManager(c, asnPoolKind).Get(getKey(newer, t)); !ok || asn != testMinASN+2 {
+		t.Errorf("expected newer frr to hold ASN %d, got %d (%v)", testMinASN+2, asn, ok)
+	}
+
+	select {
+	case event := <-recorder.Events:
+		if !strings.Contains(event, ErrAllocationConflict) {
+			t.Errorf("expected %s event, got %q", ErrAllocationConflict, event)
+		}
+	default:
+		t.Errorf("expected a %s event", ErrAllocationConflict)
+	}
+
+	// A freshly allocated VNI must skip the recovered one
+	vni, err := defaultPoolManager(c, vniPoolKind).Allocate("default/another")
+	if err != nil {
+		t.Fatalf("unexpected error allocating VNI: %v", err)
+	}
+	if vni == testMinVNI+5 {
+		t.Errorf("allocated VNI %d which is already in use", vni)
+	}
+}
+
+func TestRecoverAllocatedASN(t *testing.T) {
+	f := newFixture(t)
+	// Neither Frr sets spec.asNumber, their ASNs were taken from the pool
+	current := newFrr("current", int32Ptr(1))
+	currentDepl := mustNewDeployment(t, current, testMinASN+7, specVNI(testMinVNI), nil)
+	// A Deployment built when ASNUMBER held spec.asNumber
+	legacy := newFrr("legacy", int32Ptr(1))
+	legacy.Status.ASNumber = testMinASN + 8
+	legacyDepl := mustNewDeployment(t, legacy, testMinASN+8, specVNI(testMinVNI+1), nil)
+	for i := range legacyDepl.Spec.Template.Spec.Containers[0].Env {
+		if env := &legacyDepl.Spec.Template.Spec.Containers[0].Env[i]; env.Name == "ASNUMBER" {
+			env.Value = "0"
+		}
+	}
+
+	f.frrLister = append(f.frrLister, current, legacy)
+	f.deploymentLister = append(f.deploymentLister, currentDepl, legacyDepl)
+
+	c, _, _ := f.newController()
+	if err := c.recoverAllocations(); err != nil {
+		t.Fatalf("unexpected error recovering allocations: %v", err)
+	}
+	for frr, expected := range map[*frrcontroller.Frr]int{current: testMinASN + 7, legacy: testMinASN + 8} {
+		if asn, ok := defaultPoolManager(c, asnPoolKind).Get(getKey(frr, t)); !ok || asn != expected {
+			t.Errorf("expected frr %s to hold ASN %d, got %d (%v)", frr.Name, expected, asn, ok)
+		}
+	}
+}
+
+func TestRecoverVNIs(t *testing.T) {
+	f := newFixture(t)
+	frr := newFrr("test", int32Ptr(1))
+	frr.Spec.VNIs = []frrcontroller.L2VNI{{Name: "blue"}, {Name: "red"}}
+	frr.Spec.VRFs = []frrcontroller.VRF{{Name: "tenant-a", RouterMAC: "02:00:00:00:00:01"}}
+	vnis := specL2VNIs(frr)
+	vnis[0].number = testMinVNI + 3
+	vnis[1].number = testMinVNI + 7
+	vrfs := specL3VNIs(frr)
+	vrfs[0].number = testMinVNI + 9
+	d := mustNewDeployment(t, frr, testMinASN, vnis, vrfs)
+
+	f.frrLister = append(f.frrLister, frr)
+	f.deploymentLister = append(f.deploymentLister, d)
+
+	c, _, _ := f.newController()
+	if err := c.recoverAllocations(); err != nil {
+		t.Fatalf("unexpected error recovering allocations: %v", err)
+	}
+
+	held := defaultPoolManager(c, vniPoolKind).Held(getKey(frr, t))
+	expected := map[string]int{
+		getKey(frr, t) + "/blue":                      testMinVNI + 3,
+		getKey(frr, t) + "/red":                       testMinVNI + 7,
+		vrfAllocationName(getKey(frr, t), "tenant-a"): testMinVNI + 9,
+	}
+	if !reflect.DeepEqual(held, expected) {
+		t.Errorf("expected the frr to hold %v, got %v", expected, held)
+	}
+}
+
+func TestPersistAllocations(t *testing.T) {
+	storageClient := newResourceVersionedClientset()
+	storage := rangemanager.NewConfigMapStorage(storageClient, metav1.NamespaceDefault, "allocations")
+
+	f := newFixture(t)
+	f.allocationStorage = storage
+	first, _, _ := f.newController()
+	vni, err := defaultPoolManager(first, vniPoolKind).Allocate("default/first")
+	if err != nil {
+		t.Fatalf("unexpected error allocating VNI: %v", err)
+	}
+	if err := first.persistAllocations(); err != nil {
+		t.Fatalf("unexpected error persisting allocations: %v", err)
+	}
+
+	// A second controller sharing the storage, e.g. after a restart
+	f = newFixture(t)
+	f.allocationStorage = rangemanager.NewConfigMapStorage(storageClient, metav1.NamespaceDefault, "allocations")
+	second, _, _ := f.newController()
+	if err := second.restoreAllocations(); err != nil {
+		t.Fatalf("unexpected error restoring allocations: %v", err)
+	}
+	if got, ok := defaultPoolManager(second, vniPoolKind).Get("default/first"); !ok || got != vni {
+		t.Errorf("expected restored VNI %d, got %d (%v)", vni, got, ok)
+	}
+	next, err := defaultPoolManager(second, vniPoolKind).Allocate("default/second")
+	if err != nil {
+		t.Fatalf("unexpected error allocating VNI: %v", err)
+	}
+	if next == vni {
+		t.Errorf("allocated VNI %d which is already in use", next)
+	}
+	if err := second.persistAllocations(); err != nil {
+		t.Fatalf("unexpected error persisting allocations: %v", err)
+	}
+
+}
+
+func TestPersistAllocationsConflict(t *testing.T) {
+	storageClient := newResourceVersionedClientset()
+	storage := rangemanager.NewConfigMapStorage(storageClient, metav1.NamespaceDefault, "allocations")
+
+	f := newFixture(t)
+	f.allocationStorage = storage
+	leader, _, _ := f.newController()
+	manager := defaultPoolManager(leader, vniPoolKind)
+	vni, err := manager.Allocate("default/released")
+	if err != nil {
+		t.Fatalf("unexpected error allocating VNI: %v", err)
+	}
+	if err := leader.persistAllocations(); err != nil {
+		t.Fatalf("unexpected error persisting allocations: %v", err)
+	}
+
+	// Someone else writes the stored state, which still holds the VNI
+	other := rangemanager.NewConfigMapStorage(storageClient, metav1.NamespaceDefault, "allocations")
+	snapshots, err := other.Load()
+	if err != nil {
+		t.Fatalf("unexpected error loading allocations: %v", err)
+	}
+	if err := other.Save(snapshots); err != nil {
+		t.Fatalf("unexpected error saving allocations: %v", err)
+	}
+
+	// The save of the leader conflicts, its released VNI must stay free
+	manager.Release("default/released")
+	if err := leader.persistAllocations(); err != nil {
+		t.Fatalf("unexpected error persisting allocations: %v", err)
+	}
+	if owner, ok := manager.Owner(vni); ok {
+		t.Errorf("expected VNI %d to be free, held by %s", vni, owner)
+	}
+	snapshots, err = other.Load()
+	if err != nil {
+		t.Fatalf("unexpected error loading allocations: %v", err)
+	}
+	if got, ok := snapshots[vniPoolKind+"/"+defaultPool].Names["default/released"]; ok {
+		t.Errorf("expected the released VNI to be dropped from the stored state, got %d", got)
+	}
+	if next, err := manager.Allocate("default/next"); err != nil || next != vni {
+		t.Errorf("expected the released VNI %d to be allocated again, got %d (%v)", vni, next, err)
+	}
+}
+
+// newResourceVersionedClientset returns a fake clientset which, unlike the
+// default object tracker, bumps the resourceVersion of ConfigMaps on every
+// write and rejects updates carrying a stale one.
+func newResourceVersionedClientset() *k8sfake.Clientset {
+	client := k8sfake.NewSimpleClientset()
+	gvr := corev1.SchemeGroupVersion.WithResource("configmaps")
+	version := 0
+	write := func(action core.Action) (bool, runtime.Object, error) {
+		cm := action.(core.CreateAction).GetObject().(*corev1.ConfigMap).DeepCopy()
+		current, err := client.Tracker().Get(gvr, cm.Namespace, cm.Name)
+		switch {
+		case action.GetVerb() == "create" && err == nil:
+			return true, nil, errors.NewAlreadyExists(gvr.GroupResource(), cm.Name)
+		case action.GetVerb() == "update" && err != nil:
+			return true, nil, err
+		case action.GetVerb() == "update" && current.(*corev1.ConfigMap).ResourceVersion != cm.ResourceVersion:
+			return true, nil, errors.NewConflict(gvr.GroupResource(), cm.Name, fmt.Errorf("stale resourceVersion"))
+		}
+		version++
+		cm.ResourceVersion = strconv.Itoa(version)
+		if action.GetVerb() == "create" {
+			return true, cm, client.Tracker().Create(gvr, cm, cm.Namespace)
+		}
+		return true, cm, client.Tracker().Update(gvr, cm, cm.Namespace)
+	}
+	client.PrependReactor("create", "configmaps", write)
+	client.PrependReactor("update", "configmaps", write)
+	return client
+}
+
+func newVNIPool(name string, start, end int) *frrcontroller.VNIPool {
+	return &frrcontroller.VNIPool{
+		TypeMeta:   metav1.TypeMeta{APIVersion: frrcontroller.SchemeGroupVersion.String()},
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec:       frrcontroller.PoolSpec{Start: start, End: end},
+	}
+}
+
+func (f *fixture) expectUpdateVNIPoolStatusAction(pool *frrcontroller.VNIPool) {
+	action := core.NewRootUpdateSubresourceAction(schema.GroupVersionResource{Resource: "vnipools"}, "status", pool)
+	f.actions = append(f.actions, action)
+}
+
+// defaultPoolManager returns the allocator of the default pool of a kind
+func defaultPoolManager(c *Controller, kind string) *rangemanager.RangeManager {
+	pools, _ := c.pools(kind)
+	manager, _ := pools.Get(defaultPool)
+	return manager
+}
+
+func TestPoolStatus(t *testing.T) {
+	f := newFixture(t)
+	pool := newVNIPool("tenant", 5000, 5009)
+	frr := newFrr("test", int32Ptr(1))
+	frr.Spec.VNIPool = pool.Name
+
+	f.vniPoolLister = append(f.vniPoolLister, pool)
+	f.objects = append(f.objects, pool)
+	c, _, _ := f.newController()
+
+	manager, ok := c.vniPools.Get(pool.Name)
+	if !ok {
+		t.Fatalf("expected pool %s to be built", pool.Name)
+	}
+	vni, err := manager.Allocate(getKey(frr, t))
+	if err != nil || vni != 5000 {
+		t.Fatalf("expected VNI 5000 from pool %s, got %d (%v)", pool.Name, vni, err)
+	}
+
+	expPool := pool.DeepCopy()
+	expPool.Status = frrcontroller.PoolStatus{Start: 5000, End: 5009, Used: 1, Free: 9,
+		Conditions: []metav1.Condition{resizedCondition(metav1.ConditionTrue, ReasonRangeApplied, "5000-5009")}}
+	f.expectUpdateVNIPoolStatusAction(expPool)
+	f.client.ClearActions()
+	if err := c.syncPool(vniPoolKind + "/" + pool.Name); err != nil {
+		t.Fatalf("unexpected error syncing pool: %v", err)
+	}
+	actions := filterInformerActions(f.client.Actions())
+	if len(actions) != len(f.actions) {
+		t.Fatalf("expected %d actions, got %+v", len(f.actions), actions)
+	}
+	for i, action := range actions {
+		checkAction(f.actions[i], action, t)
+	}
+}
+
+func resizedCondition(status metav1.ConditionStatus, reason, message string) metav1.Condition {
+	return metav1.Condition{
+		Type:    frrcontroller.PoolConditionResized,
+		Status:  status,
+		Reason:  reason,
+		Message: message,
+	}
+}
+
+func TestPoolShrinkRefused(t *testing.T) {
+	f := newFixture(t)
+	pool := newVNIPool("tenant", 5000, 5009)
+	f.vniPoolLister = append(f.vniPoolLister, pool)
+	f.objects = append(f.objects, pool)
+	c, i, _ := f.newController()
+	recorder := record.NewFakeRecorder(10)
+	c.recorder = recorder
+
+	manager, _ := c.vniPools.Get(pool.Name)
+	if err := manager.Reserve("default/test", 5008); err != nil {
+		t.Fatalf("unexpected error reserving VNI: %v", err)
+	}
+
+	// Shrinking below the allocated VNI must be refused
+	shrunk := pool.DeepCopy()
+	shrunk.Spec.End = 5005
+	i.Frrcontroller().V1alpha1().VNIPools().Informer().GetIndexer().Update(shrunk)
+	c.syncPool(vniPoolKind + "/" + pool.Name)
+	if manager.Max() != 5009 {
+		t.Errorf("expected pool to keep its range up to 5009, got %d", manager.Max())
+	}
+	select {
+	case event := <-recorder.Events:
+		if !strings.Contains(event, ErrPoolShrinkRefused) {
+			t.Errorf("expected %s event, got %q", ErrPoolShrinkRefused, event)
+		}
+	default:
+		t.Errorf("expected a %s event", ErrPoolShrinkRefused)
+	}
+	// The status keeps the range in effect and tells why
+	refused, err := f.client.FrrcontrollerV1alpha1().VNIPools().Get(context.TODO(), pool.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if refused.Status.End != 5009 {
+		t.Errorf("expected the status to keep the range up to 5009, got %d", refused.Status.End)
+	}
+	condition := meta.FindStatusCondition(refused.Status.Conditions, frrcontroller.PoolConditionResized)
+	if condition == nil || condition.Status != metav1.ConditionFalse || condition.Reason != ReasonShrinkRefused {
+		t.Errorf("expected the %s condition to be false with reason %s, got %+v", frrcontroller.PoolConditionResized, ReasonShrinkRefused, condition)
+	}
+
+	// Growing it is fine
+	grown := refused.DeepCopy()
+	grown.Spec.End = 5100
+	i.Frrcontroller().V1alpha1().VNIPools().Informer().GetIndexer().Update(grown)
+	c.syncPool(vniPoolKind + "/" + pool.Name)
+	if manager.Max() != 5100 {
+		t.Errorf("expected pool to grow up to 5100, got %d", manager.Max())
+	}
+	if vni, ok := manager.Get("default/test"); !ok || vni != 5008 {
+		t.Errorf("expected VNI 5008 to survive the resize, got %d (%v)", vni, ok)
+	}
+	grown, err = f.client.FrrcontrollerV1alpha1().VNIPools().Get(context.TODO(), pool.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	condition = meta.FindStatusCondition(grown.Status.Conditions, frrcontroller.PoolConditionResized)
+	if condition == nil || condition.Status != metav1.ConditionTrue || condition.Reason != ReasonRangeApplied {
+		t.Errorf("expected the %s condition to be true with reason %s, got %+v", frrcontroller.PoolConditionResized, ReasonRangeApplied, condition)
+	}
+}
+
+func TestPoolAddedEnqueuesFrrs(t *testing.T) {
+	f := newFixture(t)
+	frr := newFrr("test", int32Ptr(1))
+	frr.Spec.VNIPool = "tenant"
+	other := newFrr("other", int32Ptr(1))
+	f.frrLister = append(f.frrLister, frr, other)
+	f.objects = append(f.objects, frr, other)
+	c, i, _ := f.newController()
+
+	// The Frr failed to find its pool, which is created afterwards
+	pool, err := f.client.FrrcontrollerV1alpha1().VNIPools().Create(context.TODO(), newVNIPool("tenant", 5000, 5009), metav1.CreateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	i.Frrcontroller().V1alpha1().VNIPools().Informer().GetIndexer().Add(pool)
+	if err := c.syncPool(vniPoolKind + "/" + pool.Name); err != nil {
+		t.Fatalf("unexpected error syncing pool: %v", err)
+	}
+	if c.workqueue.Len() != 1 {
+		t.Fatalf("expected 1 Frr to be enqueued, got %d", c.workqueue.Len())
+	}
+	if key, _ := c.workqueue.Get(); key != getKey(frr, t) {
+		t.Errorf("expected %s to be enqueued, got %v", getKey(frr, t), key)
+	}
+}
+
+func TestPoolUsage(t *testing.T) {
+	f := newFixture(t)
+	c, _, _ := f.newController()
+	if _, err := defaultPoolManager(c, vniPoolKind).Allocate("default/test"); err != nil {
+		t.Fatalf("unexpected error allocating VNI: %v", err)
+	}
+
+	usage := make(map[string]metrics.PoolUsage)
+	for _, pool := range c.poolUsage() {
+		usage[pool.Kind+"/"+pool.Name] = pool
+	}
+	exp := map[string]metrics.PoolUsage{
+		"VNIPool/default": {Kind: vniPoolKind, Name: defaultPool, Used: 1, Free: testMaxVNI - testMinVNI},
+		"ASNPool/default": {Kind: asnPoolKind, Name: defaultPool, Used: 0, Free: testMaxASN - testMinASN + 1},
+	}
+	if !reflect.DeepEqual(exp, usage) {
+		t.Errorf("expected pool usage %+v, got %+v", exp, usage)
+	}
+}
+
+func TestProcessNextWorkItemRecordsReconcile(t *testing.T) {
+	f := newFixture(t)
+	c, _, _ := f.newController()
+	before := reconcileTotal(t, "success")
+
+	// A Frr deleted before it was synced has nothing left to release
+	c.workqueue.Add("default/missing")
+	if !c.processNextWorkItem() {
+		t.Fatal("expected the workqueue to keep running")
+	}
+	if got := reconcileTotal(t, "success") - before; got != 1 {
+		t.Errorf("expected 1 successful reconcile to be recorded, got %v", got)
+	}
+}
+
+// reconcileTotal returns the number of reconciles with the given result
+// reported by the metrics registry
+func reconcileTotal(t *testing.T, result string) float64 {
+	families, err := metrics.Registry.Gather()
+	if err != nil {
+		t.Fatalf("unexpected error gathering metrics: %v", err)
+	}
+	for _, family := range families {
+		if family.GetName() != "frr_controller_reconcile_total" {
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			for _, label := range m.GetLabel() {
+				if label.GetName() == "result" && label.GetValue() == result {
+					return m.GetCounter().GetValue()
+				}
+			}
+		}
+	}
+	return 0
 }
 
 func int32Ptr(i int32) *int32 { return &i }
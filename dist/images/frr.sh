@@ -11,12 +11,16 @@ frrlogdir=/var/log/frr-controller
 # Environment variables are used to customize operation
 # VNI_RANGE - the vni allocation range
 # ASN_RANGE - the asn allocation range for l2vpn
+# WEBHOOK_ADDRESS - the address the validating webhook is served on (not served if empty)
+# WEBHOOK_CERT_DIR - the directory holding tls.crt and tls.key of the webhook
 # LOGFILE_MAXSIZE - log file max size in MB(default 100 MB)
 # LOGFILE_MAXBACKUPS - log file max backups (default 5)
 # LOGFILE_MAXAGE - log file max age in days (default 5 days)
 
 vni_range=${VNI_RANGE:-"1000-2000"}
 asn_range=${ASN_RANGE:-"65001-65534"}
+webhook_address=${WEBHOOK_ADDRESS:-""}
+webhook_cert_dir=${WEBHOOK_CERT_DIR:-"/etc/frr-controller/webhook"}
 
 display_version() {
   echo " =================== Frr pod name: ${frr_pod_name}"
@@ -30,9 +34,16 @@ display_version() {
 # run frr controller
 frr-controller() {
   echo "=============== frr-controller =============== "
+  webhook_flags=""
+  if [[ -n ${webhook_address} ]]; then
+    webhook_flags="--webhook_address=${webhook_address} \
+      --webhook_cert_file=${webhook_cert_dir}/tls.crt \
+      --webhook_key_file=${webhook_cert_dir}/tls.key"
+  fi
   /usr/bin/frr-controller \
     --asn_range=${asn_range} \
     --vni_range=${vni_range} \
+    ${webhook_flags} \
     --log_dir=${frrlogdir} \
     --log_file=${frrlogdir}/frr-controller.log
 
@@ -0,0 +1,200 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+
+	frrv1alpha1 "github.com/guohao117/frr-controller/pkg/apis/frrcontroller/v1alpha1"
+)
+
+// frrFinalizer keeps a Frr around until its Deployment is gone and its VNI
+// and ASN are given back to their pools.
+const frrFinalizer = "frrcontroller.nocsys.cn/allocation"
+
+func hasFinalizer(frr *frrv1alpha1.Frr) bool {
+	for _, f := range frr.Finalizers {
+		if f == frrFinalizer {
+			return true
+		}
+	}
+	return false
+}
+
+// addFinalizer adds frrFinalizer to the Frr and returns the updated object
+func (c *Controller) addFinalizer(frr *frrv1alpha1.Frr) (*frrv1alpha1.Frr, error) {
+	// NEVER modify objects from the store. It's a read-only, local cache.
+	frrCopy := frr.DeepCopy()
+	frrCopy.Finalizers = append(frrCopy.Finalizers, frrFinalizer)
+	return c.frrclientset.FrrcontrollerV1alpha1().Frrs(frr.Namespace).Update(context.TODO(), frrCopy, metav1.UpdateOptions{})
+}
+
+func (c *Controller) removeFinalizer(frr *frrv1alpha1.Frr) error {
+	frrCopy := frr.DeepCopy()
+	frrCopy.Finalizers = nil
+	for _, f := range frr.Finalizers {
+		if f != frrFinalizer {
+			frrCopy.Finalizers = append(frrCopy.Finalizers, f)
+		}
+	}
+	_, err := c.frrclientset.FrrcontrollerV1alpha1().Frrs(frr.Namespace).Update(context.TODO(), frrCopy, metav1.UpdateOptions{})
+	return err
+}
+
+// finalizeFrr tears down a Frr which is being deleted. Its Deployment is
+// deleted first, and only once the informer confirms it and its pods are
+// gone are the VNI and ASN released and the finalizer removed. The Deployment
+// and pod informers requeue the Frr when they go away. If connect-frr built
+// the network of the Frr, a teardown Job removes it from every node the Frr
+// ran on before anything is released.
+func (c *Controller) finalizeFrr(frr *frrv1alpha1.Frr) error {
+	if !hasFinalizer(frr) {
+		return nil
+	}
+	key := frr.Namespace + "/" + frr.Name
+
+	if frr.Spec.DeploymentName != "" {
+		deployment, err := c.deploymentsLister.Deployments(frr.Namespace).Get(frr.Spec.DeploymentName)
+		if err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+		if err == nil && metav1.IsControlledBy(deployment, frr) {
+			if deployment.DeletionTimestamp == nil {
+				klog.Infof("Deleting deployment '%s/%s' of frr '%s'", deployment.Namespace, deployment.Name, key)
+				propagation := metav1.DeletePropagationBackground
+				err := c.kubeclientset.AppsV1().Deployments(deployment.Namespace).Delete(context.TODO(), deployment.Name, metav1.DeleteOptions{
+					PropagationPolicy: &propagation,
+				})
+				if err != nil && !errors.IsNotFound(err) {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+
+	pods, err := c.podsLister.Pods(frr.Namespace).List(labels.SelectorFromSet(podLabels(frr)))
+	if err != nil {
+		return err
+	}
+	if nodes := networkNodes(frr, pods); len(nodes) > 0 {
+		if len(pods) > 0 {
+			// The network is torn down from the nodes in the status
+			// once the pods are gone
+			if len(nodes) > len(frr.Status.NetworkNodes) {
+				frrCopy := frr.DeepCopy()
+				frrCopy.Status.NetworkNodes = nodes
+				_, err := c.frrclientset.FrrcontrollerV1alpha1().Frrs(frr.Namespace).UpdateStatus(context.TODO(), frrCopy, metav1.UpdateOptions{})
+				return err
+			}
+			klog.V(4).Infof("Waiting for the pods of frr '%s' to go away", key)
+			return nil
+		}
+		done, err := c.syncTeardown(frr, c.teardownNetworks(frr, true), false)
+		if err != nil || !done {
+			return err
+		}
+	}
+
+	if err := c.releaseAllocations(key); err != nil {
+		return err
+	}
+	return c.removeFinalizer(frr)
+}
+
+// releaseDeletedFrr gives back the numbers held by a Frr which is gone
+// without its finalizer running. If connect-frr built its network, its VNIs
+// are retired and only released once teardown Jobs removed them from the
+// nodes in the last status seen of the Frr. The orphaned Jobs tell what is
+// left to remove when the controller restarts in between.
+func (c *Controller) releaseDeletedFrr(key string) error {
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return err
+	}
+	c.deletedFrrsLock.Lock()
+	frr, ok := c.deletedFrrs[key]
+	c.deletedFrrsLock.Unlock()
+	if !ok {
+		frr = &frrv1alpha1.Frr{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name}}
+	}
+
+	var networks map[string][]corev1.EnvVar
+	if ok && tearsDownNetwork(frr) {
+		if err := c.retireAllVNIs(frr); err != nil {
+			return err
+		}
+		frr.Status.RetiredVNIs = c.retiredVNIStatus(frr, frr.Status.NetworkNodes)
+		networks = c.teardownNetworks(frr, false)
+	} else {
+		jobs, err := c.teardownJobs(frr, true)
+		if err != nil {
+			return err
+		}
+		networks = make(map[string][]corev1.EnvVar)
+		for _, job := range jobs {
+			networks[job.Annotations[teardownNodeAnnotation]] = job.Spec.Template.Spec.Containers[0].Env
+		}
+	}
+	done, err := c.syncTeardown(frr, networks, true)
+	if err != nil || !done {
+		return err
+	}
+
+	if err := c.releaseAllocations(key); err != nil {
+		return err
+	}
+	if err := c.deleteTeardownJobs(frr, true); err != nil {
+		return err
+	}
+	c.deletedFrrsLock.Lock()
+	delete(c.deletedFrrs, key)
+	c.deletedFrrsLock.Unlock()
+	return nil
+}
+
+// retireAllVNIs retires every VNI the Frr holds, so that none is handed out
+// before it is removed from the nodes
+func (c *Controller) retireAllVNIs(frr *frrv1alpha1.Frr) error {
+	manager, err := c.rangeManagerFor(frr, vniPoolKind)
+	if err != nil {
+		// the pool and its numbers are gone
+		return nil
+	}
+	frrscopedName := frr.Namespace + "/" + frr.Name
+	retired := false
+	for name, number := range manager.Held(frrscopedName) {
+		if isRetiredAllocationName(frrscopedName, name) {
+			continue
+		}
+		if err := c.retireVNI(frr, name, number); err != nil {
+			return err
+		}
+		retired = true
+	}
+	if !retired {
+		return nil
+	}
+	return c.persistAllocations()
+}
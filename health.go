@@ -0,0 +1,99 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/leaderelection"
+
+	"github.com/guohao117/frr-controller/pkg/metrics"
+)
+
+// leaderStatus tracks the leader election of this replica for the health
+// checks
+type leaderStatus struct {
+	// enabled is false if the replica runs without leader election
+	enabled bool
+	leading atomic.Bool
+	// watchdog fails the liveness check when the leader stops renewing
+	// its Lease
+	watchdog *leaderelection.HealthzAdaptor
+}
+
+func newLeaderStatus(enabled bool, renewDeadline time.Duration) *leaderStatus {
+	return &leaderStatus{
+		enabled:  enabled,
+		watchdog: leaderelection.NewLeaderHealthzAdaptor(renewDeadline),
+	}
+}
+
+// ready returns an error until the controller may serve: its informer
+// caches are synced and, if it leads, its allocators restored. A replica
+// which does not hold the Lease serves the validating webhook from its
+// caches and never restores its allocators.
+func (c *Controller) ready(leading bool) error {
+	for name, synced := range map[string]cache.InformerSynced{
+		"deployments": c.deploymentsSynced,
+		"pods":        c.podsSynced,
+		"secrets":     c.secretsSynced,
+		"frrs":        c.frrsSynced,
+		"vnipools":    c.vniPoolsSynced,
+		"asnpools":    c.asnPoolsSynced,
+		"jobs":        c.jobsSynced,
+		"nodes":       c.nodesSynced,
+	} {
+		if !synced() {
+			return fmt.Errorf("%s cache not synced", name)
+		}
+	}
+	if leading && !c.allocationsRestored.Load() {
+		return fmt.Errorf("allocations not restored")
+	}
+	return nil
+}
+
+// newHTTPHandler serves the metrics and the liveness and readiness checks of
+// the controller
+func newHTTPHandler(c *Controller, leader *leaderStatus) http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		if leader.enabled {
+			if err := leader.watchdog.Check(r); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+		fmt.Fprint(w, "ok")
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		// Every replica is ready once synced, so that a rolling update
+		// does not wait for the new replicas to take the Lease over
+		leading := !leader.enabled || leader.leading.Load()
+		if err := c.ready(leading); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, "ok")
+	})
+	return mux
+}
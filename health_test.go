@@ -0,0 +1,92 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestReadyz(t *testing.T) {
+	f := newFixture(t)
+	c, _, _ := f.newController()
+	c.vniPoolsSynced = alwaysReady
+	c.asnPoolsSynced = alwaysReady
+	leader := newLeaderStatus(true, 10*time.Second)
+	handler := newHTTPHandler(c, leader)
+
+	readyz := func() int {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		return rec.Code
+	}
+
+	if code := readyz(); code != http.StatusOK {
+		t.Errorf("expected a synced replica which does not lead to be ready, got %d", code)
+	}
+	leader.leading.Store(true)
+	if code := readyz(); code != http.StatusServiceUnavailable {
+		t.Errorf("expected a replica which did not restore its allocations not to be ready, got %d", code)
+	}
+	c.allocationsRestored.Store(true)
+	if code := readyz(); code != http.StatusOK {
+		t.Errorf("expected the leader to be ready, got %d", code)
+	}
+	c.frrsSynced = func() bool { return false }
+	if code := readyz(); code != http.StatusServiceUnavailable {
+		t.Errorf("expected a replica with unsynced caches not to be ready, got %d", code)
+	}
+	leader.leading.Store(false)
+	if code := readyz(); code != http.StatusServiceUnavailable {
+		t.Errorf("expected a replica which does not lead with unsynced caches not to be ready, got %d", code)
+	}
+}
+
+func TestReadyzWithoutLeaderElection(t *testing.T) {
+	f := newFixture(t)
+	c, _, _ := f.newController()
+	c.vniPoolsSynced = alwaysReady
+	c.asnPoolsSynced = alwaysReady
+	handler := newHTTPHandler(c, newLeaderStatus(false, 10*time.Second))
+
+	readyz := func() int {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		return rec.Code
+	}
+	if code := readyz(); code != http.StatusServiceUnavailable {
+		t.Errorf("expected a replica which did not restore its allocations not to be ready, got %d", code)
+	}
+	c.allocationsRestored.Store(true)
+	if code := readyz(); code != http.StatusOK {
+		t.Errorf("expected the replica to be ready, got %d", code)
+	}
+}
+
+func TestHealthz(t *testing.T) {
+	f := newFixture(t)
+	c, _, _ := f.newController()
+	handler := newHTTPHandler(c, newLeaderStatus(true, 10*time.Second))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected a replica without a Lease to be healthy, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,87 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"k8s.io/klog/v2"
+)
+
+// leaderElectionConfig holds the leader election settings given on the
+// command line
+type leaderElectionConfig struct {
+	namespace     string
+	name          string
+	identity      string
+	leaseDuration time.Duration
+	renewDeadline time.Duration
+	retryPeriod   time.Duration
+}
+
+// runWithLeaderElection calls run once this replica holds the Lease and
+// cancels the context given to run when the Lease is lost. The allocators
+// of a replica are only valid while it leads, so losing the Lease exits the
+// process, and the allocator state is rebuilt from the cluster by Run when
+// the restarted replica acquires it again.
+func runWithLeaderElection(ctx context.Context, client kubernetes.Interface, config leaderElectionConfig, status *leaderStatus, run func(ctx context.Context)) {
+	lock := &resourcelock.LeaseLock{
+		LeaseMeta: metav1.ObjectMeta{
+			Name:      config.name,
+			Namespace: config.namespace,
+		},
+		Client: client.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{
+			Identity: config.identity,
+		},
+	}
+
+	leaderelection.RunOrDie(ctx, leaderelection.LeaderElectionConfig{
+		Lock:            lock,
+		ReleaseOnCancel: true,
+		WatchDog:        status.watchdog,
+		LeaseDuration:   config.leaseDuration,
+		RenewDeadline:   config.renewDeadline,
+		RetryPeriod:     config.retryPeriod,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(ctx context.Context) {
+				klog.Infof("Acquired lease %s/%s as %s", config.namespace, config.name, config.identity)
+				status.leading.Store(true)
+				run(ctx)
+			},
+			OnStoppedLeading: func() {
+				status.leading.Store(false)
+				if ctx.Err() != nil {
+					// Shutting down, the lease was released on purpose
+					klog.Infof("Released lease %s/%s", config.namespace, config.name)
+					return
+				}
+				klog.Fatalf("Lost lease %s/%s, exiting", config.namespace, config.name)
+			},
+			OnNewLeader: func(identity string) {
+				if identity != config.identity {
+					klog.Infof("Lease %s/%s is held by %s", config.namespace, config.name, identity)
+				}
+			},
+		},
+	})
+}
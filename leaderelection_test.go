@@ -0,0 +1,172 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+)
+
+func testLeaderElectionConfig(identity string) leaderElectionConfig {
+	return leaderElectionConfig{
+		namespace:     metav1.NamespaceDefault,
+		name:          "frr-controller",
+		identity:      identity,
+		leaseDuration: time.Second,
+		renewDeadline: 500 * time.Millisecond,
+		retryPeriod:   100 * time.Millisecond,
+	}
+}
+
+func TestRunWithLeaderElection(t *testing.T) {
+	client := k8sfake.NewSimpleClientset()
+	config := testLeaderElectionConfig("replica-a")
+	status := newLeaderStatus(true, config.renewDeadline)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	started := make(chan struct{})
+	stopped := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		runWithLeaderElection(ctx, client, config, status, func(ctx context.Context) {
+			close(started)
+			<-ctx.Done()
+			close(stopped)
+		})
+	}()
+
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected run to be called once the Lease is acquired")
+	}
+	if !status.leading.Load() {
+		t.Error("expected the replica to lead while run is called")
+	}
+	lease, err := client.CoordinationV1().Leases(config.namespace).Get(context.TODO(), config.name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error getting the Lease: %v", err)
+	}
+	if holder := lease.Spec.HolderIdentity; holder == nil || *holder != config.identity {
+		t.Errorf("expected the Lease to be held by %s, got %v", config.identity, holder)
+	}
+
+	// Shutting down cancels run and releases the Lease
+	cancel()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the context given to run to be cancelled")
+	}
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected runWithLeaderElection to return")
+	}
+	if status.leading.Load() {
+		t.Error("expected the replica to stop leading")
+	}
+	lease, err = client.CoordinationV1().Leases(config.namespace).Get(context.TODO(), config.name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error getting the Lease: %v", err)
+	}
+	if holder := lease.Spec.HolderIdentity; holder != nil && *holder != "" {
+		t.Errorf("expected the Lease to be released, held by %s", *holder)
+	}
+}
+
+func TestRunWithLeaderElectionStandby(t *testing.T) {
+	// Another replica holds a Lease it keeps renewing
+	holder := "replica-a"
+	duration := int32(60)
+	now := metav1.NewMicroTime(time.Now())
+	client := k8sfake.NewSimpleClientset(&coordinationv1.Lease{
+		ObjectMeta: metav1.ObjectMeta{Name: "frr-controller", Namespace: metav1.NamespaceDefault},
+		Spec: coordinationv1.LeaseSpec{
+			HolderIdentity:       &holder,
+			LeaseDurationSeconds: &duration,
+			AcquireTime:          &now,
+			RenewTime:            &now,
+		},
+	})
+	config := testLeaderElectionConfig("replica-b")
+	status := newLeaderStatus(true, config.renewDeadline)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	runWithLeaderElection(ctx, client, config, status, func(ctx context.Context) {
+		t.Error("expected run not to be called while another replica leads")
+	})
+	if status.leading.Load() {
+		t.Error("expected the replica not to lead")
+	}
+}
+
+func TestRunWithLeaderElectionTakesOverExpiredLease(t *testing.T) {
+	// The replica holding the Lease stopped renewing it
+	holder := "replica-a"
+	duration := int32(1)
+	renewed := metav1.NewMicroTime(time.Now().Add(-time.Minute))
+	client := k8sfake.NewSimpleClientset(&coordinationv1.Lease{
+		ObjectMeta: metav1.ObjectMeta{Name: "frr-controller", Namespace: metav1.NamespaceDefault},
+		Spec: coordinationv1.LeaseSpec{
+			HolderIdentity:       &holder,
+			LeaseDurationSeconds: &duration,
+			AcquireTime:          &renewed,
+			RenewTime:            &renewed,
+		},
+	})
+	config := testLeaderElectionConfig("replica-b")
+	status := newLeaderStatus(true, config.renewDeadline)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	started := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		runWithLeaderElection(ctx, client, config, status, func(ctx context.Context) {
+			close(started)
+			<-ctx.Done()
+		})
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected run to be called once the Lease expired")
+	}
+	lease, err := client.CoordinationV1().Leases(config.namespace).Get(context.TODO(), config.name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error getting the Lease: %v", err)
+	}
+	if holder := lease.Spec.HolderIdentity; holder == nil || *holder != config.identity {
+		t.Errorf("expected the Lease to be taken over by %s, got %v", config.identity, holder)
+	}
+	if transitions := lease.Spec.LeaseTransitions; transitions == nil || *transitions != 1 {
+		t.Errorf("expected 1 leader transition, got %v", transitions)
+	}
+}
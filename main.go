@@ -17,10 +17,14 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
+	"net/http"
+	"os"
 	"time"
 
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	kubeinformers "k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/clientcmd"
@@ -31,14 +35,24 @@ import (
 
 	clientset "github.com/guohao117/frr-controller/pkg/generated/clientset/versioned"
 	informers "github.com/guohao117/frr-controller/pkg/generated/informers/externalversions"
+	"github.com/guohao117/frr-controller/pkg/metrics"
+	rangemanager "github.com/guohao117/frr-controller/pkg/range_manager"
 	"github.com/guohao117/frr-controller/pkg/signals"
 )
 
 var (
-	masterURL  string
-	kubeconfig string
-	asnRange   rangeVar
-	vniRange   rangeVar
+	masterURL           string
+	kubeconfig          string
+	asnRange            rangeVar
+	vniRange            rangeVar
+	allocationNamespace string
+	allocationConfigMap string
+	metricsAddress      string
+	webhookAddress      string
+	webhookCertFile     string
+	webhookKeyFile      string
+	leaderElect         bool
+	leaderElection      leaderElectionConfig
 )
 
 type rangeVar struct {
@@ -74,31 +88,118 @@ func main() {
 
 	frrClient, err := clientset.NewForConfig(cfg)
 	if err != nil {
-		klog.Fatalf("Error building example clientset: %s", err.Error())
+		klog.Fatalf("Error building frr clientset: %s", err.Error())
+	}
+
+	if allocationNamespace == "" {
+		allocationNamespace = os.Getenv("POD_NAMESPACE")
+	}
+	if allocationNamespace == "" {
+		allocationNamespace = "default"
+	}
+	var allocationStorage rangemanager.Storage
+	if allocationConfigMap != "" {
+		allocationStorage = rangemanager.NewConfigMapStorage(kubeClient, allocationNamespace, allocationConfigMap)
 	}
 
 	kubeInformerFactory := kubeinformers.NewSharedInformerFactory(kubeClient, time.Second*30)
+	// Only the pods, frr.conf Secrets, service accounts, RoleBindings and
+	// teardown Jobs of Frrs are watched, the controller watches the password
+	// Secrets the Frrs refer to itself
+	frrObjectInformerFactory := kubeinformers.NewSharedInformerFactoryWithOptions(kubeClient, time.Second*30,
+		kubeinformers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.LabelSelector = frrObjectSelector
+		}))
 	frrInformerFactory := informers.NewSharedInformerFactory(frrClient, time.Second*30)
 
 	controller := NewController(kubeClient, frrClient,
 		kubeInformerFactory.Apps().V1().Deployments(),
+		frrObjectInformerFactory.Core().V1().Pods(),
+		frrObjectInformerFactory.Core().V1().Secrets(),
 		frrInformerFactory.Frrcontroller().V1alpha1().Frrs(),
+		frrInformerFactory.Frrcontroller().V1alpha1().VNIPools(),
+		frrInformerFactory.Frrcontroller().V1alpha1().ASNPools(),
+		frrObjectInformerFactory.Batch().V1().Jobs(),
+		kubeInformerFactory.Core().V1().Nodes(),
+		frrObjectInformerFactory.Core().V1().ServiceAccounts(),
+		frrObjectInformerFactory.Rbac().V1().RoleBindings(),
 		vniRange.start, vniRange.end,
-		asnRange.start, asnRange.end)
+		asnRange.start, asnRange.end,
+		allocationStorage)
+
+	if err := metrics.RegisterPools(controller.poolUsage); err != nil {
+		klog.Fatalf("Error registering pool metrics: %s", err.Error())
+	}
+	leader := newLeaderStatus(leaderElect, leaderElection.renewDeadline)
+	if metricsAddress != "" {
+		go serveHTTP(metricsAddress, newHTTPHandler(controller, leader))
+	}
+	// every replica answers the API server, not only the leader
+	if webhookAddress != "" {
+		go serveWebhook(webhookAddress, webhookCertFile, webhookKeyFile, newFrrValidator(
+			frrInformerFactory.Frrcontroller().V1alpha1().Frrs(),
+			frrInformerFactory.Frrcontroller().V1alpha1().ASNPools(),
+			asnRange.start, asnRange.end))
+	}
 
 	// notice that there is no need to run Start methods in a separate goroutine. (i.e. go kubeInformerFactory.Start(stopCh)
 	// Start method is non-blocking and runs all registered informers in a dedicated goroutine.
 	kubeInformerFactory.Start(stopCh)
+	frrObjectInformerFactory.Start(stopCh)
 	frrInformerFactory.Start(stopCh)
 
-	if err = controller.Run(2, stopCh); err != nil {
-		klog.Fatalf("Error running controller: %s", err.Error())
+	run := func(ctx context.Context) {
+		if err := controller.Run(2, ctx.Done()); err != nil {
+			klog.Fatalf("Error running controller: %s", err.Error())
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-stopCh
+		cancel()
+	}()
+	if !leaderElect {
+		run(ctx)
+		return
+	}
+
+	if leaderElection.namespace == "" {
+		leaderElection.namespace = allocationNamespace
+	}
+	if leaderElection.identity == "" {
+		if leaderElection.identity, err = os.Hostname(); err != nil {
+			klog.Fatalf("Error getting hostname for leader election identity: %s", err.Error())
+		}
+	}
+	runWithLeaderElection(ctx, kubeClient, leaderElection, leader, run)
+}
+
+// serveHTTP serves the metrics and health checks of the controller on
+// address
+func serveHTTP(address string, handler http.Handler) {
+	klog.Infof("Serving metrics and health checks on %s", address)
+	if err := http.ListenAndServe(address, handler); err != nil {
+		klog.Fatalf("Error serving metrics and health checks: %s", err.Error())
 	}
 }
 
 func init() {
 	flag.StringVar(&kubeconfig, "kubeconfig", "", "Path to a kubeconfig. Only required if out-of-cluster.")
 	flag.StringVar(&masterURL, "master", "", "The address of the Kubernetes API server. Overrides any value in kubeconfig. Only required if out-of-cluster.")
-	flag.Var(&asnRange, "asn_range", "The range of ASNs to use for the FRRs.")
-	flag.Var(&vniRange, "vni_range", "The range of VNIs to use for the FRRs.")
+	flag.Var(&asnRange, "asn_range", "The range of ASNs of the default pool, used while no ASNPool named default exists.")
+	flag.Var(&vniRange, "vni_range", "The range of VNIs of the default pool, used while no VNIPool named default exists.")
+	flag.StringVar(&allocationNamespace, "allocation_namespace", "", "The namespace of the ConfigMap the VNI and ASN allocations are saved to. Defaults to $POD_NAMESPACE, or default.")
+	flag.StringVar(&allocationConfigMap, "allocation_configmap", "frr-controller-allocations", "The name of the ConfigMap the VNI and ASN allocations are saved to. Allocations are kept in memory only if empty.")
+	flag.StringVar(&metricsAddress, "metrics_address", ":8080", "The address the /metrics, /healthz and /readyz endpoints are served on. Not served if empty.")
+	flag.StringVar(&webhookAddress, "webhook_address", "", "The address the validating admission webhook of Frrs is served on, over TLS. Not served if empty.")
+	flag.StringVar(&webhookCertFile, "webhook_cert_file", "", "The file holding the TLS certificate of the validating webhook.")
+	flag.StringVar(&webhookKeyFile, "webhook_key_file", "", "The file holding the TLS private key of the validating webhook.")
+	flag.BoolVar(&leaderElect, "leader_elect", true, "Elect a leader among the controller replicas through a Lease, so that only one of them allocates VNIs and ASNs.")
+	flag.StringVar(&leaderElection.namespace, "leader_elect_namespace", "", "The namespace of the leader election Lease. Defaults to the allocation namespace.")
+	flag.StringVar(&leaderElection.name, "leader_elect_name", "frr-controller", "The name of the leader election Lease.")
+	flag.StringVar(&leaderElection.identity, "leader_elect_identity", "", "The identity of this replica in the leader election. Defaults to the hostname.")
+	flag.DurationVar(&leaderElection.leaseDuration, "leader_elect_lease_duration", 15*time.Second, "The duration non-leader replicas wait before trying to acquire a Lease which was not renewed.")
+	flag.DurationVar(&leaderElection.renewDeadline, "leader_elect_renew_deadline", 10*time.Second, "The duration the leader retries renewing the Lease before giving up leadership.")
+	flag.DurationVar(&leaderElection.retryPeriod, "leader_elect_retry_period", 2*time.Second, "The duration replicas wait between attempts to acquire or renew the Lease.")
 }
@@ -0,0 +1,212 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+
+	frrv1alpha1 "github.com/guohao117/frr-controller/pkg/apis/frrcontroller/v1alpha1"
+	"github.com/guohao117/frr-controller/pkg/netagent"
+)
+
+const (
+	// defaultNetworkSetupImage runs connect-frr for Frrs created before
+	// spec.networkSetupImage had a default
+	defaultNetworkSetupImage = "nocsyscn/connect_frr:0.1"
+	// networkSetupContainerName is the name of the init container
+	// connecting the L2VNIs of a Frr to their OVN logical switches
+	networkSetupContainerName = "connect-frr"
+)
+
+// networkSetupContainer returns the connect-frr init container of the pods of
+// a Frr, which builds the vxlan interface and the bridge of every L2VNI and
+// VRF on the node and plugs the L2VNIs into the br-int port of their logical
+// switch. It returns nil if no L2VNI is bridged to a logical switch and
+// spec.vxlan sets no parameter of the vxlan interfaces, as nothing then asks
+// the controller to build them.
+func networkSetupContainer(frr *frrv1alpha1.Frr, vnis []l2vni, vrfs []l3vni) *corev1.Container {
+	bridged := false
+	for i := range vnis {
+		bridged = bridged || vnis[i].logicalSwitch != ""
+	}
+	args := vxlanArgs(frr)
+	if !bridged && len(args) == 0 {
+		return nil
+	}
+
+	var env []corev1.EnvVar
+	if len(frr.Spec.VNIs) == 0 {
+		env = append(env, corev1.EnvVar{
+			Name:  "VNI",
+			Value: fmt.Sprintf("%d", vnis[0].number),
+		}, corev1.EnvVar{
+			Name:  "SUBNET",
+			Value: vnis[0].logicalSwitch,
+		})
+	} else {
+		env = append(env, corev1.EnvVar{
+			Name:  vnisEnv,
+			Value: formatVNIsEnv(vnis),
+		})
+	}
+	if len(vrfs) > 0 {
+		env = append(env, corev1.EnvVar{
+			Name:  vrfsEnv,
+			Value: formatVRFsEnv(vrfs),
+		})
+	}
+	env = append(env, vtepLocalEnv(frr)...)
+
+	return &corev1.Container{
+		Name:            networkSetupContainerName,
+		Image:           networkSetupImage(frr),
+		ImagePullPolicy: corev1.PullIfNotPresent,
+		Args:            args,
+		Env:             env,
+		VolumeMounts:    ovsVolumeMounts(),
+		SecurityContext: networkSetupSecurityContext(),
+		// connect-frr logs the changes it made and why it failed, which
+		// ends up in the status of the pod
+		TerminationMessagePolicy: corev1.TerminationMessageFallbackToLogsOnError,
+	}
+}
+
+// vxlanArgs returns the flags of connect-frr setting the parameters of the
+// vxlan interfaces which differ from its defaults
+func vxlanArgs(frr *frrv1alpha1.Frr) []string {
+	vxlan := frr.Spec.VXLAN
+	if vxlan == nil {
+		return nil
+	}
+	var args []string
+	if vxlan.DstPort != 0 && vxlan.DstPort != netagent.DefaultVXLANPort {
+		args = append(args, fmt.Sprintf("-vxlan_port=%d", vxlan.DstPort))
+	}
+	if vxlan.MTU != 0 {
+		args = append(args, fmt.Sprintf("-vxlan_mtu=%d", vxlan.MTU))
+	}
+	if vxlan.Learning {
+		args = append(args, "-vxlan_learning")
+	}
+	if vxlan.TTL != 0 {
+		args = append(args, fmt.Sprintf("-vxlan_ttl=%d", vxlan.TTL))
+	}
+	return args
+}
+
+// vtepLocalEnv returns the environment variables giving the containers of the
+// pods of a Frr the local address of the VTEP, which replaces
+// frrconf.VTEPLocalPlaceholder: VTEP_LOCAL set to a field of the pod, or
+// VTEP_INTERFACE naming the interface of the node it is read from.
+func vtepLocalEnv(frr *frrv1alpha1.Frr) []corev1.EnvVar {
+	source := frrv1alpha1.VXLANLocalAddressPodIP
+	if frr.Spec.VXLAN != nil && frr.Spec.VXLAN.LocalAddressSource != "" {
+		source = frr.Spec.VXLAN.LocalAddressSource
+	}
+	switch source {
+	case frrv1alpha1.VXLANLocalAddressNodeInternalIP:
+		return []corev1.EnvVar{fieldEnv("VTEP_LOCAL", "status.hostIP")}
+	case frrv1alpha1.VXLANLocalAddressInterface:
+		return []corev1.EnvVar{{Name: "VTEP_INTERFACE", Value: frr.Spec.VXLAN.LocalInterface}}
+	default:
+		return []corev1.EnvVar{fieldEnv("VTEP_LOCAL", "status.podIP")}
+	}
+}
+
+// vtepLocalCommand returns the shell command setting VTEP_LOCAL in the frr
+// container to the first IPv4 address of VTEP_INTERFACE, if the Frr reads
+// the local address of the VTEP from an interface of the node
+func vtepLocalCommand(frr *frrv1alpha1.Frr) string {
+	if frr.Spec.VXLAN == nil || frr.Spec.VXLAN.LocalAddressSource != frrv1alpha1.VXLANLocalAddressInterface {
+		return ""
+	}
+	return `VTEP_LOCAL=$(ip -4 -o addr show dev "$VTEP_INTERFACE" | awk '{split($4, a, "/"); print a[1]; exit}') && [ -n "$VTEP_LOCAL" ] && `
+}
+
+func networkSetupImage(frr *frrv1alpha1.Frr) string {
+	if frr.Spec.NetworkSetupImage != "" {
+		return frr.Spec.NetworkSetupImage
+	}
+	return defaultNetworkSetupImage
+}
+
+// networkSetupSecurityContext lets connect-frr manage the network devices of
+// the node
+func networkSetupSecurityContext() *corev1.SecurityContext {
+	return &corev1.SecurityContext{
+		Capabilities: &corev1.Capabilities{
+			Add: []corev1.Capability{"NET_ADMIN"},
+		},
+	}
+}
+
+// ovsVolumes returns the host directories holding the database socket of
+// Open vSwitch
+func ovsVolumes() []corev1.Volume {
+	return []corev1.Volume{{
+		Name: "host-var-run-ovs",
+		VolumeSource: corev1.VolumeSource{
+			HostPath: &corev1.HostPathVolumeSource{
+				Path: "/var/run/openvswitch",
+			},
+		},
+	}, {
+		Name: "host-run-ovs",
+		VolumeSource: corev1.VolumeSource{
+			HostPath: &corev1.HostPathVolumeSource{
+				Path: "/run/openvswitch",
+			},
+		},
+	}}
+}
+
+func ovsVolumeMounts() []corev1.VolumeMount {
+	return []corev1.VolumeMount{{
+		Name:      "host-var-run-ovs",
+		MountPath: "/var/run/openvswitch",
+	}, {
+		Name:      "host-run-ovs",
+		MountPath: "/run/openvswitch",
+	}}
+}
+
+// networkSetupError returns why connect-frr failed in a pod, if it did. A
+// failing init container is restarted, its last failure is reported while
+// it waits for the next attempt.
+func networkSetupError(pod *corev1.Pod) string {
+	for _, status := range pod.Status.InitContainerStatuses {
+		if status.Name != networkSetupContainerName {
+			continue
+		}
+		terminated := status.State.Terminated
+		if terminated == nil && status.State.Waiting != nil {
+			terminated = status.LastTerminationState.Terminated
+		}
+		if terminated == nil || terminated.ExitCode == 0 {
+			return ""
+		}
+		msg := fmt.Sprintf("%s exited with %d", networkSetupContainerName, terminated.ExitCode)
+		if message := strings.TrimSpace(terminated.Message); message != "" {
+			msg += ": " + message
+		}
+		return msg
+	}
+	return ""
+}
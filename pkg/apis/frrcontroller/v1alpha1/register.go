@@ -49,6 +49,10 @@ func addKnownTypes(scheme *runtime.Scheme) error {
 	scheme.AddKnownTypes(SchemeGroupVersion,
 		&Frr{},
 		&FrrList{},
+		&VNIPool{},
+		&VNIPoolList{},
+		&ASNPool{},
+		&ASNPoolList{},
 	)
 	metav1.AddToGroupVersion(scheme, SchemeGroupVersion)
 	return nil
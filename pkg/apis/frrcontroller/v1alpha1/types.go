@@ -17,6 +17,7 @@ limitations under the License.
 package v1alpha1
 
 import (
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -26,11 +27,16 @@ import (
 // Frr is a specification for a Frr resource
 // +kubebuilder:subresource:status
 // +kubebuilder:resource:path=frrs,scope=Namespaced
-// +kubebuilder:printcolumn:name="AS Number",type="integer",JSONPath=".spec.asNumber",description="AS Number"
+// +kubebuilder:printcolumn:name="AS Number",type="integer",JSONPath=".status.asNumber",description="AS Number"
 // +kubebuilder:printcolumn:name="Replicas",type="integer",JSONPath=".spec.replicas",description="Replicas"
 // +kubebuilder:printcolumn:name="Available Replicas",type="integer",JSONPath=".status.availableReplicas",description="Available Replicas"
-// +kubebuilder:printcolumn:name="VNI",type="integer",JSONPath=".sepc.vni",description="VNI number"
+// +kubebuilder:printcolumn:name="VNI",type="integer",JSONPath=".status.vni",description="VNI number"
+// +kubebuilder:printcolumn:name="ASN Source",type="string",JSONPath=".status.asNumberAllocation.allocationSource",description="Where the AS number comes from",priority=1
+// +kubebuilder:printcolumn:name="ASN Pool",type="string",JSONPath=".status.asNumberAllocation.pool",description="ASNPool of the AS number",priority=1
+// +kubebuilder:printcolumn:name="VNI Source",type="string",JSONPath=".status.vniAllocation.allocationSource",description="Where the VNI comes from",priority=1
+// +kubebuilder:printcolumn:name="VNI Pool",type="string",JSONPath=".status.vniAllocation.pool",description="VNIPool of the VNI",priority=1
 // +kubebuilder:printcolumn:name="Nodes",type="string",JSONPath=".status.nodes",description="Nodes"
+// +kubebuilder:printcolumn:name="Ready",type="string",JSONPath=".status.conditions[?(@.type==\"Ready\")].status",description="Ready"
 type Frr struct {
 	metav1.TypeMeta   `json:",inline"`
 	metav1.ObjectMeta `json:"metadata,omitempty"`
@@ -45,28 +51,440 @@ type FrrSpec struct {
 	DeploymentName string `json:"deploymentName"`
 	Replicas       *int32 `json:"replicas"`
 	Image          string `json:"image"`
+	// InitConfigImage is deprecated and ignored, frr.conf is rendered by
+	// the controller
 	// +optional
-	// +kubebuilder:default="nocsyscn/frr_conf:0.2"
 	InitConfigImage string `json:"initConfigImage,omitempty"`
+	// ReloaderImage runs the frr-reloader sidecar, which applies changes of
+	// frr.conf to the running pods
 	// +optional
-	ASNumber  int      `json:"asNumber,omitempty"`
-	Neighbors []string `json:"neighbors"`
+	// +kubebuilder:default="nocsyscn/frr_reloader:0.1"
+	ReloaderImage string `json:"reloaderImage,omitempty"`
+	// NetworkSetupImage runs the connect-frr init container, which connects
+	// the L2VNIs to their OVN logical switch on the node. It is only run if
+	// a logical switch is set.
+	// +optional
+	// +kubebuilder:default="nocsyscn/connect_frr:0.1"
+	NetworkSetupImage string `json:"networkSetupImage,omitempty"`
+	// ASNumber is reserved from the ASN pool if set, otherwise the next
+	// free AS number of the pool is used
+	// +optional
+	ASNumber int `json:"asNumber,omitempty"`
+	// Neighbors is deprecated, use Peers. Every neighbor is an iBGP peer
+	// exchanging IPv4 unicast and EVPN routes.
+	// +optional
+	Neighbors []string `json:"neighbors,omitempty"`
+	// Peers are the BGP neighbors of the pods
+	// +optional
+	// +listType=map
+	// +listMapKey=address
+	Peers []BGPPeer `json:"peers,omitempty"`
+	// PasswordSecretRef selects the key of a Secret holding the TCP MD5
+	// password of the sessions with the neighbors and with the peers which
+	// do not set their own
+	// +optional
+	PasswordSecretRef *corev1.SecretKeySelector `json:"passwordSecretRef,omitempty"`
+	// VNI is reserved from the VNI pool if set, otherwise the next free
+	// VNI of the pool is used. VNI and LogicalSwitch describe the single
+	// L2VNI of a Frr which does not list VNIs.
+	// +optional
+	VNI int `json:"vni,omitempty"`
+	// LogicalSwitch is the OVN logical switch the L2VNI is bridged to by
+	// the connect-frr init container
 	// +optional
-	// +kubebuilder:default=1000
-	VNI           int    `json:"vni,omitempty"`
 	LogicalSwitch string `json:"logicalSwitch,omitempty"`
+	// VNIs are the L2VNIs bridged by the pods
+	// +optional
+	// +listType=map
+	// +listMapKey=name
+	VNIs []L2VNI `json:"vnis,omitempty"`
+	// VRFs are the tenant VRFs routed between the L2VNIs over EVPN, each
+	// with its L3VNI
+	// +optional
+	// +listType=map
+	// +listMapKey=name
+	VRFs []VRF `json:"vrfs,omitempty"`
+	// RouteTargetDerivation tells who derives the route targets of the
+	// L2VNIs listed in VNIs and of the VRFs which list none
+	// +optional
+	// +kubebuilder:default=frr
+	RouteTargetDerivation RouteTargetDerivation `json:"routeTargetDerivation,omitempty"`
+	// VXLAN sets the parameters of the vxlan interfaces built by the
+	// connect-frr init container and the local address of the VTEP. Any
+	// parameter of the interfaces other than its default runs connect-frr.
+	// +optional
+	VXLAN *VXLAN `json:"vxlan,omitempty"`
 	// +kubebuilder:default={matchLabels: {frrcontroller.nocsys.cn/frr-assignable: ""}}
 	// +optional
 	NodeSelector metav1.LabelSelector `json:"nodeSelector,omitempty"`
+	// VNIPool is the name of the VNIPool the VNI is allocated from
+	// +optional
+	// +kubebuilder:default=default
+	VNIPool string `json:"vniPool,omitempty"`
+	// ASNPool is the name of the ASNPool the AS number is allocated from
+	// +optional
+	// +kubebuilder:default=default
+	ASNPool string `json:"asnPool,omitempty"`
+}
+
+// L2VNI is a VXLAN segment bridged by the pods of a Frr
+type L2VNI struct {
+	// Name identifies the L2VNI in the Frr, it keeps its VNI as long as
+	// its name is listed
+	// +kubebuilder:validation:MaxLength=63
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`
+	Name string `json:"name"`
+	// ID is reserved from the VNI pool if set, otherwise the next free VNI
+	// of the pool is used
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=16777215
+	ID int `json:"id,omitempty"`
+	// LogicalSwitch is the OVN logical switch the L2VNI is bridged to
+	// +optional
+	// +kubebuilder:validation:Pattern=`^[^\s:]+$`
+	LogicalSwitch string `json:"logicalSwitch,omitempty"`
+	// BridgeName is the Linux bridge of the L2VNI on the nodes, br-vx<VNI>
+	// if empty
+	// +optional
+	// +kubebuilder:validation:MaxLength=15
+	// +kubebuilder:validation:Pattern=`^[^\s/:]+$`
+	BridgeName  string `json:"bridgeName,omitempty"`
+	EVPNRouting `json:",inline"`
 }
 
+// EVPNRouting holds the route distinguisher and route targets of the EVPN
+// routes of a L2VNI or a VRF. Each is ASN:NN or IP:NN.
+type EVPNRouting struct {
+	// RD is the route distinguisher. FRR derives it from the router ID if
+	// empty, which keeps it unique to every replica.
+	// +optional
+	RD string `json:"rd,omitempty"`
+	// ImportRTs and ExportRTs are the route targets of the routes imported
+	// and exported. They are derived from the AS number and the VNI if
+	// empty, see RouteTargetDerivation.
+	// +optional
+	ImportRTs []string `json:"importRTs,omitempty"`
+	// +optional
+	ExportRTs []string `json:"exportRTs,omitempty"`
+}
+
+// RouteTargetDerivation tells who derives the route targets left empty
+// +kubebuilder:validation:Enum=frr;controller
+type RouteTargetDerivation string
+
+const (
+	// RouteTargetDerivationFRR leaves the route targets out of frr.conf,
+	// FRR derives them
+	RouteTargetDerivationFRR RouteTargetDerivation = "frr"
+	// RouteTargetDerivationController has the controller derive the route
+	// targets as AS:VNI, with the low-order 2 bytes of a 4-byte AS number,
+	// and report them in status
+	RouteTargetDerivationController RouteTargetDerivation = "controller"
+)
+
+// VRF is a tenant VRF of a Frr, whose routes are exchanged as EVPN type-5
+// routes over its L3VNI
+type VRF struct {
+	// Name is the name of the VRF device on the nodes
+	// +kubebuilder:validation:MaxLength=15
+	// +kubebuilder:validation:Pattern=`^[A-Za-z0-9][-A-Za-z0-9_.]*$`
+	Name string `json:"name"`
+	// L3VNI is reserved from the VNI pool if set, otherwise the next free
+	// VNI of the pool is used
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=16777215
+	L3VNI int `json:"l3vni,omitempty"`
+	// RouterMAC is the MAC address of the L3VNI bridge, advertised as the
+	// router MAC of the type-5 routes. The bridge keeps its generated
+	// address if empty.
+	// +optional
+	// +kubebuilder:validation:Pattern=`^([0-9A-Fa-f]{2}:){5}[0-9A-Fa-f]{2}$`
+	RouterMAC   string `json:"routerMAC,omitempty"`
+	EVPNRouting `json:",inline"`
+	// AdvertisedPrefixes are the IPv4 and IPv6 prefixes of the VRF
+	// advertised to the peers
+	// +optional
+	AdvertisedPrefixes []string `json:"advertisedPrefixes,omitempty"`
+}
+
+// VXLAN holds the parameters of the vxlan interfaces of the L2VNIs and L3VNIs
+// of a Frr
+type VXLAN struct {
+	// DstPort is the UDP port of the tunnels
+	// +optional
+	// +kubebuilder:default=4789
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	DstPort int32 `json:"dstPort,omitempty"`
+	// MTU of the vxlan interfaces, the kernel default if unset. Their
+	// bridges follow the smallest MTU of their ports.
+	// +optional
+	// +kubebuilder:validation:Minimum=68
+	// +kubebuilder:validation:Maximum=65535
+	MTU int32 `json:"mtu,omitempty"`
+	// Learning has the vxlan interfaces learn remote MAC addresses from the
+	// traffic, besides the routes EVPN advertises
+	// +optional
+	Learning bool `json:"learning,omitempty"`
+	// TTL of the tunnel packets, the kernel default if unset
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=255
+	TTL int32 `json:"ttl,omitempty"`
+	// LocalAddressSource tells where the local address of the VTEP, which
+	// is also the BGP router ID, is taken from
+	// +optional
+	// +kubebuilder:default=PodIP
+	LocalAddressSource VXLANLocalAddressSource `json:"localAddressSource,omitempty"`
+	// LocalInterface is the interface of the node whose first IPv4 address
+	// is used when LocalAddressSource is Interface
+	// +optional
+	LocalInterface string `json:"localInterface,omitempty"`
+}
+
+// VXLANLocalAddressSource tells where the local address of the VTEP is taken
+// from
+// +kubebuilder:validation:Enum=PodIP;NodeInternalIP;Interface
+type VXLANLocalAddressSource string
+
+const (
+	// VXLANLocalAddressPodIP is the IP of the pod, the address of the node
+	// it runs on in the host network
+	VXLANLocalAddressPodIP VXLANLocalAddressSource = "PodIP"
+	// VXLANLocalAddressNodeInternalIP is the host IP of the pod, the
+	// InternalIP of its node
+	VXLANLocalAddressNodeInternalIP VXLANLocalAddressSource = "NodeInternalIP"
+	// VXLANLocalAddressInterface is the first IPv4 address of
+	// LocalInterface on the node
+	VXLANLocalAddressInterface VXLANLocalAddressSource = "Interface"
+)
+
+// BGPPeer is a BGP neighbor of the pods of a Frr
+type BGPPeer struct {
+	// Address is the IP address of the peer
+	Address string `json:"address"`
+	// RemoteAS is the AS number of the peer, or internal for a peer in the
+	// AS of the Frr and external for a peer in any other AS
+	// +optional
+	// +kubebuilder:default=internal
+	// +kubebuilder:validation:Pattern=`^([0-9]+|internal|external)$`
+	RemoteAS string `json:"remoteAS,omitempty"`
+	// +optional
+	Description string `json:"description,omitempty"`
+	// SourceInterface is the interface the sessions with the peer are
+	// sourced from
+	// +optional
+	SourceInterface string `json:"sourceInterface,omitempty"`
+	// EBGPMultihop is the maximum number of hops to an eBGP peer which is
+	// not directly connected
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=255
+	EBGPMultihop int32 `json:"ebgpMultihop,omitempty"`
+	// Timers override the keepalive and hold timers of the sessions
+	// +optional
+	Timers *BGPTimers `json:"timers,omitempty"`
+	// PasswordSecretRef selects the key of a Secret holding the TCP MD5
+	// password of the sessions
+	// +optional
+	PasswordSecretRef *corev1.SecretKeySelector `json:"passwordSecretRef,omitempty"`
+	// AddressFamilies are the address families exchanged with the peer
+	// +optional
+	// +kubebuilder:default={l2vpn-evpn}
+	AddressFamilies []BGPAddressFamily `json:"addressFamilies,omitempty"`
+	// BFD enables BFD on the sessions with the peer
+	// +optional
+	BFD bool `json:"bfd,omitempty"`
+	// AllowASIn accepts routes from the peer carrying the AS of the Frr in
+	// their AS path up to the given number of times
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=10
+	AllowASIn int32 `json:"allowASIn,omitempty"`
+	// ASOverride replaces the AS of an eBGP peer with the AS of the Frr in
+	// the AS path of the routes advertised to it
+	// +optional
+	ASOverride bool `json:"asOverride,omitempty"`
+}
+
+// BGPTimers are the timers of the BGP sessions with a peer, in seconds
+type BGPTimers struct {
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=65535
+	KeepaliveSeconds int32 `json:"keepaliveSeconds"`
+	// HoldSeconds defaults to three times the keepalive, a hold time of 0
+	// with a keepalive of 0 disables the keepalives
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=65535
+	// +optional
+	HoldSeconds int32 `json:"holdSeconds,omitempty"`
+}
+
+// BGPAddressFamily is an address family exchanged with a BGP peer
+// +kubebuilder:validation:Enum=ipv4-unicast;ipv6-unicast;l2vpn-evpn
+type BGPAddressFamily string
+
+const (
+	BGPAddressFamilyIPv4Unicast BGPAddressFamily = "ipv4-unicast"
+	BGPAddressFamilyIPv6Unicast BGPAddressFamily = "ipv6-unicast"
+	BGPAddressFamilyL2VPNEVPN   BGPAddressFamily = "l2vpn-evpn"
+)
+
+const (
+	// BGPRemoteASInternal and BGPRemoteASExternal are the RemoteAS of
+	// peers in the AS of the Frr and in any other AS
+	BGPRemoteASInternal = "internal"
+	BGPRemoteASExternal = "external"
+)
+
 // FrrStatus is the status for a Frr resource
 type FrrStatus struct {
-	AvailableReplicas int32  `json:"availableReplicas"`
-	Nodes             string `json:"nodes,omitempty"`
-	VNI               int    `json:"vni,omitempty"`
+	AvailableReplicas int32 `json:"availableReplicas"`
+	// Nodes lists the nodes the replicas are scheduled to, comma separated
+	Nodes string `json:"nodes,omitempty"`
+	// Pods describes every replica of the Frr
+	// +optional
+	// +listType=map
+	// +listMapKey=name
+	Pods []FrrPodStatus `json:"pods,omitempty"`
+	// VNI and ASNumber are the numbers in effect, whether requested in the
+	// spec or allocated from a pool
+	VNI      int `json:"vni,omitempty"`
+	ASNumber int `json:"asNumber,omitempty"`
+	// VNIAllocation and ASNumberAllocation tell where the numbers in
+	// effect come from
+	// +optional
+	VNIAllocation NumberAllocation `json:"vniAllocation,omitempty"`
+	// +optional
+	ASNumberAllocation NumberAllocation `json:"asNumberAllocation,omitempty"`
+	// VNIs are the L2VNIs in effect, when the spec lists them. VNI and
+	// VNIAllocation describe the first one.
+	// +optional
+	// +listType=map
+	// +listMapKey=name
+	VNIs []L2VNIStatus `json:"vnis,omitempty"`
+	// VRFs are the VRFs in effect with the L3VNI they hold
+	// +optional
+	// +listType=map
+	// +listMapKey=name
+	VRFs []VRFStatus `json:"vrfs,omitempty"`
+	// NetworkNodes lists the nodes connect-frr set up the network of the
+	// Frr on, which it is removed from when the Frr is deleted
+	// +optional
+	NetworkNodes []string `json:"networkNodes,omitempty"`
+	// RetiredVNIs are the VNIs the Frr no longer uses, held until they are
+	// removed from the nodes they were set up on
+	// +optional
+	// +listType=map
+	// +listMapKey=vni
+	RetiredVNIs []RetiredVNIStatus `json:"retiredVNIs,omitempty"`
+	// ObservedGeneration is the generation of the spec the status was
+	// computed from
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
 }
 
+// RetiredVNIStatus describes a VNI a Frr no longer uses
+type RetiredVNIStatus struct {
+	VNI int `json:"vni"`
+	// Nodes lists the nodes the VNI was set up on
+	// +optional
+	Nodes []string `json:"nodes,omitempty"`
+}
+
+// FrrPodStatus describes where a replica of a Frr runs
+type FrrPodStatus struct {
+	Name string `json:"name"`
+	// +optional
+	Node string `json:"node,omitempty"`
+	// VTEPAddress is the local VXLAN tunnel endpoint of the replica, as
+	// reported by the pod, or else the pod or host IP it is read from
+	// +optional
+	VTEPAddress string `json:"vtepAddress,omitempty"`
+	// +optional
+	Phase corev1.PodPhase `json:"phase,omitempty"`
+	Ready bool            `json:"ready"`
+	// ConfigHash is the hash of the frr.conf last applied to the pod
+	// +optional
+	ConfigHash string `json:"configHash,omitempty"`
+	// ConfigError tells why that frr.conf could not be applied
+	// +optional
+	ConfigError string `json:"configError,omitempty"`
+	// NetworkError tells why the network setup of the pod failed
+	// +optional
+	NetworkError string `json:"networkError,omitempty"`
+}
+
+// L2VNIStatus is a L2VNI of a Frr with the VNI it holds
+type L2VNIStatus struct {
+	Name string `json:"name"`
+	VNI  int    `json:"vni"`
+	// BridgeName is the Linux bridge of the L2VNI on the nodes
+	BridgeName string `json:"bridgeName"`
+	// +optional
+	LogicalSwitch string `json:"logicalSwitch,omitempty"`
+	// +optional
+	Allocation NumberAllocation `json:"allocation,omitempty"`
+	// EVPNRouting holds the RD and route targets in frr.conf, whether
+	// listed in the spec or derived by the controller
+	// +optional
+	EVPNRouting `json:",inline"`
+}
+
+// VRFStatus is a VRF of a Frr with the L3VNI it holds
+type VRFStatus struct {
+	Name  string `json:"name"`
+	L3VNI int    `json:"l3vni"`
+	// +optional
+	Allocation NumberAllocation `json:"allocation,omitempty"`
+	// +optional
+	EVPNRouting `json:",inline"`
+}
+
+// AllocationSource tells who chose a number held by a Frr
+// +kubebuilder:validation:Enum=user;pool
+type AllocationSource string
+
+const (
+	// AllocationSourceUser is a number requested in the Frr spec
+	AllocationSourceUser AllocationSource = "user"
+	// AllocationSourcePool is a number picked from the pool
+	AllocationSourcePool AllocationSource = "pool"
+)
+
+// NumberAllocation describes how a number held by a Frr was allocated
+type NumberAllocation struct {
+	// +optional
+	AllocationSource AllocationSource `json:"allocationSource,omitempty"`
+	// Pool is the name of the pool the number is reserved in
+	// +optional
+	Pool string `json:"pool,omitempty"`
+}
+
+const (
+	// FrrConditionAllocated tells whether the Frr holds its VNI and AS
+	// number
+	FrrConditionAllocated = "Allocated"
+	// FrrConditionDeploymentReady tells whether every replica of the
+	// Deployment of the Frr is available
+	FrrConditionDeploymentReady = "DeploymentReady"
+	// FrrConditionConfigRendered tells whether every replica runs the FRR
+	// configuration rendered from the current spec
+	FrrConditionConfigRendered = "ConfigRendered"
+	// FrrConditionDegraded tells whether the Frr failed in a way that needs
+	// attention
+	FrrConditionDegraded = "Degraded"
+	// FrrConditionReady is true when the Frr is allocated, deployed and
+	// configured, and not degraded
+	FrrConditionReady = "Ready"
+)
+
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
 
 // FrrList is a list of Frr resources
@@ -76,3 +494,92 @@ type FrrList struct {
 
 	Items []Frr `json:"items"`
 }
+
+// +genclient
+// +genclient:nonNamespaced
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// VNIPool is a cluster wide range of VNIs Frrs are allocated from
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:path=vnipools,scope=Cluster
+// +kubebuilder:printcolumn:name="Start",type="integer",JSONPath=".spec.start",description="First VNI of the pool"
+// +kubebuilder:printcolumn:name="End",type="integer",JSONPath=".spec.end",description="Last VNI of the pool"
+// +kubebuilder:printcolumn:name="Used",type="integer",JSONPath=".status.used",description="Allocated VNIs"
+// +kubebuilder:printcolumn:name="Free",type="integer",JSONPath=".status.free",description="Available VNIs"
+type VNIPool struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec PoolSpec `json:"spec"`
+	// +optional
+	Status PoolStatus `json:"status"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// VNIPoolList is a list of VNIPool resources
+type VNIPoolList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata"`
+
+	Items []VNIPool `json:"items"`
+}
+
+// +genclient
+// +genclient:nonNamespaced
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// ASNPool is a cluster wide range of AS numbers Frrs are allocated from
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:path=asnpools,scope=Cluster
+// +kubebuilder:printcolumn:name="Start",type="integer",JSONPath=".spec.start",description="First AS number of the pool"
+// +kubebuilder:printcolumn:name="End",type="integer",JSONPath=".spec.end",description="Last AS number of the pool"
+// +kubebuilder:printcolumn:name="Used",type="integer",JSONPath=".status.used",description="Allocated AS numbers"
+// +kubebuilder:printcolumn:name="Free",type="integer",JSONPath=".status.free",description="Available AS numbers"
+type ASNPool struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec PoolSpec `json:"spec"`
+	// +optional
+	Status PoolStatus `json:"status"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// ASNPoolList is a list of ASNPool resources
+type ASNPoolList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata"`
+
+	Items []ASNPool `json:"items"`
+}
+
+// PoolSpec is the spec for a VNIPool or ASNPool resource
+type PoolSpec struct {
+	// +kubebuilder:validation:Minimum=1
+	Start int `json:"start"`
+	// +kubebuilder:validation:Minimum=1
+	End int `json:"end"`
+}
+
+// PoolStatus is the status for a VNIPool or ASNPool resource
+type PoolStatus struct {
+	// Start and End are the bounds currently in effect. They lag behind
+	// the spec while a resize is refused because it would drop allocated
+	// numbers.
+	Start int `json:"start,omitempty"`
+	End   int `json:"end,omitempty"`
+	Used  int `json:"used"`
+	Free  int `json:"free"`
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
+}
+
+const (
+	// PoolConditionResized tells whether the bounds of the spec of a pool
+	// are in effect
+	PoolConditionResized = "Resized"
+)
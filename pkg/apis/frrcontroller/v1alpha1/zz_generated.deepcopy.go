@@ -22,16 +22,152 @@ limitations under the License.
 package v1alpha1
 
 import (
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ASNPool) DeepCopyInto(out *ASNPool) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	out.Spec = in.Spec
+	in.Status.DeepCopyInto(&out.Status)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ASNPool.
+func (in *ASNPool) DeepCopy() *ASNPool {
+	if in == nil {
+		return nil
+	}
+	out := new(ASNPool)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ASNPool) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ASNPoolList) DeepCopyInto(out *ASNPoolList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]ASNPool, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ASNPoolList.
+func (in *ASNPoolList) DeepCopy() *ASNPoolList {
+	if in == nil {
+		return nil
+	}
+	out := new(ASNPoolList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ASNPoolList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BGPPeer) DeepCopyInto(out *BGPPeer) {
+	*out = *in
+	if in.Timers != nil {
+		in, out := &in.Timers, &out.Timers
+		*out = new(BGPTimers)
+		**out = **in
+	}
+	if in.PasswordSecretRef != nil {
+		in, out := &in.PasswordSecretRef, &out.PasswordSecretRef
+		*out = new(v1.SecretKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.AddressFamilies != nil {
+		in, out := &in.AddressFamilies, &out.AddressFamilies
+		*out = make([]BGPAddressFamily, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BGPPeer.
+func (in *BGPPeer) DeepCopy() *BGPPeer {
+	if in == nil {
+		return nil
+	}
+	out := new(BGPPeer)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BGPTimers) DeepCopyInto(out *BGPTimers) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BGPTimers.
+func (in *BGPTimers) DeepCopy() *BGPTimers {
+	if in == nil {
+		return nil
+	}
+	out := new(BGPTimers)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EVPNRouting) DeepCopyInto(out *EVPNRouting) {
+	*out = *in
+	if in.ImportRTs != nil {
+		in, out := &in.ImportRTs, &out.ImportRTs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.ExportRTs != nil {
+		in, out := &in.ExportRTs, &out.ExportRTs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EVPNRouting.
+func (in *EVPNRouting) DeepCopy() *EVPNRouting {
+	if in == nil {
+		return nil
+	}
+	out := new(EVPNRouting)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Frr) DeepCopyInto(out *Frr) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 	return
 }
 
@@ -86,6 +222,22 @@ func (in *FrrList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FrrPodStatus) DeepCopyInto(out *FrrPodStatus) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FrrPodStatus.
+func (in *FrrPodStatus) DeepCopy() *FrrPodStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(FrrPodStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *FrrSpec) DeepCopyInto(out *FrrSpec) {
 	*out = *in
@@ -99,6 +251,37 @@ func (in *FrrSpec) DeepCopyInto(out *FrrSpec) {
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.Peers != nil {
+		in, out := &in.Peers, &out.Peers
+		*out = make([]BGPPeer, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.PasswordSecretRef != nil {
+		in, out := &in.PasswordSecretRef, &out.PasswordSecretRef
+		*out = new(v1.SecretKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.VNIs != nil {
+		in, out := &in.VNIs, &out.VNIs
+		*out = make([]L2VNI, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.VRFs != nil {
+		in, out := &in.VRFs, &out.VRFs
+		*out = make([]VRF, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.VXLAN != nil {
+		in, out := &in.VXLAN, &out.VXLAN
+		*out = new(VXLAN)
+		**out = **in
+	}
 	in.NodeSelector.DeepCopyInto(&out.NodeSelector)
 	return
 }
@@ -116,6 +299,46 @@ func (in *FrrSpec) DeepCopy() *FrrSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *FrrStatus) DeepCopyInto(out *FrrStatus) {
 	*out = *in
+	if in.Pods != nil {
+		in, out := &in.Pods, &out.Pods
+		*out = make([]FrrPodStatus, len(*in))
+		copy(*out, *in)
+	}
+	out.VNIAllocation = in.VNIAllocation
+	out.ASNumberAllocation = in.ASNumberAllocation
+	if in.VNIs != nil {
+		in, out := &in.VNIs, &out.VNIs
+		*out = make([]L2VNIStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.VRFs != nil {
+		in, out := &in.VRFs, &out.VRFs
+		*out = make([]VRFStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.NetworkNodes != nil {
+		in, out := &in.NetworkNodes, &out.NetworkNodes
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.RetiredVNIs != nil {
+		in, out := &in.RetiredVNIs, &out.RetiredVNIs
+		*out = make([]RetiredVNIStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 	return
 }
 
@@ -128,3 +351,231 @@ func (in *FrrStatus) DeepCopy() *FrrStatus {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *L2VNI) DeepCopyInto(out *L2VNI) {
+	*out = *in
+	in.EVPNRouting.DeepCopyInto(&out.EVPNRouting)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new L2VNI.
+func (in *L2VNI) DeepCopy() *L2VNI {
+	if in == nil {
+		return nil
+	}
+	out := new(L2VNI)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *L2VNIStatus) DeepCopyInto(out *L2VNIStatus) {
+	*out = *in
+	out.Allocation = in.Allocation
+	in.EVPNRouting.DeepCopyInto(&out.EVPNRouting)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new L2VNIStatus.
+func (in *L2VNIStatus) DeepCopy() *L2VNIStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(L2VNIStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NumberAllocation) DeepCopyInto(out *NumberAllocation) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NumberAllocation.
+func (in *NumberAllocation) DeepCopy() *NumberAllocation {
+	if in == nil {
+		return nil
+	}
+	out := new(NumberAllocation)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PoolSpec) DeepCopyInto(out *PoolSpec) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PoolSpec.
+func (in *PoolSpec) DeepCopy() *PoolSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(PoolSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PoolStatus) DeepCopyInto(out *PoolStatus) {
+	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PoolStatus.
+func (in *PoolStatus) DeepCopy() *PoolStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(PoolStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RetiredVNIStatus) DeepCopyInto(out *RetiredVNIStatus) {
+	*out = *in
+	if in.Nodes != nil {
+		in, out := &in.Nodes, &out.Nodes
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RetiredVNIStatus.
+func (in *RetiredVNIStatus) DeepCopy() *RetiredVNIStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(RetiredVNIStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VNIPool) DeepCopyInto(out *VNIPool) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	out.Spec = in.Spec
+	in.Status.DeepCopyInto(&out.Status)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VNIPool.
+func (in *VNIPool) DeepCopy() *VNIPool {
+	if in == nil {
+		return nil
+	}
+	out := new(VNIPool)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *VNIPool) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VNIPoolList) DeepCopyInto(out *VNIPoolList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]VNIPool, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VNIPoolList.
+func (in *VNIPoolList) DeepCopy() *VNIPoolList {
+	if in == nil {
+		return nil
+	}
+	out := new(VNIPoolList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *VNIPoolList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VRF) DeepCopyInto(out *VRF) {
+	*out = *in
+	in.EVPNRouting.DeepCopyInto(&out.EVPNRouting)
+	if in.AdvertisedPrefixes != nil {
+		in, out := &in.AdvertisedPrefixes, &out.AdvertisedPrefixes
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VRF.
+func (in *VRF) DeepCopy() *VRF {
+	if in == nil {
+		return nil
+	}
+	out := new(VRF)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VRFStatus) DeepCopyInto(out *VRFStatus) {
+	*out = *in
+	out.Allocation = in.Allocation
+	in.EVPNRouting.DeepCopyInto(&out.EVPNRouting)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VRFStatus.
+func (in *VRFStatus) DeepCopy() *VRFStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(VRFStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VXLAN) DeepCopyInto(out *VXLAN) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VXLAN.
+func (in *VXLAN) DeepCopy() *VXLAN {
+	if in == nil {
+		return nil
+	}
+	out := new(VXLAN)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -0,0 +1,479 @@
+// Package frrconf renders the frr.conf of the FRR pods of a Frr
+package frrconf
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+	"hash/fnv"
+	"net"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"k8s.io/apimachinery/pkg/util/rand"
+
+	frrv1alpha1 "github.com/guohao117/frr-controller/pkg/apis/frrcontroller/v1alpha1"
+)
+
+// VTEPLocalPlaceholder stands for the address of the pod in the rendered
+// configuration. The frr container replaces it with $VTEP_LOCAL when it
+// starts, and frr-reloader when it applies a new configuration, as every
+// replica has its own address.
+const VTEPLocalPlaceholder = "@VTEP_LOCAL@"
+
+// maxASNumber is the largest 4-byte AS number
+const maxASNumber = 4294967295
+
+//go:embed frr.conf.tmpl
+var frrConfTemplate string
+
+var tmpl = template.Must(template.New("frr.conf").Parse(frrConfTemplate))
+
+// maxEBGPMultihop is the largest TTL of a multihop eBGP session
+const maxEBGPMultihop = 255
+
+// maxPasswordLength is the longest TCP MD5 key of the kernel
+const maxPasswordLength = 80
+
+// maxAllowASIn is the largest number of times the local AS may be found in
+// the AS path of a route
+const maxAllowASIn = 10
+
+// maxVNI is the largest VXLAN network identifier
+const maxVNI = 16777215
+
+// maxVRFNameLength is the longest name of a network device
+const maxVRFNameLength = 15
+
+// addressFamilies are the address families a peer may exchange, in the
+// order frr.conf lists them, with their name in frr.conf
+var addressFamilies = []struct {
+	family frrv1alpha1.BGPAddressFamily
+	name   string
+}{
+	{frrv1alpha1.BGPAddressFamilyIPv4Unicast, "ipv4 unicast"},
+	{frrv1alpha1.BGPAddressFamilyIPv6Unicast, "ipv6 unicast"},
+	{frrv1alpha1.BGPAddressFamilyL2VPNEVPN, "l2vpn evpn"},
+}
+
+// Config holds everything frr.conf is rendered from
+type Config struct {
+	ASNumber int
+	// RouterID is the BGP router ID, an IPv4 address or
+	// VTEPLocalPlaceholder
+	RouterID string
+	Peers    []Peer
+	L2VNIs   []L2VNI
+	VRFs     []VRF
+}
+
+// L2VNI is a VXLAN segment whose EVPN routes may be given an RD and route
+// targets. A L2VNI which sets none is left to advertise-all-vni.
+type L2VNI struct {
+	VNI int
+	EVPNRouting
+}
+
+// EVPNRouting holds the RD and route targets of a L2VNI or a VRF, left to
+// FRR to derive if empty
+type EVPNRouting struct {
+	RD        string
+	ImportRTs []string
+	ExportRTs []string
+}
+
+// VRF is a tenant VRF whose routes are exchanged as EVPN type-5 routes over
+// its L3VNI
+type VRF struct {
+	Name string
+	// VNI is the L3VNI of the VRF
+	VNI int
+	EVPNRouting
+	// Prefixes are the IPv4 and IPv6 prefixes advertised from the VRF
+	Prefixes []string
+}
+
+// Peer is a BGP neighbor
+type Peer struct {
+	Address string
+	// RemoteAS is an AS number, frrv1alpha1.BGPRemoteASInternal or
+	// frrv1alpha1.BGPRemoteASExternal
+	RemoteAS        string
+	Description     string
+	UpdateSource    string
+	EBGPMultihop    int
+	Timers          *Timers
+	BFD             bool
+	AddressFamilies []frrv1alpha1.BGPAddressFamily
+	// AllowASIn and ASOverride apply to every address family of the peer
+	AllowASIn  int
+	ASOverride bool
+	// Password is the TCP MD5 password of the sessions, read from the
+	// Secret the spec refers to
+	Password string
+}
+
+// Timers are the keepalive and hold timers of a peer, in seconds
+type Timers struct {
+	Keepalive int
+	Hold      int
+}
+
+// AddressFamily is an address-family block of router bgp, listing the
+// peers activated in it
+type AddressFamily struct {
+	Name  string
+	Peers []Peer
+}
+
+// FromSpec returns the configuration of the pods of a Frr holding the
+// given AS number. The deprecated neighbors are iBGP peers exchanging IPv4
+// unicast and EVPN routes, as they always were.
+func FromSpec(spec *frrv1alpha1.FrrSpec, asn int) *Config {
+	c := &Config{
+		ASNumber: asn,
+		RouterID: VTEPLocalPlaceholder,
+	}
+	for _, neighbor := range spec.Neighbors {
+		c.Peers = append(c.Peers, Peer{
+			Address:  neighbor,
+			RemoteAS: frrv1alpha1.BGPRemoteASInternal,
+			AddressFamilies: []frrv1alpha1.BGPAddressFamily{
+				frrv1alpha1.BGPAddressFamilyIPv4Unicast,
+				frrv1alpha1.BGPAddressFamilyL2VPNEVPN,
+			},
+		})
+	}
+	for _, peer := range spec.Peers {
+		p := Peer{
+			Address:         peer.Address,
+			RemoteAS:        peer.RemoteAS,
+			Description:     peer.Description,
+			UpdateSource:    peer.SourceInterface,
+			EBGPMultihop:    int(peer.EBGPMultihop),
+			BFD:             peer.BFD,
+			AddressFamilies: peer.AddressFamilies,
+			AllowASIn:       int(peer.AllowASIn),
+			ASOverride:      peer.ASOverride,
+		}
+		// The defaults of the CRD, for objects created before them
+		if p.RemoteAS == "" {
+			p.RemoteAS = frrv1alpha1.BGPRemoteASInternal
+		}
+		if len(p.AddressFamilies) == 0 {
+			p.AddressFamilies = []frrv1alpha1.BGPAddressFamily{frrv1alpha1.BGPAddressFamilyL2VPNEVPN}
+		}
+		if peer.Timers != nil {
+			p.Timers = &Timers{
+				Keepalive: int(peer.Timers.KeepaliveSeconds),
+				Hold:      int(peer.Timers.HoldSeconds),
+			}
+			// FRR takes both timers at once, a keepalive alone keeps the
+			// usual ratio rather than a hold time of 0
+			if p.Timers.Hold == 0 && p.Timers.Keepalive != 0 {
+				p.Timers.Hold = 3 * p.Timers.Keepalive
+				if p.Timers.Hold > 65535 {
+					p.Timers.Hold = 65535
+				}
+			}
+		}
+		c.Peers = append(c.Peers, p)
+	}
+	for _, vni := range spec.VNIs {
+		c.L2VNIs = append(c.L2VNIs, L2VNI{
+			VNI:         vni.ID,
+			EVPNRouting: fromSpecRouting(&vni.EVPNRouting),
+		})
+	}
+	for _, vrf := range spec.VRFs {
+		c.VRFs = append(c.VRFs, VRF{
+			Name:        vrf.Name,
+			VNI:         vrf.L3VNI,
+			EVPNRouting: fromSpecRouting(&vrf.EVPNRouting),
+			Prefixes:    vrf.AdvertisedPrefixes,
+		})
+	}
+	return c
+}
+
+func fromSpecRouting(routing *frrv1alpha1.EVPNRouting) EVPNRouting {
+	return EVPNRouting{
+		RD:        routing.RD,
+		ImportRTs: routing.ImportRTs,
+		ExportRTs: routing.ExportRTs,
+	}
+}
+
+// Configured returns true if the RD or any route target is set
+func (r *EVPNRouting) Configured() bool {
+	return r.RD != "" || len(r.ImportRTs) > 0 || len(r.ExportRTs) > 0
+}
+
+// Internal returns true if the peer is in the AS asn
+func (p *Peer) Internal(asn int) bool {
+	return p.RemoteAS == frrv1alpha1.BGPRemoteASInternal || p.RemoteAS == strconv.Itoa(asn)
+}
+
+// EBGP returns true if any peer is in another AS. FRR does not exchange
+// routes with eBGP peers without policies by default, and frr.conf has none.
+func (c *Config) EBGP() bool {
+	for i := range c.Peers {
+		if !c.Peers[i].Internal(c.ASNumber) {
+			return true
+		}
+	}
+	return false
+}
+
+// AddressFamilies returns the address-family blocks of router bgp. The l2vpn
+// evpn block is always rendered, it advertises the VNIs.
+func (c *Config) AddressFamilies() []AddressFamily {
+	var families []AddressFamily
+	for _, af := range addressFamilies {
+		family := AddressFamily{Name: af.name}
+		for _, peer := range c.Peers {
+			for _, f := range peer.AddressFamilies {
+				if f == af.family {
+					family.Peers = append(family.Peers, peer)
+					break
+				}
+			}
+		}
+		if len(family.Peers) > 0 || af.family == frrv1alpha1.BGPAddressFamilyL2VPNEVPN {
+			families = append(families, family)
+		}
+	}
+	return families
+}
+
+// IPv4Prefixes returns the IPv4 prefixes advertised from the VRF
+func (v *VRF) IPv4Prefixes() []string {
+	return v.prefixes(false)
+}
+
+// IPv6Prefixes returns the IPv6 prefixes advertised from the VRF
+func (v *VRF) IPv6Prefixes() []string {
+	return v.prefixes(true)
+}
+
+func (v *VRF) prefixes(ipv6 bool) []string {
+	var prefixes []string
+	for _, prefix := range v.Prefixes {
+		ip, _, err := net.ParseCIDR(prefix)
+		if err == nil && (ip.To4() == nil) == ipv6 {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	return prefixes
+}
+
+// Validate returns an error if the configuration cannot be rendered into a
+// valid frr.conf
+func (c *Config) Validate() error {
+	if c.ASNumber <= 0 || c.ASNumber > maxASNumber {
+		return fmt.Errorf("invalid AS number %d", c.ASNumber)
+	}
+	if c.RouterID != VTEPLocalPlaceholder {
+		if ip := net.ParseIP(c.RouterID); ip == nil || ip.To4() == nil {
+			return fmt.Errorf("invalid router ID %q, must be an IPv4 address", c.RouterID)
+		}
+	}
+	seen := make(map[string]bool)
+	for i := range c.Peers {
+		peer := &c.Peers[i]
+		if net.ParseIP(peer.Address) == nil {
+			return fmt.Errorf("invalid neighbor %q, must be an IP address", peer.Address)
+		}
+		if seen[peer.Address] {
+			return fmt.Errorf("duplicate neighbor %q", peer.Address)
+		}
+		seen[peer.Address] = true
+		if err := peer.validate(c.ASNumber); err != nil {
+			return fmt.Errorf("neighbor %s: %v", peer.Address, err)
+		}
+	}
+	vnis := make(map[int]bool)
+	for i := range c.L2VNIs {
+		vni := &c.L2VNIs[i]
+		if vni.VNI <= 0 || vni.VNI > maxVNI {
+			return fmt.Errorf("invalid VNI %d", vni.VNI)
+		}
+		if vnis[vni.VNI] {
+			return fmt.Errorf("duplicate VNI %d", vni.VNI)
+		}
+		vnis[vni.VNI] = true
+		if err := vni.validate(); err != nil {
+			return fmt.Errorf("VNI %d: %v", vni.VNI, err)
+		}
+	}
+	vrfNames := make(map[string]bool)
+	for i := range c.VRFs {
+		vrf := &c.VRFs[i]
+		if vrfNames[vrf.Name] {
+			return fmt.Errorf("duplicate VRF %q", vrf.Name)
+		}
+		vrfNames[vrf.Name] = true
+		if err := vrf.validate(); err != nil {
+			return fmt.Errorf("VRF %s: %v", vrf.Name, err)
+		}
+		if vnis[vrf.VNI] {
+			return fmt.Errorf("VRF %s: duplicate L3VNI %d", vrf.Name, vrf.VNI)
+		}
+		vnis[vrf.VNI] = true
+	}
+	return nil
+}
+
+func (v *VRF) validate() error {
+	if v.Name == "" || len(v.Name) > maxVRFNameLength || strings.ContainsAny(v.Name, " \t\r\n/") {
+		return fmt.Errorf("invalid name, must be a device name of at most %d characters", maxVRFNameLength)
+	}
+	// The default VRF is the one of router bgp
+	if v.Name == "default" {
+		return fmt.Errorf("the default VRF cannot be configured")
+	}
+	if v.VNI <= 0 || v.VNI > maxVNI {
+		return fmt.Errorf("invalid L3VNI %d", v.VNI)
+	}
+	if err := v.EVPNRouting.validate(); err != nil {
+		return err
+	}
+	for _, prefix := range v.Prefixes {
+		ip, ipNet, err := net.ParseCIDR(prefix)
+		if err != nil {
+			return fmt.Errorf("invalid prefix %q", prefix)
+		}
+		// FRR refuses a network with host bits set
+		if !ip.Equal(ipNet.IP) {
+			return fmt.Errorf("invalid prefix %q, did you mean %s", prefix, ipNet)
+		}
+	}
+	return nil
+}
+
+func (r *EVPNRouting) validate() error {
+	if r.RD != "" {
+		if err := validateASNOrIPValue(r.RD); err != nil {
+			return fmt.Errorf("invalid route distinguisher %q: %v", r.RD, err)
+		}
+	}
+	for _, rts := range [][]string{r.ImportRTs, r.ExportRTs} {
+		for _, rt := range rts {
+			if err := validateASNOrIPValue(rt); err != nil {
+				return fmt.Errorf("invalid route target %q: %v", rt, err)
+			}
+		}
+	}
+	return nil
+}
+
+// validateASNOrIPValue returns an error unless value, a route distinguisher
+// or a route target, is ASN:NN, with a 2-byte AS number and a 4-byte value
+// or a 4-byte AS number and a 2-byte value, or IP:NN, with an IPv4 address
+// and a 2-byte value
+func validateASNOrIPValue(value string) error {
+	i := strings.LastIndex(value, ":")
+	if i < 0 {
+		return fmt.Errorf("must be ASN:NN or IP:NN")
+	}
+	admin, assigned := value[:i], value[i+1:]
+	maxAssigned := uint64(65535)
+	if ip := net.ParseIP(admin); ip == nil || ip.To4() == nil {
+		asn, err := strconv.ParseUint(admin, 10, 32)
+		if err != nil || asn == 0 {
+			return fmt.Errorf("must be ASN:NN or IP:NN")
+		}
+		if asn <= 65535 {
+			maxAssigned = 4294967295
+		}
+	}
+	if n, err := strconv.ParseUint(assigned, 10, 32); err != nil || n > maxAssigned {
+		return fmt.Errorf("the assigned number must be 0-%d", maxAssigned)
+	}
+	return nil
+}
+
+// DerivedRouteTarget returns the route target of the given VNI in the AS
+// asn, AS:VNI, with the low-order 2 bytes of a 4-byte AS number, as RFC 8365
+// derives it
+func DerivedRouteTarget(asn, vni int) string {
+	return fmt.Sprintf("%d:%d", asn&0xffff, vni)
+}
+
+func (p *Peer) validate(asn int) error {
+	switch p.RemoteAS {
+	case frrv1alpha1.BGPRemoteASInternal, frrv1alpha1.BGPRemoteASExternal:
+	default:
+		remoteAS, err := strconv.Atoi(p.RemoteAS)
+		if err != nil || remoteAS <= 0 || remoteAS > maxASNumber {
+			return fmt.Errorf("invalid remote AS %q", p.RemoteAS)
+		}
+	}
+	if strings.ContainsAny(p.Description, "\r\n") {
+		return fmt.Errorf("description must fit on one line")
+	}
+	if strings.ContainsAny(p.UpdateSource, " \t\r\n") {
+		return fmt.Errorf("invalid source interface %q", p.UpdateSource)
+	}
+	if p.EBGPMultihop != 0 {
+		if p.EBGPMultihop < 0 || p.EBGPMultihop > maxEBGPMultihop {
+			return fmt.Errorf("invalid eBGP multihop %d", p.EBGPMultihop)
+		}
+		if p.Internal(asn) {
+			return fmt.Errorf("eBGP multihop cannot be set on an iBGP peer")
+		}
+	}
+	if p.AllowASIn < 0 || p.AllowASIn > maxAllowASIn {
+		return fmt.Errorf("invalid allowas-in %d, must be 1-%d", p.AllowASIn, maxAllowASIn)
+	}
+	if p.ASOverride && p.Internal(asn) {
+		return fmt.Errorf("AS override cannot be set on an iBGP peer")
+	}
+	if len(p.Password) > maxPasswordLength {
+		return fmt.Errorf("password longer than %d characters", maxPasswordLength)
+	}
+	// frr.conf has no quoting, the password is a single word
+	if strings.ContainsAny(p.Password, " \t\r\n") {
+		return fmt.Errorf("password must not contain whitespace")
+	}
+	if p.Timers != nil {
+		if p.Timers.Keepalive < 0 || p.Timers.Keepalive > 65535 {
+			return fmt.Errorf("invalid keepalive timer %d", p.Timers.Keepalive)
+		}
+		// A hold time of 0 disables the keepalives
+		if p.Timers.Hold != 0 && (p.Timers.Hold < 3 || p.Timers.Hold > 65535) {
+			return fmt.Errorf("invalid hold timer %d, must be 0 or 3-65535", p.Timers.Hold)
+		}
+	}
+	for _, family := range p.AddressFamilies {
+		known := false
+		for _, af := range addressFamilies {
+			known = known || af.family == family
+		}
+		if !known {
+			return fmt.Errorf("unknown address family %q", family)
+		}
+	}
+	return nil
+}
+
+// Render validates the configuration and renders it into frr.conf
+func Render(c *Config) ([]byte, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, c); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Hash returns a short hash of a rendered configuration, suitable for an
+// annotation value
+func Hash(config []byte) string {
+	hasher := fnv.New32a()
+	hasher.Write(config)
+	return rand.SafeEncodeString(fmt.Sprint(hasher.Sum32()))
+}
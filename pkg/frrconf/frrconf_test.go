@@ -0,0 +1,261 @@
+package frrconf
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	frrv1alpha1 "github.com/guohao117/frr-controller/pkg/apis/frrcontroller/v1alpha1"
+)
+
+var update = flag.Bool("update", false, "update the golden files")
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name   string
+		config *Config
+	}{
+		{
+			name:   "no-neighbors",
+			config: &Config{ASNumber: 65001, RouterID: "10.0.0.1"},
+		},
+		{
+			name: "neighbors",
+			config: FromSpec(&frrv1alpha1.FrrSpec{
+				Neighbors: []string{"172.20.0.5", "172.20.0.6"},
+			}, 65001),
+		},
+		{
+			name: "peers",
+			config: FromSpec(&frrv1alpha1.FrrSpec{
+				Neighbors: []string{"172.20.0.5"},
+				Peers: []frrv1alpha1.BGPPeer{{
+					Address: "172.20.0.6",
+				}, {
+					Address:         "10.1.0.1",
+					RemoteAS:        "65100",
+					Description:     "spine 1",
+					SourceInterface: "lo",
+					EBGPMultihop:    2,
+					Timers:          &frrv1alpha1.BGPTimers{KeepaliveSeconds: 3, HoldSeconds: 9},
+					AddressFamilies: []frrv1alpha1.BGPAddressFamily{
+						frrv1alpha1.BGPAddressFamilyL2VPNEVPN,
+						frrv1alpha1.BGPAddressFamilyIPv6Unicast,
+					},
+					BFD: true,
+				}, {
+					Address:         "fd00::1",
+					RemoteAS:        frrv1alpha1.BGPRemoteASExternal,
+					AddressFamilies: []frrv1alpha1.BGPAddressFamily{frrv1alpha1.BGPAddressFamilyIPv6Unicast},
+				}},
+			}, 65001),
+		},
+		{
+			name: "ebgp",
+			config: FromSpec(&frrv1alpha1.FrrSpec{
+				Peers: []frrv1alpha1.BGPPeer{{
+					Address:   "172.20.0.5",
+					RemoteAS:  "65001",
+					AllowASIn: 1,
+				}, {
+					Address:    "10.1.0.1",
+					RemoteAS:   "65100",
+					ASOverride: true,
+					AddressFamilies: []frrv1alpha1.BGPAddressFamily{
+						frrv1alpha1.BGPAddressFamilyIPv4Unicast,
+						frrv1alpha1.BGPAddressFamilyL2VPNEVPN,
+					},
+				}, {
+					Address:   "10.1.0.2",
+					RemoteAS:  frrv1alpha1.BGPRemoteASExternal,
+					AllowASIn: 2,
+				}},
+			}, 65001),
+		},
+		{
+			name: "timers",
+			config: FromSpec(&frrv1alpha1.FrrSpec{
+				Peers: []frrv1alpha1.BGPPeer{{
+					Address: "172.20.0.5",
+					Timers:  &frrv1alpha1.BGPTimers{KeepaliveSeconds: 10},
+				}, {
+					Address: "172.20.0.6",
+					Timers:  &frrv1alpha1.BGPTimers{KeepaliveSeconds: 30000},
+				}, {
+					Address: "172.20.0.7",
+					Timers:  &frrv1alpha1.BGPTimers{KeepaliveSeconds: 5, HoldSeconds: 20},
+				}, {
+					Address: "172.20.0.8",
+					Timers:  &frrv1alpha1.BGPTimers{},
+				}},
+			}, 65001),
+		},
+		{
+			name: "passwords",
+			config: withPeers(Peer{
+				Address:         "172.20.0.5",
+				RemoteAS:        frrv1alpha1.BGPRemoteASInternal,
+				AddressFamilies: []frrv1alpha1.BGPAddressFamily{frrv1alpha1.BGPAddressFamilyL2VPNEVPN},
+				Password:        "s3cr3t",
+			}, Peer{
+				Address:         "172.20.0.6",
+				RemoteAS:        frrv1alpha1.BGPRemoteASInternal,
+				AddressFamilies: []frrv1alpha1.BGPAddressFamily{frrv1alpha1.BGPAddressFamilyL2VPNEVPN},
+			}),
+		},
+		{
+			name: "vrfs",
+			config: FromSpec(&frrv1alpha1.FrrSpec{
+				Peers: []frrv1alpha1.BGPPeer{{
+					Address: "172.20.0.5",
+				}},
+				VRFs: []frrv1alpha1.VRF{{
+					Name:  "tenant-a",
+					L3VNI: 50001,
+					EVPNRouting: frrv1alpha1.EVPNRouting{
+						ImportRTs: []string{"65001:50001", "10.0.0.1:5"},
+						ExportRTs: []string{"65001:50001"},
+					},
+					AdvertisedPrefixes: []string{"10.10.0.0/24", "fd10::/64", "10.11.0.0/16"},
+				}, {
+					Name:  "tenant-b",
+					L3VNI: 50002,
+				}},
+			}, 65001),
+		},
+		{
+			name: "route-targets",
+			config: FromSpec(&frrv1alpha1.FrrSpec{
+				Peers: []frrv1alpha1.BGPPeer{{
+					Address: "172.20.0.5",
+				}},
+				VNIs: []frrv1alpha1.L2VNI{{
+					Name: "blue",
+					ID:   10010,
+					EVPNRouting: frrv1alpha1.EVPNRouting{
+						RD:        "10.0.0.1:10",
+						ImportRTs: []string{"65001:10010", "65100:10010"},
+						ExportRTs: []string{"65001:10010"},
+					},
+				}, {
+					// Left to FRR
+					Name: "red",
+					ID:   10020,
+				}},
+				VRFs: []frrv1alpha1.VRF{{
+					Name:  "tenant-a",
+					L3VNI: 50001,
+					EVPNRouting: frrv1alpha1.EVPNRouting{
+						RD:        "65001:50001",
+						ImportRTs: []string{"4200000001:5"},
+					},
+				}},
+			}, 65001),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := Render(test.config)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			golden := filepath.Join("testdata", test.name+".golden")
+			if *update {
+				if err := os.WriteFile(golden, got, 0644); err != nil {
+					t.Fatalf("failed to update %s: %v", golden, err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("failed to read %s: %v", golden, err)
+			}
+			if string(got) != string(want) {
+				t.Errorf("rendered config differs from %s:\n%s", golden, got)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		config *Config
+	}{
+		{"zero AS number", &Config{ASNumber: 0, RouterID: VTEPLocalPlaceholder}},
+		{"AS number too large", &Config{ASNumber: maxASNumber + 1, RouterID: VTEPLocalPlaceholder}},
+		{"IPv6 router ID", &Config{ASNumber: 65001, RouterID: "fd00::1"}},
+		{"invalid neighbor", withPeers(Peer{Address: "peer", RemoteAS: "internal"})},
+		{"duplicate neighbor", withPeers(Peer{Address: "10.0.0.1", RemoteAS: "internal"}, Peer{Address: "10.0.0.1", RemoteAS: "65100"})},
+		{"invalid remote AS", withPeers(Peer{Address: "10.0.0.1", RemoteAS: "AS65100"})},
+		{"remote AS too large", withPeers(Peer{Address: "10.0.0.1", RemoteAS: "4294967296"})},
+		{"multiline description", withPeers(Peer{Address: "10.0.0.1", RemoteAS: "internal", Description: "spine\nexit"})},
+		{"invalid source interface", withPeers(Peer{Address: "10.0.0.1", RemoteAS: "internal", UpdateSource: "eth0 eth1"})},
+		{"iBGP multihop", withPeers(Peer{Address: "10.0.0.1", RemoteAS: "65001", EBGPMultihop: 2})},
+		{"eBGP multihop too large", withPeers(Peer{Address: "10.0.0.1", RemoteAS: "external", EBGPMultihop: 256})},
+		{"hold timer too small", withPeers(Peer{Address: "10.0.0.1", RemoteAS: "internal", Timers: &Timers{Keepalive: 1, Hold: 2}})},
+		{"allowas-in too large", withPeers(Peer{Address: "10.0.0.1", RemoteAS: "internal", AllowASIn: 11})},
+		{"iBGP AS override", withPeers(Peer{Address: "10.0.0.1", RemoteAS: "internal", ASOverride: true})},
+		{"password with a space", withPeers(Peer{Address: "10.0.0.1", RemoteAS: "internal", Password: "s3cr3t exit"})},
+		{"password too long", withPeers(Peer{Address: "10.0.0.1", RemoteAS: "internal", Password: strings.Repeat("x", maxPasswordLength+1)})},
+		{"unknown address family", withPeers(Peer{Address: "10.0.0.1", RemoteAS: "internal", AddressFamilies: []frrv1alpha1.BGPAddressFamily{"ipv4-multicast"}})},
+		{"VRF without L3VNI", withVRFs(VRF{Name: "tenant-a"})},
+		{"L3VNI too large", withVRFs(VRF{Name: "tenant-a", VNI: maxVNI + 1})},
+		{"default VRF", withVRFs(VRF{Name: "default", VNI: 50001})},
+		{"VRF name too long", withVRFs(VRF{Name: "tenant-with-a-long-name", VNI: 50001})},
+		{"duplicate VRF", withVRFs(VRF{Name: "tenant-a", VNI: 50001}, VRF{Name: "tenant-a", VNI: 50002})},
+		{"duplicate L3VNI", withVRFs(VRF{Name: "tenant-a", VNI: 50001}, VRF{Name: "tenant-b", VNI: 50001})},
+		{"route target without value", withVRFs(VRF{Name: "tenant-a", VNI: 50001, EVPNRouting: EVPNRouting{ImportRTs: []string{"65001"}}})},
+		{"route target with 4-byte AS and value", withVRFs(VRF{Name: "tenant-a", VNI: 50001, EVPNRouting: EVPNRouting{ExportRTs: []string{"4200000000:65536"}}})},
+		{"route target with IPv6 address", withVRFs(VRF{Name: "tenant-a", VNI: 50001, EVPNRouting: EVPNRouting{ExportRTs: []string{"fd00::1:5"}}})},
+		{"route target with AS 0", withVRFs(VRF{Name: "tenant-a", VNI: 50001, EVPNRouting: EVPNRouting{ExportRTs: []string{"0:5"}}})},
+		{"route distinguisher with IP and large value", withVRFs(VRF{Name: "tenant-a", VNI: 50001, EVPNRouting: EVPNRouting{RD: "10.0.0.1:65536"}})},
+		{"L2VNI route distinguisher", withL2VNIs(L2VNI{VNI: 10010, EVPNRouting: EVPNRouting{RD: "auto"}})},
+		{"L2VNI route target", withL2VNIs(L2VNI{VNI: 10010, EVPNRouting: EVPNRouting{ImportRTs: []string{"65001:x"}}})},
+		{"L2VNI without VNI", withL2VNIs(L2VNI{EVPNRouting: EVPNRouting{RD: "65001:1"}})},
+		{"duplicate VNI", withL2VNIs(L2VNI{VNI: 10010}, L2VNI{VNI: 10010})},
+		{"L3VNI of a L2VNI", &Config{ASNumber: 65001, RouterID: VTEPLocalPlaceholder, L2VNIs: []L2VNI{{VNI: 10010}}, VRFs: []VRF{{Name: "tenant-a", VNI: 10010}}}},
+		{"invalid prefix", withVRFs(VRF{Name: "tenant-a", VNI: 50001, Prefixes: []string{"10.10.0.0"}})},
+		{"prefix with host bits", withVRFs(VRF{Name: "tenant-a", VNI: 50001, Prefixes: []string{"10.10.0.1/24"}})},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := Render(test.config); err == nil {
+				t.Errorf("expected an error")
+			}
+		})
+	}
+}
+
+func withPeers(peers ...Peer) *Config {
+	return &Config{ASNumber: 65001, RouterID: VTEPLocalPlaceholder, Peers: peers}
+}
+
+func withVRFs(vrfs ...VRF) *Config {
+	return &Config{ASNumber: 65001, RouterID: VTEPLocalPlaceholder, VRFs: vrfs}
+}
+
+func withL2VNIs(vnis ...L2VNI) *Config {
+	return &Config{ASNumber: 65001, RouterID: VTEPLocalPlaceholder, L2VNIs: vnis}
+}
+
+func TestDerivedRouteTarget(t *testing.T) {
+	for _, test := range []struct {
+		asn, vni int
+		want     string
+	}{
+		{65001, 10010, "65001:10010"},
+		{65001, 16777215, "65001:16777215"},
+		// The low-order 2 bytes of a 4-byte AS number
+		{4200000001, 10010, "59905:10010"},
+	} {
+		got := DerivedRouteTarget(test.asn, test.vni)
+		if got != test.want {
+			t.Errorf("DerivedRouteTarget(%d, %d) = %s, want %s", test.asn, test.vni, got, test.want)
+		}
+		if err := validateASNOrIPValue(got); err != nil {
+			t.Errorf("DerivedRouteTarget(%d, %d) = %s: %v", test.asn, test.vni, got, err)
+		}
+	}
+}
@@ -28,10 +28,18 @@ type FakeFrrcontrollerV1alpha1 struct {
 	*testing.Fake
 }
 
+func (c *FakeFrrcontrollerV1alpha1) ASNPools() v1alpha1.ASNPoolInterface {
+	return &FakeASNPools{c}
+}
+
 func (c *FakeFrrcontrollerV1alpha1) Frrs(namespace string) v1alpha1.FrrInterface {
 	return &FakeFrrs{c, namespace}
 }
 
+func (c *FakeFrrcontrollerV1alpha1) VNIPools() v1alpha1.VNIPoolInterface {
+	return &FakeVNIPools{c}
+}
+
 // RESTClient returns a RESTClient that is used to communicate
 // with API server by this client implementation.
 func (c *FakeFrrcontrollerV1alpha1) RESTClient() rest.Interface {
@@ -28,7 +28,9 @@ import (
 
 type FrrcontrollerV1alpha1Interface interface {
 	RESTClient() rest.Interface
+	ASNPoolsGetter
 	FrrsGetter
+	VNIPoolsGetter
 }
 
 // FrrcontrollerV1alpha1Client is used to interact with features provided by the frrcontroller.nocsys.cn group.
@@ -36,10 +38,18 @@ type FrrcontrollerV1alpha1Client struct {
 	restClient rest.Interface
 }
 
+func (c *FrrcontrollerV1alpha1Client) ASNPools() ASNPoolInterface {
+	return newASNPools(c)
+}
+
 func (c *FrrcontrollerV1alpha1Client) Frrs(namespace string) FrrInterface {
 	return newFrrs(c, namespace)
 }
 
+func (c *FrrcontrollerV1alpha1Client) VNIPools() VNIPoolInterface {
+	return newVNIPools(c)
+}
+
 // NewForConfig creates a new FrrcontrollerV1alpha1Client for the given config.
 // NewForConfig is equivalent to NewForConfigAndClient(c, httpClient),
 // where httpClient was generated with rest.HTTPClientFor(c).
@@ -18,4 +18,8 @@ limitations under the License.
 
 package v1alpha1
 
+type ASNPoolExpansion interface{}
+
 type FrrExpansion interface{}
+
+type VNIPoolExpansion interface{}
@@ -24,8 +24,12 @@ import (
 
 // Interface provides access to all the informers in this group version.
 type Interface interface {
+	// ASNPools returns a ASNPoolInformer.
+	ASNPools() ASNPoolInformer
 	// Frrs returns a FrrInformer.
 	Frrs() FrrInformer
+	// VNIPools returns a VNIPoolInformer.
+	VNIPools() VNIPoolInformer
 }
 
 type version struct {
@@ -39,7 +43,17 @@ func New(f internalinterfaces.SharedInformerFactory, namespace string, tweakList
 	return &version{factory: f, namespace: namespace, tweakListOptions: tweakListOptions}
 }
 
+// ASNPools returns a ASNPoolInformer.
+func (v *version) ASNPools() ASNPoolInformer {
+	return &aSNPoolInformer{factory: v.factory, tweakListOptions: v.tweakListOptions}
+}
+
 // Frrs returns a FrrInformer.
 func (v *version) Frrs() FrrInformer {
 	return &frrInformer{factory: v.factory, namespace: v.namespace, tweakListOptions: v.tweakListOptions}
 }
+
+// VNIPools returns a VNIPoolInformer.
+func (v *version) VNIPools() VNIPoolInformer {
+	return &vNIPoolInformer{factory: v.factory, tweakListOptions: v.tweakListOptions}
+}
@@ -53,8 +53,12 @@ func (f *genericInformer) Lister() cache.GenericLister {
 func (f *sharedInformerFactory) ForResource(resource schema.GroupVersionResource) (GenericInformer, error) {
 	switch resource {
 	// Group=frrcontroller.nocsys.cn, Version=v1alpha1
+	case v1alpha1.SchemeGroupVersion.WithResource("asnpools"):
+		return &genericInformer{resource: resource.GroupResource(), informer: f.Frrcontroller().V1alpha1().ASNPools().Informer()}, nil
 	case v1alpha1.SchemeGroupVersion.WithResource("frrs"):
 		return &genericInformer{resource: resource.GroupResource(), informer: f.Frrcontroller().V1alpha1().Frrs().Informer()}, nil
+	case v1alpha1.SchemeGroupVersion.WithResource("vnipools"):
+		return &genericInformer{resource: resource.GroupResource(), informer: f.Frrcontroller().V1alpha1().VNIPools().Informer()}, nil
 
 	}
 
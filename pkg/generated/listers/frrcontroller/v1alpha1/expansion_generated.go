@@ -18,6 +18,10 @@ limitations under the License.
 
 package v1alpha1
 
+// ASNPoolListerExpansion allows custom methods to be added to
+// ASNPoolLister.
+type ASNPoolListerExpansion interface{}
+
 // FrrListerExpansion allows custom methods to be added to
 // FrrLister.
 type FrrListerExpansion interface{}
@@ -25,3 +29,7 @@ type FrrListerExpansion interface{}
 // FrrNamespaceListerExpansion allows custom methods to be added to
 // FrrNamespaceLister.
 type FrrNamespaceListerExpansion interface{}
+
+// VNIPoolListerExpansion allows custom methods to be added to
+// VNIPoolLister.
+type VNIPoolListerExpansion interface{}
@@ -0,0 +1,62 @@
+// Package metrics exports the Prometheus metrics of the frr controller
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "frr_controller"
+
+// Registry holds every metric of the controller
+var Registry = prometheus.NewRegistry()
+
+var (
+	reconcileTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "reconcile_total",
+		Help:      "Number of Frr reconciles, by result.",
+	}, []string{"result"})
+	reconcileErrors = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "reconcile_errors_total",
+		Help:      "Number of Frr reconciles which failed and were requeued.",
+	})
+	reconcileDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "reconcile_duration_seconds",
+		Help:      "Time taken by Frr reconciles.",
+		Buckets:   prometheus.ExponentialBuckets(0.001, 2, 15),
+	})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		reconcileTotal,
+		reconcileErrors,
+		reconcileDuration,
+	)
+}
+
+// ObserveReconcile records a reconcile which started at start and ended
+// with err
+func ObserveReconcile(start time.Time, err error) {
+	reconcileDuration.Observe(time.Since(start).Seconds())
+	if err != nil {
+		reconcileTotal.WithLabelValues("error").Inc()
+		reconcileErrors.Inc()
+		return
+	}
+	reconcileTotal.WithLabelValues("success").Inc()
+}
+
+// Handler serves the metrics of Registry
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
@@ -0,0 +1,118 @@
+package metrics
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"k8s.io/client-go/util/workqueue"
+)
+
+func TestRegistered(t *testing.T) {
+	collectors := map[string]prometheus.Collector{
+		"reconcile_total":                             reconcileTotal,
+		"reconcile_errors_total":                      reconcileErrors,
+		"reconcile_duration_seconds":                  reconcileDuration,
+		"workqueue_depth":                             workqueueDepth,
+		"workqueue_adds_total":                        workqueueAdds,
+		"workqueue_queue_duration_seconds":            workqueueLatency,
+		"workqueue_work_duration_seconds":             workqueueWorkDuration,
+		"workqueue_unfinished_work_seconds":           workqueueUnfinishedWork,
+		"workqueue_longest_running_processor_seconds": workqueueLongestRunningProcessor,
+		"workqueue_retries_total":                     workqueueRetries,
+	}
+	for name, collector := range collectors {
+		err := Registry.Register(collector)
+		if _, ok := err.(prometheus.AlreadyRegisteredError); !ok {
+			t.Errorf("expected %s to be registered, registering it again returned %v", name, err)
+		}
+	}
+}
+
+func TestObserveReconcile(t *testing.T) {
+	success := testutil.ToFloat64(reconcileTotal.WithLabelValues("success"))
+	failure := testutil.ToFloat64(reconcileTotal.WithLabelValues("error"))
+	errs := testutil.ToFloat64(reconcileErrors)
+	observed := reconcileCount(t)
+
+	ObserveReconcile(time.Now(), nil)
+	ObserveReconcile(time.Now(), nil)
+	ObserveReconcile(time.Now(), errors.New("failed"))
+
+	if got := testutil.ToFloat64(reconcileTotal.WithLabelValues("success")) - success; got != 2 {
+		t.Errorf("expected 2 successful reconciles, got %v", got)
+	}
+	if got := testutil.ToFloat64(reconcileTotal.WithLabelValues("error")) - failure; got != 1 {
+		t.Errorf("expected 1 failed reconcile, got %v", got)
+	}
+	if got := testutil.ToFloat64(reconcileErrors) - errs; got != 1 {
+		t.Errorf("expected 1 reconcile error, got %v", got)
+	}
+	if got := reconcileCount(t) - observed; got != 3 {
+		t.Errorf("expected 3 reconcile durations, got %d", got)
+	}
+}
+
+// reconcileCount returns the number of durations observed by
+// reconcileDuration
+func reconcileCount(t *testing.T) uint64 {
+	m := &dto.Metric{}
+	if err := reconcileDuration.Write(m); err != nil {
+		t.Fatalf("unexpected error reading reconcile durations: %v", err)
+	}
+	return m.GetHistogram().GetSampleCount()
+}
+
+func TestPoolCollector(t *testing.T) {
+	usage := []PoolUsage{
+		{Kind: "VNIPool", Name: "default", Used: 3, Free: 97},
+		{Kind: "ASNPool", Name: "default", Used: 0, Free: 10},
+	}
+	collector := &poolCollector{usage: func() []PoolUsage { return usage }}
+
+	exp := `
+# HELP frr_controller_pool_free Number of VNIs or ASNs still available in a pool.
+# TYPE frr_controller_pool_free gauge
+frr_controller_pool_free{kind="ASNPool",pool="default"} 10
+frr_controller_pool_free{kind="VNIPool",pool="default"} 97
+# HELP frr_controller_pool_used Number of VNIs or ASNs allocated from a pool.
+# TYPE frr_controller_pool_used gauge
+frr_controller_pool_used{kind="ASNPool",pool="default"} 0
+frr_controller_pool_used{kind="VNIPool",pool="default"} 3
+`
+	if err := testutil.CollectAndCompare(collector, strings.NewReader(exp)); err != nil {
+		t.Error(err)
+	}
+
+	// Read on every scrape, an allocation shows up without any update
+	usage[1].Used, usage[1].Free = 1, 9
+	exp = strings.Replace(exp, `{kind="ASNPool",pool="default"} 10`, `{kind="ASNPool",pool="default"} 9`, 1)
+	exp = strings.Replace(exp, `{kind="ASNPool",pool="default"} 0`, `{kind="ASNPool",pool="default"} 1`, 1)
+	if err := testutil.CollectAndCompare(collector, strings.NewReader(exp)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestWorkqueueMetrics(t *testing.T) {
+	queue := workqueue.NewNamed("test")
+	defer queue.ShutDown()
+
+	queue.Add("default/a")
+	queue.Add("default/b")
+	if got := testutil.ToFloat64(workqueueAdds.WithLabelValues("test")); got != 2 {
+		t.Errorf("expected 2 adds, got %v", got)
+	}
+	if got := testutil.ToFloat64(workqueueDepth.WithLabelValues("test")); got != 2 {
+		t.Errorf("expected a depth of 2, got %v", got)
+	}
+
+	item, _ := queue.Get()
+	queue.Done(item)
+	if got := testutil.ToFloat64(workqueueDepth.WithLabelValues("test")); got != 1 {
+		t.Errorf("expected a depth of 1, got %v", got)
+	}
+}
@@ -0,0 +1,49 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// PoolUsage is the utilization of the allocator of a VNI or ASN pool
+type PoolUsage struct {
+	// Kind is VNIPool or ASNPool
+	Kind string
+	Name string
+	Used int
+	Free int
+}
+
+var (
+	poolUsedDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "pool", "used"),
+		"Number of VNIs or ASNs allocated from a pool.",
+		[]string{"kind", "pool"}, nil)
+	poolFreeDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "pool", "free"),
+		"Number of VNIs or ASNs still available in a pool.",
+		[]string{"kind", "pool"}, nil)
+)
+
+// poolCollector reports the usage of the pools, read when scraped so that
+// pools which are created or deleted need no bookkeeping
+type poolCollector struct {
+	usage func() []PoolUsage
+}
+
+// RegisterPools makes Registry report the usage returned by usage on every
+// scrape
+func RegisterPools(usage func() []PoolUsage) error {
+	return Registry.Register(&poolCollector{usage: usage})
+}
+
+func (c *poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- poolUsedDesc
+	ch <- poolFreeDesc
+}
+
+func (c *poolCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, pool := range c.usage() {
+		ch <- prometheus.MustNewConstMetric(poolUsedDesc, prometheus.GaugeValue, float64(pool.Used), pool.Kind, pool.Name)
+		ch <- prometheus.MustNewConstMetric(poolFreeDesc, prometheus.GaugeValue, float64(pool.Free), pool.Kind, pool.Name)
+	}
+}
@@ -0,0 +1,101 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/client-go/util/workqueue"
+)
+
+const workqueueSubsystem = "workqueue"
+
+var (
+	workqueueDepth = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: workqueueSubsystem,
+		Name:      "depth",
+		Help:      "Current depth of the workqueue.",
+	}, []string{"name"})
+	workqueueAdds = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: workqueueSubsystem,
+		Name:      "adds_total",
+		Help:      "Number of adds handled by the workqueue.",
+	}, []string{"name"})
+	workqueueLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: workqueueSubsystem,
+		Name:      "queue_duration_seconds",
+		Help:      "How long an item stays in the workqueue before being requested.",
+		Buckets:   prometheus.ExponentialBuckets(10e-9, 10, 10),
+	}, []string{"name"})
+	workqueueWorkDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: workqueueSubsystem,
+		Name:      "work_duration_seconds",
+		Help:      "How long processing an item from the workqueue takes.",
+		Buckets:   prometheus.ExponentialBuckets(10e-9, 10, 10),
+	}, []string{"name"})
+	workqueueUnfinishedWork = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: workqueueSubsystem,
+		Name:      "unfinished_work_seconds",
+		Help:      "How many seconds of work has been done that is in progress.",
+	}, []string{"name"})
+	workqueueLongestRunningProcessor = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: workqueueSubsystem,
+		Name:      "longest_running_processor_seconds",
+		Help:      "How many seconds the longest running processor of the workqueue has been running.",
+	}, []string{"name"})
+	workqueueRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: workqueueSubsystem,
+		Name:      "retries_total",
+		Help:      "Number of retries handled by the workqueue.",
+	}, []string{"name"})
+)
+
+func init() {
+	Registry.MustRegister(
+		workqueueDepth,
+		workqueueAdds,
+		workqueueLatency,
+		workqueueWorkDuration,
+		workqueueUnfinishedWork,
+		workqueueLongestRunningProcessor,
+		workqueueRetries,
+	)
+	// Named workqueues created from now on report to Registry
+	workqueue.SetProvider(workqueueMetricsProvider{})
+}
+
+// workqueueMetricsProvider hands the workqueue metrics of Registry to the
+// client-go workqueues, labelled by queue name
+type workqueueMetricsProvider struct{}
+
+func (workqueueMetricsProvider) NewDepthMetric(name string) workqueue.GaugeMetric {
+	return workqueueDepth.WithLabelValues(name)
+}
+
+func (workqueueMetricsProvider) NewAddsMetric(name string) workqueue.CounterMetric {
+	return workqueueAdds.WithLabelValues(name)
+}
+
+func (workqueueMetricsProvider) NewLatencyMetric(name string) workqueue.HistogramMetric {
+	return workqueueLatency.WithLabelValues(name)
+}
+
+func (workqueueMetricsProvider) NewWorkDurationMetric(name string) workqueue.HistogramMetric {
+	return workqueueWorkDuration.WithLabelValues(name)
+}
+
+func (workqueueMetricsProvider) NewUnfinishedWorkSecondsMetric(name string) workqueue.SettableGaugeMetric {
+	return workqueueUnfinishedWork.WithLabelValues(name)
+}
+
+func (workqueueMetricsProvider) NewLongestRunningProcessorSecondsMetric(name string) workqueue.SettableGaugeMetric {
+	return workqueueLongestRunningProcessor.WithLabelValues(name)
+}
+
+func (workqueueMetricsProvider) NewRetriesMetric(name string) workqueue.CounterMetric {
+	return workqueueRetries.WithLabelValues(name)
+}
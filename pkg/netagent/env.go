@@ -0,0 +1,91 @@
+package netagent
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// NetworkFromEnv returns the network of a Frr as passed by the controller to
+// its pods: the L2VNIs in VNIS as name:vni:bridge:logicalSwitch separated by
+// spaces, or the single L2VNI in VNI and its logical switch in SUBNET, and
+// the VRFs in VRFS as name:l3vni:routerMAC separated by spaces.
+func NetworkFromEnv(getenv func(string) string) (Network, error) {
+	var n Network
+	if vnis := getenv("VNIS"); vnis != "" {
+		for _, entry := range strings.Fields(vnis) {
+			fields := strings.Split(entry, ":")
+			if len(fields) != 4 {
+				return Network{}, fmt.Errorf("invalid L2VNI %q", entry)
+			}
+			vni, err := parseVNI(fields[1])
+			if err != nil {
+				return Network{}, fmt.Errorf("invalid L2VNI %q: %v", entry, err)
+			}
+			n.L2VNIs = append(n.L2VNIs, L2VNI{VNI: vni, Bridge: fields[2], LogicalSwitch: fields[3]})
+		}
+	} else if value := getenv("VNI"); value != "" {
+		vni, err := parseVNI(value)
+		if err != nil {
+			return Network{}, fmt.Errorf("invalid VNI: %v", err)
+		}
+		n.L2VNIs = append(n.L2VNIs, L2VNI{VNI: vni, LogicalSwitch: getenv("SUBNET")})
+	}
+
+	for _, entry := range strings.Fields(getenv("VRFS")) {
+		fields := strings.SplitN(entry, ":", 3)
+		if len(fields) != 3 || fields[0] == "" {
+			return Network{}, fmt.Errorf("invalid VRF %q", entry)
+		}
+		vni, err := parseVNI(fields[1])
+		if err != nil {
+			return Network{}, fmt.Errorf("invalid VRF %q: %v", entry, err)
+		}
+		vrf := VRF{Name: fields[0], VNI: vni}
+		if fields[2] != "" {
+			if vrf.RouterMAC, err = net.ParseMAC(fields[2]); err != nil {
+				return Network{}, fmt.Errorf("invalid VRF %q: %v", entry, err)
+			}
+		}
+		n.VRFs = append(n.VRFs, vrf)
+	}
+	return n, nil
+}
+
+// VTEPLocalFromEnv returns the local address of the VTEP as passed by the
+// controller to the pods of a Frr: the first IPv4 address of the interface
+// named by VTEP_INTERFACE if set, VTEP_LOCAL otherwise. The pods run in the
+// network namespace of the node, the interface is one of the node.
+func VTEPLocalFromEnv(getenv func(string) string) (net.IP, error) {
+	name := getenv("VTEP_INTERFACE")
+	if name == "" {
+		ip := net.ParseIP(getenv("VTEP_LOCAL"))
+		if ip == nil {
+			return nil, fmt.Errorf("invalid VTEP_LOCAL %q", getenv("VTEP_LOCAL"))
+		}
+		return ip, nil
+	}
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return nil, fmt.Errorf("VTEP_INTERFACE: %v", err)
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil, fmt.Errorf("VTEP_INTERFACE %s: %v", name, err)
+	}
+	for _, addr := range addrs {
+		if ipnet, ok := addr.(*net.IPNet); ok && ipnet.IP.To4() != nil {
+			return ipnet.IP.To4(), nil
+		}
+	}
+	return nil, fmt.Errorf("VTEP_INTERFACE %s has no IPv4 address", name)
+}
+
+func parseVNI(value string) (int, error) {
+	vni, err := strconv.Atoi(value)
+	if err != nil || vni <= 0 || vni > 1<<24-1 {
+		return 0, fmt.Errorf("invalid VNI %q", value)
+	}
+	return vni, nil
+}
@@ -0,0 +1,108 @@
+package netagent
+
+import (
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestNetworkFromEnv(t *testing.T) {
+	mac, _ := net.ParseMAC("02:00:0a:0a:00:01")
+	tests := []struct {
+		name     string
+		env      map[string]string
+		expected Network
+		err      bool
+	}{{
+		name:     "single L2VNI",
+		env:      map[string]string{"VNI": "10", "SUBNET": "ls-blue"},
+		expected: Network{L2VNIs: []L2VNI{{VNI: 10, LogicalSwitch: "ls-blue"}}},
+	}, {
+		name: "L2VNIs",
+		env:  map[string]string{"VNIS": "blue:10:br-vx10:ls-blue red:20:br-red:", "VNI": "30"},
+		expected: Network{L2VNIs: []L2VNI{
+			{VNI: 10, Bridge: "br-vx10", LogicalSwitch: "ls-blue"},
+			{VNI: 20, Bridge: "br-red"},
+		}},
+	}, {
+		name: "VRFs",
+		env:  map[string]string{"VNI": "10", "VRFS": "tenant-a:50001:02:00:0a:0a:00:01 tenant-b:50002:"},
+		expected: Network{
+			L2VNIs: []L2VNI{{VNI: 10}},
+			VRFs:   []VRF{{Name: "tenant-a", VNI: 50001, RouterMAC: mac}, {Name: "tenant-b", VNI: 50002}},
+		},
+	}, {
+		name: "malformed L2VNI",
+		env:  map[string]string{"VNIS": "blue:10"},
+		err:  true,
+	}, {
+		name: "VNI out of range",
+		env:  map[string]string{"VNI": "16777216"},
+		err:  true,
+	}, {
+		name: "malformed router MAC",
+		env:  map[string]string{"VRFS": "tenant-a:50001:02:00"},
+		err:  true,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			network, err := NetworkFromEnv(func(name string) string { return test.env[name] })
+			if test.err {
+				if err == nil {
+					t.Errorf("expected an error, got %+v", network)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(network, test.expected) {
+				t.Errorf("expected %+v, got %+v", test.expected, network)
+			}
+		})
+	}
+}
+
+func TestVTEPLocalFromEnv(t *testing.T) {
+	tests := []struct {
+		name     string
+		env      map[string]string
+		expected net.IP
+		err      bool
+	}{{
+		name:     "address",
+		env:      map[string]string{"VTEP_LOCAL": "10.0.0.1"},
+		expected: net.ParseIP("10.0.0.1"),
+	}, {
+		name:     "interface",
+		env:      map[string]string{"VTEP_LOCAL": "10.0.0.1", "VTEP_INTERFACE": "lo"},
+		expected: net.ParseIP("127.0.0.1"),
+	}, {
+		name: "malformed address",
+		env:  map[string]string{"VTEP_LOCAL": "10.0.0"},
+		err:  true,
+	}, {
+		name: "missing interface",
+		env:  map[string]string{"VTEP_INTERFACE": "missing0"},
+		err:  true,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ip, err := VTEPLocalFromEnv(func(name string) string { return test.env[name] })
+			if test.err {
+				if err == nil {
+					t.Errorf("expected an error, got %v", ip)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !ip.Equal(test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, ip)
+			}
+		})
+	}
+}
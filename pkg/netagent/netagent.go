@@ -0,0 +1,461 @@
+// Package netagent builds on a node the network of the pods of a Frr: the
+// vxlan interface and the linux bridge of every L2VNI, the br-int port
+// bridging an L2VNI to its OVN logical switch, and the VRF device of every
+// VRF. Every step is idempotent and reports what it changed, so that the
+// agent can be run again on a node which is already set up, and the same
+// network can be torn down.
+package netagent
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/vishvananda/netlink"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	// DefaultVXLANPort is the IANA assigned UDP port of VXLAN
+	DefaultVXLANPort = 4789
+	// DefaultIntegrationBridge is the OVS bridge of OVN
+	DefaultIntegrationBridge = "br-int"
+	// defaultPortTimeout bounds the wait for ovs-vswitchd to create the
+	// interface of a port added to the database
+	defaultPortTimeout = 10 * time.Second
+)
+
+// L2VNI is an L2VNI of a Frr as built on the node
+type L2VNI struct {
+	VNI int
+	// Bridge is the linux bridge of the L2VNI, br-vx<VNI> when empty
+	Bridge string
+	// LogicalSwitch is the OVN logical switch bridged to the L2VNI through
+	// the intp<VNI> port of the integration bridge, if any
+	LogicalSwitch string
+}
+
+// BridgeName returns the name of the linux bridge of the L2VNI
+func (v *L2VNI) BridgeName() string {
+	if v.Bridge != "" {
+		return v.Bridge
+	}
+	return bridgeName(v.VNI)
+}
+
+// VRF is a VRF of a Frr as built on the node. The L3VNI doubles as the
+// routing table of the VRF device.
+type VRF struct {
+	Name string
+	VNI  int
+	// RouterMAC is the address of the bridge of the L3VNI, if set
+	RouterMAC net.HardwareAddr
+}
+
+// Network is what the agent builds on the node for a Frr
+type Network struct {
+	L2VNIs []L2VNI
+	VRFs   []VRF
+}
+
+func vxlanName(vni int) string {
+	return fmt.Sprintf("vx%d", vni)
+}
+
+func bridgeName(vni int) string {
+	return fmt.Sprintf("br-vx%d", vni)
+}
+
+func portName(vni int) string {
+	return fmt.Sprintf("intp%d", vni)
+}
+
+// ifaceID returns the iface-id binding the port of an L2VNI to the logical
+// switch port of its logical switch
+func ifaceID(logicalSwitch string) string {
+	return logicalSwitch + "-bm-l2gw"
+}
+
+// Action is what was done to a device
+type Action string
+
+const (
+	Created Action = "created"
+	// Recreated devices had attributes which cannot be changed in place
+	Recreated Action = "recreated"
+	Updated   Action = "updated"
+	Deleted   Action = "deleted"
+)
+
+// Change is a change made to the node
+type Change struct {
+	Action Action
+	// Kind is the kind of device: vxlan, bridge, vrf or port
+	Kind string
+	Name string
+	// Detail tells what was updated
+	Detail string
+}
+
+func (c Change) String() string {
+	s := fmt.Sprintf("%s %s %s", c.Action, c.Kind, c.Name)
+	if c.Detail != "" {
+		s += " " + c.Detail
+	}
+	return s
+}
+
+type changeLog []Change
+
+func (l *changeLog) add(action Action, kind, name, detail string) {
+	*l = append(*l, Change{Action: action, Kind: kind, Name: name, Detail: detail})
+}
+
+// created tells whether the device was created in this run
+func (l changeLog) created(kind, name string) bool {
+	for _, c := range l {
+		if c.Kind == kind && c.Name == name && (c.Action == Created || c.Action == Recreated) {
+			return true
+		}
+	}
+	return false
+}
+
+// Switch adds the internal ports of the L2VNIs to the integration bridge
+type Switch interface {
+	// EnsurePort adds the internal port to bridge, bound to the logical
+	// switch port ifaceID, and reports whether anything was changed
+	EnsurePort(bridge, port, ifaceID string) (bool, error)
+	// DeletePort removes the port from bridge and reports whether it was
+	// there
+	DeletePort(bridge, port string) (bool, error)
+}
+
+// Agent builds and tears down the network of a Frr on a node
+type Agent struct {
+	// Handle is the netlink handle of the network namespace of the node
+	Handle *netlink.Handle
+	// Switch is the Open vSwitch holding the integration bridge, it is
+	// only used by the L2VNIs bridged to a logical switch
+	Switch Switch
+	// IntegrationBridge is DefaultIntegrationBridge when empty
+	IntegrationBridge string
+	// VTEPLocal is the source address of the vxlan interfaces
+	VTEPLocal net.IP
+	// VXLANPort is DefaultVXLANPort when zero
+	VXLANPort int
+	// VXLANMTU is the MTU of the vxlan interfaces, the kernel picks it
+	// when zero
+	VXLANMTU int
+	// VXLANLearning has the vxlan interfaces learn remote MAC addresses
+	// from the traffic, they are left to EVPN otherwise
+	VXLANLearning bool
+	// VXLANTTL is the TTL of the tunnel packets, the kernel default when
+	// zero
+	VXLANTTL int
+	// PortTimeout bounds the wait for the interface of a port to show up
+	// once added to the switch
+	PortTimeout time.Duration
+}
+
+func (a *Agent) integrationBridge() string {
+	if a.IntegrationBridge != "" {
+		return a.IntegrationBridge
+	}
+	return DefaultIntegrationBridge
+}
+
+func (a *Agent) vxlanPort() int {
+	if a.VXLANPort != 0 {
+		return a.VXLANPort
+	}
+	return DefaultVXLANPort
+}
+
+// Ensure builds the network on the node and returns the changes it made.
+// It stops at the first failure, returning the changes made until then.
+func (a *Agent) Ensure(n Network) ([]Change, error) {
+	var log changeLog
+	for i := range n.L2VNIs {
+		if err := a.ensureL2VNI(&n.L2VNIs[i], &log); err != nil {
+			return log, fmt.Errorf("L2VNI %d: %v", n.L2VNIs[i].VNI, err)
+		}
+	}
+	for i := range n.VRFs {
+		if err := a.ensureVRF(&n.VRFs[i], &log); err != nil {
+			return log, fmt.Errorf("VRF %s: %v", n.VRFs[i].Name, err)
+		}
+	}
+	return log, nil
+}
+
+func (a *Agent) ensureL2VNI(v *L2VNI, log *changeLog) error {
+	bridge, err := a.ensureBridge(v.BridgeName(), log)
+	if err != nil {
+		return err
+	}
+	if err := a.ensureVXLAN(v.VNI, bridge, log); err != nil {
+		return err
+	}
+	if v.LogicalSwitch == "" {
+		return nil
+	}
+
+	port := portName(v.VNI)
+	if a.Switch == nil {
+		return fmt.Errorf("no switch to add port %s to", port)
+	}
+	changed, err := a.Switch.EnsurePort(a.integrationBridge(), port, ifaceID(v.LogicalSwitch))
+	if err != nil {
+		return fmt.Errorf("port %s: %v", port, err)
+	}
+	if changed {
+		log.add(Updated, "port", port, fmt.Sprintf("on %s, iface-id %s", a.integrationBridge(), ifaceID(v.LogicalSwitch)))
+	}
+	link, err := a.waitForLink(port)
+	if err != nil {
+		return err
+	}
+	if err := a.ensureUp(link, "port", log); err != nil {
+		return err
+	}
+	return a.ensureMaster(link, "port", bridge, log)
+}
+
+func (a *Agent) ensureVRF(v *VRF, log *changeLog) error {
+	vrf, err := a.ensureLink(&netlink.Vrf{
+		LinkAttrs: netlink.LinkAttrs{Name: v.Name},
+		Table:     uint32(v.VNI),
+	}, func(link netlink.Link) bool {
+		vrf, ok := link.(*netlink.Vrf)
+		return ok && vrf.Table == uint32(v.VNI)
+	}, log)
+	if err != nil {
+		return err
+	}
+	bridge, err := a.ensureBridge(bridgeName(v.VNI), log)
+	if err != nil {
+		return err
+	}
+	if v.RouterMAC != nil && !bytes.Equal(bridge.Attrs().HardwareAddr, v.RouterMAC) {
+		if err := a.Handle.LinkSetHardwareAddr(bridge, v.RouterMAC); err != nil {
+			return fmt.Errorf("setting the address of %s: %v", bridge.Attrs().Name, err)
+		}
+		log.add(Updated, "bridge", bridge.Attrs().Name, "address "+v.RouterMAC.String())
+	}
+	if err := a.ensureVXLAN(v.VNI, bridge, log); err != nil {
+		return err
+	}
+	return a.ensureMaster(bridge, "bridge", vrf, log)
+}
+
+func (a *Agent) ensureBridge(name string, log *changeLog) (netlink.Link, error) {
+	return a.ensureLink(&netlink.Bridge{
+		LinkAttrs: netlink.LinkAttrs{Name: name},
+	}, func(link netlink.Link) bool {
+		return link.Type() == "bridge"
+	}, log)
+}
+
+// ensureVXLAN creates the vxlan interface of vni and adds it to bridge. Its
+// MTU is changed in place, its other attributes cannot be.
+func (a *Agent) ensureVXLAN(vni int, bridge netlink.Link, log *changeLog) error {
+	vxlan, err := a.ensureLink(&netlink.Vxlan{
+		LinkAttrs: netlink.LinkAttrs{Name: vxlanName(vni), MTU: a.VXLANMTU},
+		VxlanId:   vni,
+		SrcAddr:   a.VTEPLocal,
+		Port:      a.vxlanPort(),
+		Learning:  a.VXLANLearning,
+		TTL:       a.VXLANTTL,
+	}, func(link netlink.Link) bool {
+		vxlan, ok := link.(*netlink.Vxlan)
+		return ok && vxlan.VxlanId == vni &&
+			vxlan.SrcAddr.Equal(a.VTEPLocal) &&
+			vxlan.Port == a.vxlanPort() &&
+			vxlan.Learning == a.VXLANLearning &&
+			vxlan.TTL == a.VXLANTTL
+	}, log)
+	if err != nil {
+		return err
+	}
+	if a.VXLANMTU != 0 && vxlan.Attrs().MTU != a.VXLANMTU {
+		if err := a.Handle.LinkSetMTU(vxlan, a.VXLANMTU); err != nil {
+			return fmt.Errorf("setting the MTU of %s: %v", vxlan.Attrs().Name, err)
+		}
+		log.add(Updated, "vxlan", vxlan.Attrs().Name, fmt.Sprintf("mtu %d", a.VXLANMTU))
+	}
+	return a.ensureMaster(vxlan, "vxlan", bridge, log)
+}
+
+// ensureLink creates the link, replacing a link of the same name unless it
+// matches, and sets it up. It returns the link as found on the node.
+func (a *Agent) ensureLink(link netlink.Link, matches func(netlink.Link) bool, log *changeLog) (netlink.Link, error) {
+	name := link.Attrs().Name
+	kind := link.Type()
+	existing, err := a.Handle.LinkByName(name)
+	switch {
+	case isNotFound(err):
+		if err := a.Handle.LinkAdd(link); err != nil {
+			return nil, fmt.Errorf("creating %s %s: %v", kind, name, err)
+		}
+		log.add(Created, kind, name, "")
+	case err != nil:
+		return nil, err
+	case !matches(existing):
+		if err := a.Handle.LinkDel(existing); err != nil {
+			return nil, fmt.Errorf("deleting %s: %v", name, err)
+		}
+		if err := a.Handle.LinkAdd(link); err != nil {
+			return nil, fmt.Errorf("creating %s %s: %v", kind, name, err)
+		}
+		log.add(Recreated, kind, name, "")
+	}
+
+	created, err := a.Handle.LinkByName(name)
+	if err != nil {
+		return nil, err
+	}
+	if err := a.ensureUp(created, kind, log); err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+func (a *Agent) ensureUp(link netlink.Link, kind string, log *changeLog) error {
+	if link.Attrs().Flags&net.FlagUp != 0 {
+		return nil
+	}
+	if err := a.Handle.LinkSetUp(link); err != nil {
+		return fmt.Errorf("setting %s up: %v", link.Attrs().Name, err)
+	}
+	// setting up a link just created is part of creating it
+	if !log.created(kind, link.Attrs().Name) {
+		log.add(Updated, kind, link.Attrs().Name, "up")
+	}
+	return nil
+}
+
+func (a *Agent) ensureMaster(link netlink.Link, kind string, master netlink.Link, log *changeLog) error {
+	if link.Attrs().MasterIndex == master.Attrs().Index {
+		return nil
+	}
+	if err := a.Handle.LinkSetMasterByIndex(link, master.Attrs().Index); err != nil {
+		return fmt.Errorf("adding %s to %s: %v", link.Attrs().Name, master.Attrs().Name, err)
+	}
+	log.add(Updated, kind, link.Attrs().Name, "master "+master.Attrs().Name)
+	return nil
+}
+
+// waitForLink waits for ovs-vswitchd to create the interface of a port
+func (a *Agent) waitForLink(name string) (netlink.Link, error) {
+	timeout := a.PortTimeout
+	if timeout == 0 {
+		timeout = defaultPortTimeout
+	}
+	var link netlink.Link
+	err := wait.PollImmediate(100*time.Millisecond, timeout, func() (bool, error) {
+		var err error
+		link, err = a.Handle.LinkByName(name)
+		if isNotFound(err) {
+			return false, nil
+		}
+		return err == nil, err
+	})
+	if err == wait.ErrWaitTimeout {
+		return nil, fmt.Errorf("interface %s did not show up within %s", name, timeout)
+	}
+	return link, err
+}
+
+// Delete tears down the network from the node and returns the changes it
+// made. It goes on after a failure, so that as much as possible is removed,
+// and returns every failure. Devices of the expected names but of another
+// kind are left in place.
+//
+// An L2VNI may be given by its VNI alone, as when its logical switch and
+// bridge are no longer known: its bridge is then the one its vxlan interface
+// is in, and its port is removed if its interface is found on the node.
+func (a *Agent) Delete(n Network) ([]Change, error) {
+	var log changeLog
+	var errs []error
+	for i := range n.L2VNIs {
+		v := &n.L2VNIs[i]
+		errs = append(errs, a.deletePort(v, &log))
+		bridge := v.Bridge
+		if bridge == "" {
+			bridge = a.vxlanBridge(v.VNI)
+		}
+		errs = append(errs, a.deleteLink(vxlanName(v.VNI), "vxlan", &log))
+		errs = append(errs, a.deleteLink(bridge, "bridge", &log))
+	}
+	for i := range n.VRFs {
+		v := &n.VRFs[i]
+		errs = append(errs, a.deleteLink(vxlanName(v.VNI), "vxlan", &log))
+		errs = append(errs, a.deleteLink(bridgeName(v.VNI), "bridge", &log))
+		errs = append(errs, a.deleteLink(v.Name, "vrf", &log))
+	}
+	return log, utilerrors.NewAggregate(errs)
+}
+
+func (a *Agent) deletePort(v *L2VNI, log *changeLog) error {
+	port := portName(v.VNI)
+	if v.LogicalSwitch == "" {
+		_, err := a.Handle.LinkByName(port)
+		if isNotFound(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if a.Switch == nil {
+		return fmt.Errorf("no switch to remove port %s from", port)
+	}
+	deleted, err := a.Switch.DeletePort(a.integrationBridge(), port)
+	if err != nil {
+		return fmt.Errorf("port %s: %v", port, err)
+	}
+	if deleted {
+		log.add(Deleted, "port", port, "from "+a.integrationBridge())
+	}
+	return nil
+}
+
+// vxlanBridge returns the bridge the vxlan interface of vni is in,
+// br-vx<VNI> if there is none
+func (a *Agent) vxlanBridge(vni int) string {
+	vxlan, err := a.Handle.LinkByName(vxlanName(vni))
+	if err != nil || vxlan.Attrs().MasterIndex == 0 {
+		return bridgeName(vni)
+	}
+	master, err := a.Handle.LinkByIndex(vxlan.Attrs().MasterIndex)
+	if err != nil || master.Type() != "bridge" {
+		return bridgeName(vni)
+	}
+	return master.Attrs().Name
+}
+
+func (a *Agent) deleteLink(name, kind string, log *changeLog) error {
+	link, err := a.Handle.LinkByName(name)
+	if isNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if link.Type() != kind {
+		return fmt.Errorf("%s is a %s, not a %s", name, link.Type(), kind)
+	}
+	if err := a.Handle.LinkDel(link); err != nil {
+		return fmt.Errorf("deleting %s %s: %v", kind, name, err)
+	}
+	log.add(Deleted, kind, name, "")
+	return nil
+}
+
+func isNotFound(err error) bool {
+	_, ok := err.(netlink.LinkNotFoundError)
+	return ok
+}
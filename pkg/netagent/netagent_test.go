@@ -0,0 +1,343 @@
+package netagent
+
+import (
+	"net"
+	"os"
+	"reflect"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netns"
+)
+
+// fakeSwitch stands for Open vSwitch: the interface of a port added to it
+// shows up in the network namespace as one end of a veth pair
+type fakeSwitch struct {
+	handle *netlink.Handle
+	ports  map[string]string
+}
+
+func (s *fakeSwitch) EnsurePort(bridge, port, ifaceID string) (bool, error) {
+	if s.ports[bridge+"/"+port] == ifaceID {
+		return false, nil
+	}
+	s.ports[bridge+"/"+port] = ifaceID
+	if _, err := s.handle.LinkByName(port); isNotFound(err) {
+		return true, s.handle.LinkAdd(&netlink.Veth{LinkAttrs: netlink.LinkAttrs{Name: port}, PeerName: port + "-peer"})
+	}
+	return true, nil
+}
+
+func (s *fakeSwitch) DeletePort(bridge, port string) (bool, error) {
+	if _, ok := s.ports[bridge+"/"+port]; !ok {
+		return false, nil
+	}
+	delete(s.ports, bridge+"/"+port)
+	link, err := s.handle.LinkByName(port)
+	if err != nil {
+		return true, err
+	}
+	return true, s.handle.LinkDel(link)
+}
+
+type fixture struct {
+	t      *testing.T
+	agent  *Agent
+	handle *netlink.Handle
+	ports  map[string]string
+}
+
+// newFixture returns an agent working in a network namespace of its own. It
+// skips the test unless network namespaces can be created.
+func newFixture(t *testing.T) *fixture {
+	if os.Geteuid() != 0 {
+		t.Skip("creating network namespaces requires root")
+	}
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	origin, err := netns.Get()
+	if err != nil {
+		t.Skipf("network namespaces are not supported: %v", err)
+	}
+	defer origin.Close()
+	ns, err := netns.New()
+	if err != nil {
+		t.Skipf("network namespaces are not supported: %v", err)
+	}
+	if err := netns.Set(origin); err != nil {
+		t.Fatal(err)
+	}
+	handle, err := netlink.NewHandleAt(ns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		handle.Delete()
+		ns.Close()
+	})
+
+	// vxlan interfaces need their source address on the node
+	lo, err := handle.LinkByName("lo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := handle.LinkSetUp(lo); err != nil {
+		t.Fatal(err)
+	}
+	if err := handle.LinkAdd(&netlink.Vxlan{LinkAttrs: netlink.LinkAttrs{Name: "probe"}, VxlanId: 1}); err != nil {
+		t.Skipf("vxlan interfaces are not supported: %v", err)
+	}
+	probe, _ := handle.LinkByName("probe")
+	handle.LinkDel(probe)
+
+	ports := make(map[string]string)
+	return &fixture{
+		t:      t,
+		handle: handle,
+		ports:  ports,
+		agent: &Agent{
+			Handle:      handle,
+			Switch:      &fakeSwitch{handle: handle, ports: ports},
+			VTEPLocal:   net.ParseIP("127.0.0.1"),
+			PortTimeout: time.Second,
+		},
+	}
+}
+
+func (f *fixture) link(name string) netlink.Link {
+	f.t.Helper()
+	link, err := f.handle.LinkByName(name)
+	if err != nil {
+		f.t.Fatalf("%s: %v", name, err)
+	}
+	return link
+}
+
+func (f *fixture) expectNoLink(name string) {
+	f.t.Helper()
+	if _, err := f.handle.LinkByName(name); !isNotFound(err) {
+		f.t.Errorf("%s: expected no link, got %v", name, err)
+	}
+}
+
+func (f *fixture) expectMaster(name, master string) {
+	f.t.Helper()
+	if got, want := f.link(name).Attrs().MasterIndex, f.link(master).Attrs().Index; got != want {
+		f.t.Errorf("%s: expected master %s", name, master)
+	}
+	if f.link(name).Attrs().Flags&net.FlagUp == 0 {
+		f.t.Errorf("%s: expected up", name)
+	}
+}
+
+func (f *fixture) ensure(n Network, expected ...Change) {
+	f.t.Helper()
+	changes, err := f.agent.Ensure(n)
+	if err != nil {
+		f.t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(changes, expected) {
+		f.t.Errorf("expected changes %v, got %v", expected, changes)
+	}
+}
+
+func TestEnsureL2VNI(t *testing.T) {
+	f := newFixture(t)
+	network := Network{L2VNIs: []L2VNI{{VNI: 10}, {VNI: 20, Bridge: "br-red"}}}
+
+	f.ensure(network,
+		Change{Created, "bridge", "br-vx10", ""},
+		Change{Created, "vxlan", "vx10", ""},
+		Change{Updated, "vxlan", "vx10", "master br-vx10"},
+		Change{Created, "bridge", "br-red", ""},
+		Change{Created, "vxlan", "vx20", ""},
+		Change{Updated, "vxlan", "vx20", "master br-red"},
+	)
+	vxlan, ok := f.link("vx10").(*netlink.Vxlan)
+	if !ok || vxlan.VxlanId != 10 || vxlan.Port != DefaultVXLANPort || vxlan.Learning || !vxlan.SrcAddr.Equal(f.agent.VTEPLocal) {
+		t.Errorf("unexpected vx10: %+v", f.link("vx10"))
+	}
+	f.expectMaster("vx10", "br-vx10")
+	f.expectMaster("vx20", "br-red")
+
+	// nothing to do the second time
+	f.ensure(network)
+}
+
+func TestEnsureRepairsDevices(t *testing.T) {
+	f := newFixture(t)
+	network := Network{L2VNIs: []L2VNI{{VNI: 10}}}
+	f.ensure(network,
+		Change{Created, "bridge", "br-vx10", ""},
+		Change{Created, "vxlan", "vx10", ""},
+		Change{Updated, "vxlan", "vx10", "master br-vx10"},
+	)
+
+	// a vxlan interface of another port cannot be changed in place
+	f.agent.VXLANPort = 4790
+	if err := f.handle.LinkSetDown(f.link("br-vx10")); err != nil {
+		t.Fatal(err)
+	}
+	f.ensure(network,
+		Change{Updated, "bridge", "br-vx10", "up"},
+		Change{Recreated, "vxlan", "vx10", ""},
+		Change{Updated, "vxlan", "vx10", "master br-vx10"},
+	)
+	if vxlan := f.link("vx10").(*netlink.Vxlan); vxlan.Port != 4790 {
+		t.Errorf("expected port 4790, got %d", vxlan.Port)
+	}
+	f.expectMaster("vx10", "br-vx10")
+}
+
+func TestEnsureVXLANParameters(t *testing.T) {
+	f := newFixture(t)
+	network := Network{L2VNIs: []L2VNI{{VNI: 10}}}
+	f.agent.VXLANMTU = 1450
+	f.agent.VXLANLearning = true
+	f.agent.VXLANTTL = 16
+	f.ensure(network,
+		Change{Created, "bridge", "br-vx10", ""},
+		Change{Created, "vxlan", "vx10", ""},
+		Change{Updated, "vxlan", "vx10", "master br-vx10"},
+	)
+	vxlan := f.link("vx10").(*netlink.Vxlan)
+	if vxlan.MTU != 1450 || !vxlan.Learning || vxlan.TTL != 16 {
+		t.Errorf("unexpected vx10: %+v", vxlan)
+	}
+	f.ensure(network)
+
+	// the MTU is changed in place, learning is not
+	f.agent.VXLANMTU = 1400
+	f.ensure(network, Change{Updated, "vxlan", "vx10", "mtu 1400"})
+	f.agent.VXLANLearning = false
+	f.ensure(network,
+		Change{Recreated, "vxlan", "vx10", ""},
+		Change{Updated, "vxlan", "vx10", "master br-vx10"},
+	)
+	if vxlan := f.link("vx10").(*netlink.Vxlan); vxlan.MTU != 1400 || vxlan.Learning {
+		t.Errorf("unexpected vx10: %+v", vxlan)
+	}
+}
+
+func TestEnsureLogicalSwitch(t *testing.T) {
+	f := newFixture(t)
+	network := Network{L2VNIs: []L2VNI{{VNI: 10, LogicalSwitch: "ls-blue"}}}
+
+	f.ensure(network,
+		Change{Created, "bridge", "br-vx10", ""},
+		Change{Created, "vxlan", "vx10", ""},
+		Change{Updated, "vxlan", "vx10", "master br-vx10"},
+		Change{Updated, "port", "intp10", "on br-int, iface-id ls-blue-bm-l2gw"},
+		Change{Updated, "port", "intp10", "up"},
+		Change{Updated, "port", "intp10", "master br-vx10"},
+	)
+	if f.ports["br-int/intp10"] != "ls-blue-bm-l2gw" {
+		t.Errorf("expected intp10 bound to ls-blue-bm-l2gw, got %v", f.ports)
+	}
+	f.expectMaster("intp10", "br-vx10")
+	f.ensure(network)
+}
+
+func TestEnsurePortTimeout(t *testing.T) {
+	f := newFixture(t)
+	// the port is recorded but its interface never shows up
+	f.ports["br-int/intp10"] = "ls-blue-bm-l2gw"
+	f.agent.PortTimeout = 200 * time.Millisecond
+
+	_, err := f.agent.Ensure(Network{L2VNIs: []L2VNI{{VNI: 10, LogicalSwitch: "ls-blue"}}})
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+func TestEnsureVRF(t *testing.T) {
+	f := newFixture(t)
+	if err := f.handle.LinkAdd(&netlink.Vrf{LinkAttrs: netlink.LinkAttrs{Name: "probe"}, Table: 1}); err != nil {
+		t.Skipf("VRF devices are not supported: %v", err)
+	}
+	f.handle.LinkDel(f.link("probe"))
+
+	mac, _ := net.ParseMAC("02:00:0a:0a:00:01")
+	network := Network{VRFs: []VRF{{Name: "tenant-a", VNI: 50001, RouterMAC: mac}}}
+	f.ensure(network,
+		Change{Created, "vrf", "tenant-a", ""},
+		Change{Created, "bridge", "br-vx50001", ""},
+		Change{Updated, "bridge", "br-vx50001", "address 02:00:0a:0a:00:01"},
+		Change{Created, "vxlan", "vx50001", ""},
+		Change{Updated, "vxlan", "vx50001", "master br-vx50001"},
+		Change{Updated, "bridge", "br-vx50001", "master tenant-a"},
+	)
+	if vrf := f.link("tenant-a").(*netlink.Vrf); vrf.Table != 50001 {
+		t.Errorf("expected table 50001, got %d", vrf.Table)
+	}
+	f.expectMaster("br-vx50001", "tenant-a")
+	f.ensure(network)
+}
+
+func TestDelete(t *testing.T) {
+	f := newFixture(t)
+	network := Network{L2VNIs: []L2VNI{{VNI: 10, LogicalSwitch: "ls-blue"}, {VNI: 20}}}
+	if _, err := f.agent.Ensure(network); err != nil {
+		t.Fatal(err)
+	}
+
+	changes, err := f.agent.Delete(network)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []Change{
+		{Deleted, "port", "intp10", "from br-int"},
+		{Deleted, "vxlan", "vx10", ""},
+		{Deleted, "bridge", "br-vx10", ""},
+		{Deleted, "vxlan", "vx20", ""},
+		{Deleted, "bridge", "br-vx20", ""},
+	}
+	if !reflect.DeepEqual(changes, expected) {
+		t.Errorf("expected changes %v, got %v", expected, changes)
+	}
+	for _, name := range []string{"intp10", "vx10", "br-vx10", "vx20", "br-vx20"} {
+		f.expectNoLink(name)
+	}
+
+	changes, err = f.agent.Delete(network)
+	if err != nil || len(changes) != 0 {
+		t.Errorf("expected nothing to delete, got %v, %v", changes, err)
+	}
+}
+
+func TestDeleteByVNI(t *testing.T) {
+	f := newFixture(t)
+	if _, err := f.agent.Ensure(Network{L2VNIs: []L2VNI{{VNI: 10, Bridge: "br-blue", LogicalSwitch: "ls-blue"}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the bridge and the logical switch are found on the node
+	changes, err := f.agent.Delete(Network{L2VNIs: []L2VNI{{VNI: 10}}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []Change{
+		{Deleted, "port", "intp10", "from br-int"},
+		{Deleted, "vxlan", "vx10", ""},
+		{Deleted, "bridge", "br-blue", ""},
+	}
+	if !reflect.DeepEqual(changes, expected) {
+		t.Errorf("expected changes %v, got %v", expected, changes)
+	}
+	for _, name := range []string{"intp10", "vx10", "br-blue"} {
+		f.expectNoLink(name)
+	}
+}
+
+func TestDeleteKeepsForeignDevices(t *testing.T) {
+	f := newFixture(t)
+	if err := f.handle.LinkAdd(&netlink.Veth{LinkAttrs: netlink.LinkAttrs{Name: "br-vx10"}, PeerName: "peer"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.agent.Delete(Network{L2VNIs: []L2VNI{{VNI: 10}}}); err == nil {
+		t.Error("expected an error")
+	}
+	f.link("br-vx10")
+}
@@ -0,0 +1,378 @@
+package netagent
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultOVSDB is the socket of the database server of Open vSwitch
+	DefaultOVSDB = "unix:/var/run/openvswitch/db.sock"
+	// ovsDatabase is the database of Open vSwitch in the server
+	ovsDatabase = "Open_vSwitch"
+	// ovsdbTimeout bounds a transaction with the database server
+	ovsdbTimeout = 30 * time.Second
+	// ovsdbAttempts is how many times a change is decided again when the
+	// rows it was decided on changed before it was committed
+	ovsdbAttempts = 3
+)
+
+// errConflict tells that a wait operation of a transaction failed, as the
+// rows it guards changed since they were read
+var errConflict = errors.New("the database changed during the transaction")
+
+// OVSDB is a Switch editing the database of Open vSwitch through the OVSDB
+// management protocol of RFC 7047, the way ovs-vsctl does
+type OVSDB struct {
+	// Dial connects to the database server, every transaction is run on a
+	// connection of its own
+	Dial func() (net.Conn, error)
+}
+
+// NewOVSDB returns the Switch of the database server at endpoint, either
+// unix:<path> or tcp:<host>:<port>
+func NewOVSDB(endpoint string) (*OVSDB, error) {
+	network, address, ok := strings.Cut(endpoint, ":")
+	if !ok || (network != "unix" && network != "tcp") {
+		return nil, fmt.Errorf("invalid OVSDB endpoint %q", endpoint)
+	}
+	return &OVSDB{
+		Dial: func() (net.Conn, error) {
+			return net.DialTimeout(network, address, ovsdbTimeout)
+		},
+	}, nil
+}
+
+// EnsurePort adds the internal port to bridge, or binds it to ifaceID if it
+// is there already
+func (o *OVSDB) EnsurePort(bridge, port, ifaceID string) (bool, error) {
+	var err error
+	for attempt := 0; attempt < ovsdbAttempts; attempt++ {
+		var changed bool
+		if changed, err = o.ensurePort(bridge, port, ifaceID); err != errConflict {
+			return changed, err
+		}
+	}
+	return false, fmt.Errorf("port %s: %v", port, err)
+}
+
+// ensurePort reads the rows of the port, then commits the change they call
+// for in a single transaction guarded by wait operations, which fails with
+// errConflict if another client changed them in between
+func (o *OVSDB) ensurePort(bridge, port, ifaceID string) (bool, error) {
+	results, err := o.transact(
+		selectOp("Bridge", bridge, "_uuid", "ports"),
+		selectOp("Port", port, "_uuid"),
+		selectOp("Interface", port, "_uuid", "type", "external_ids"),
+	)
+	if err != nil {
+		return false, err
+	}
+	if len(results[0].Rows) == 0 {
+		return false, fmt.Errorf("bridge %s not found", bridge)
+	}
+
+	if len(results[1].Rows) == 0 {
+		results, err := o.transact(
+			// nobody added the port in the meantime
+			waitOp("Port", nameIs(port), []string{"name"}),
+			waitOp("Interface", nameIs(port), []string{"name"}),
+			operation{
+				"op":        "insert",
+				"table":     "Interface",
+				"row":       ovsRow{"name": port, "type": "internal", "external_ids": ovsMap{"iface-id": ifaceID}},
+				"uuid-name": "iface",
+			},
+			operation{
+				"op":        "insert",
+				"table":     "Port",
+				"row":       ovsRow{"name": port, "interfaces": []string{"named-uuid", "iface"}},
+				"uuid-name": "port",
+			},
+			operation{
+				"op":        "mutate",
+				"table":     "Bridge",
+				"where":     nameIs(bridge),
+				"mutations": []interface{}{[]interface{}{"ports", "insert", []interface{}{"set", []interface{}{[]string{"named-uuid", "port"}}}}},
+			},
+		)
+		if err != nil {
+			return false, err
+		}
+		// the rows inserted are dropped along with the transaction
+		// if the bridge is gone
+		if results[4].Count == 0 {
+			return false, fmt.Errorf("bridge %s not found", bridge)
+		}
+		return true, nil
+	}
+
+	portUUID := uuidColumn(results[1].Rows[0]["_uuid"])
+	if !containsString(uuidSetColumn(results[0].Rows[0]["ports"]), portUUID) {
+		return false, fmt.Errorf("port %s exists outside of bridge %s", port, bridge)
+	}
+	if len(results[2].Rows) == 0 {
+		return false, fmt.Errorf("port %s has no interface %s", port, port)
+	}
+	iface := results[2].Rows[0]
+	externalIDs := mapColumn(iface["external_ids"])
+	if iface["type"] == "internal" && externalIDs["iface-id"] == ifaceID {
+		return false, nil
+	}
+	externalIDs["iface-id"] = ifaceID
+	where := uuidIs(uuidColumn(iface["_uuid"]))
+	_, err = o.transact(
+		// the interface is as it was read, other external ids included
+		waitOp("Interface", where, []string{"type", "external_ids"},
+			ovsRow{"type": iface["type"], "external_ids": iface["external_ids"]}),
+		operation{
+			"op":    "update",
+			"table": "Interface",
+			"where": where,
+			"row":   ovsRow{"type": "internal", "external_ids": ovsMap(externalIDs)},
+		},
+	)
+	return err == nil, err
+}
+
+// DeletePort removes the port from bridge. The port and its interface are
+// dropped from the database along with the last reference to them.
+func (o *OVSDB) DeletePort(bridge, port string) (bool, error) {
+	var err error
+	for attempt := 0; attempt < ovsdbAttempts; attempt++ {
+		var deleted bool
+		if deleted, err = o.deletePort(bridge, port); err != errConflict {
+			return deleted, err
+		}
+	}
+	return false, fmt.Errorf("port %s: %v", port, err)
+}
+
+func (o *OVSDB) deletePort(bridge, port string) (bool, error) {
+	results, err := o.transact(selectOp("Port", port, "_uuid"))
+	if err != nil {
+		return false, err
+	}
+	if len(results[0].Rows) == 0 {
+		return false, nil
+	}
+	portUUID := uuidColumn(results[0].Rows[0]["_uuid"])
+	results, err = o.transact(
+		// the port is still the one read
+		waitOp("Port", uuidIs(portUUID), []string{"name"}, ovsRow{"name": port}),
+		operation{
+			"op":        "mutate",
+			"table":     "Bridge",
+			"where":     nameIs(bridge),
+			"mutations": []interface{}{[]interface{}{"ports", "delete", []interface{}{"set", []interface{}{[]string{"uuid", portUUID}}}}},
+		},
+	)
+	if err != nil {
+		return false, err
+	}
+	if results[1].Count == 0 {
+		return false, fmt.Errorf("port %s is not on bridge %s", port, bridge)
+	}
+	return true, nil
+}
+
+// operation is an operation of a transact request
+type operation map[string]interface{}
+
+// ovsRow is a row as sent to the server
+type ovsRow map[string]interface{}
+
+// ovsMap is a map column as sent to the server
+type ovsMap map[string]string
+
+func (m ovsMap) MarshalJSON() ([]byte, error) {
+	pairs := make([][]string, 0, len(m))
+	for k, v := range m {
+		pairs = append(pairs, []string{k, v})
+	}
+	return json.Marshal([]interface{}{"map", pairs})
+}
+
+func nameIs(name string) []interface{} {
+	return []interface{}{[]interface{}{"name", "==", name}}
+}
+
+func uuidIs(uuid string) []interface{} {
+	return []interface{}{[]interface{}{"_uuid", "==", []string{"uuid", uuid}}}
+}
+
+// waitOp returns an operation failing the transaction unless the columns of
+// the rows matching where are exactly rows, none if it is empty
+func waitOp(table string, where []interface{}, columns []string, rows ...ovsRow) operation {
+	if rows == nil {
+		rows = []ovsRow{}
+	}
+	return operation{
+		"op":      "wait",
+		"timeout": 0,
+		"table":   table,
+		"where":   where,
+		"columns": columns,
+		"until":   "==",
+		"rows":    rows,
+	}
+}
+
+func selectOp(table, name string, columns ...string) operation {
+	return operation{
+		"op":      "select",
+		"table":   table,
+		"where":   nameIs(name),
+		"columns": columns,
+	}
+}
+
+// result is the result of an operation
+type result struct {
+	Rows    []map[string]interface{} `json:"rows,omitempty"`
+	Count   int                      `json:"count,omitempty"`
+	Error   string                   `json:"error,omitempty"`
+	Details string                   `json:"details,omitempty"`
+}
+
+type request struct {
+	Method string        `json:"method"`
+	Params []interface{} `json:"params"`
+	ID     interface{}   `json:"id"`
+}
+
+type response struct {
+	Method string          `json:"method,omitempty"`
+	Params []interface{}   `json:"params,omitempty"`
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  interface{}     `json:"error"`
+	ID     interface{}     `json:"id"`
+}
+
+// transact runs the operations as one transaction and returns their
+// results, failing if any of them failed
+func (o *OVSDB) transact(ops ...operation) ([]result, error) {
+	conn, err := o.Dial()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(ovsdbTimeout))
+
+	params := []interface{}{ovsDatabase}
+	for _, op := range ops {
+		params = append(params, op)
+	}
+	encoder := json.NewEncoder(conn)
+	if err := encoder.Encode(request{Method: "transact", Params: params, ID: 0}); err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(conn)
+	for {
+		var resp response
+		if err := decoder.Decode(&resp); err != nil {
+			return nil, err
+		}
+		// the server checks that the connection is alive
+		if resp.Method == "echo" {
+			if err := encoder.Encode(response{Result: mustMarshal(resp.Params), ID: resp.ID}); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if resp.Method != "" {
+			continue
+		}
+		if resp.Error != nil {
+			return nil, fmt.Errorf("transaction failed: %v", resp.Error)
+		}
+		var results []result
+		if err := json.Unmarshal(resp.Result, &results); err != nil {
+			return nil, err
+		}
+		// a failure to commit is reported after the results of the
+		// operations
+		for _, r := range results {
+			// a wait operation which is not satisfied right away
+			if r.Error == "timed out" {
+				return nil, errConflict
+			}
+			if r.Error != "" {
+				return nil, fmt.Errorf("transaction failed: %s: %s", r.Error, r.Details)
+			}
+		}
+		if len(results) < len(ops) {
+			return nil, fmt.Errorf("transaction returned %d results for %d operations", len(results), len(ops))
+		}
+		return results, nil
+	}
+}
+
+func mustMarshal(v interface{}) json.RawMessage {
+	data, _ := json.Marshal(v)
+	return data
+}
+
+// uuidColumn returns the uuid of a column of type uuid, ["uuid", <uuid>]
+func uuidColumn(v interface{}) string {
+	pair, ok := v.([]interface{})
+	if !ok || len(pair) != 2 || pair[0] != "uuid" {
+		return ""
+	}
+	uuid, _ := pair[1].(string)
+	return uuid
+}
+
+// uuidSetColumn returns the uuids of a column which is a set of uuids, a
+// single uuid or ["set", [<uuid>...]]
+func uuidSetColumn(v interface{}) []string {
+	if uuid := uuidColumn(v); uuid != "" {
+		return []string{uuid}
+	}
+	set, ok := v.([]interface{})
+	if !ok || len(set) != 2 || set[0] != "set" {
+		return nil
+	}
+	elements, _ := set[1].([]interface{})
+	var uuids []string
+	for _, e := range elements {
+		if uuid := uuidColumn(e); uuid != "" {
+			uuids = append(uuids, uuid)
+		}
+	}
+	return uuids
+}
+
+// mapColumn returns a map column of strings, ["map", [[<key>, <value>]...]]
+func mapColumn(v interface{}) map[string]string {
+	m := make(map[string]string)
+	column, ok := v.([]interface{})
+	if !ok || len(column) != 2 || column[0] != "map" {
+		return m
+	}
+	pairs, _ := column[1].([]interface{})
+	for _, p := range pairs {
+		pair, ok := p.([]interface{})
+		if !ok || len(pair) != 2 {
+			continue
+		}
+		key, _ := pair[0].(string)
+		value, _ := pair[1].(string)
+		m[key] = value
+	}
+	return m
+}
+
+func containsString(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
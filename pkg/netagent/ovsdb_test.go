@@ -0,0 +1,190 @@
+package netagent
+
+import (
+	"encoding/json"
+	"net"
+	"strings"
+	"testing"
+)
+
+// fakeOVSDB answers every transaction with the next of its results, after
+// checking the liveness of the client with an echo
+type fakeOVSDB struct {
+	t        *testing.T
+	results  []string
+	requests []string
+}
+
+func (s *fakeOVSDB) dial() (net.Conn, error) {
+	client, server := net.Pipe()
+	go s.serve(server)
+	return client, nil
+}
+
+func (s *fakeOVSDB) serve(conn net.Conn) {
+	defer conn.Close()
+	decoder := json.NewDecoder(conn)
+	var req request
+	if err := decoder.Decode(&req); err != nil {
+		s.t.Errorf("unexpected error: %v", err)
+		return
+	}
+	params, _ := json.Marshal(req.Params)
+	s.requests = append(s.requests, string(params))
+
+	conn.Write([]byte(`{"method":"echo","params":[],"id":"echo"}`))
+	var echo response
+	if err := decoder.Decode(&echo); err != nil || echo.ID != "echo" {
+		s.t.Errorf("expected an echo reply, got %+v, %v", echo, err)
+		return
+	}
+
+	if len(s.results) == 0 {
+		s.t.Errorf("unexpected transaction %s", params)
+		return
+	}
+	result := s.results[0]
+	s.results = s.results[1:]
+	conn.Write([]byte(`{"id":0,"error":null,"result":` + result + `}`))
+}
+
+func newOVSDBFixture(t *testing.T, results ...string) (*OVSDB, *fakeOVSDB) {
+	s := &fakeOVSDB{t: t, results: results}
+	return &OVSDB{Dial: s.dial}, s
+}
+
+const (
+	bridgeRow = `{"rows":[{"_uuid":["uuid","b1"],"ports":["set",[["uuid","p0"],["uuid","p1"]]]}]}`
+	portRow   = `{"rows":[{"_uuid":["uuid","p1"]}]}`
+	noRows    = `{"rows":[]}`
+)
+
+func expectRequest(t *testing.T, request string, substrings ...string) {
+	t.Helper()
+	for _, s := range substrings {
+		if !strings.Contains(request, s) {
+			t.Errorf("expected %s in %s", s, request)
+		}
+	}
+}
+
+func TestOVSDBEnsurePort(t *testing.T) {
+	ovs, server := newOVSDBFixture(t,
+		`[`+bridgeRow+`,`+noRows+`,`+noRows+`]`,
+		`[{},{},{"uuid":["uuid","i1"]},{"uuid":["uuid","p1"]},{"count":1}]`,
+	)
+	changed, err := ovs.EnsurePort("br-int", "intp10", "ls-blue-bm-l2gw")
+	if err != nil || !changed {
+		t.Fatalf("expected the port to be added, got %v, %v", changed, err)
+	}
+	if len(server.requests) != 2 {
+		t.Fatalf("expected 2 transactions, got %d", len(server.requests))
+	}
+	expectRequest(t, server.requests[1],
+		`{"columns":["name"],"op":"wait","rows":[],"table":"Port","timeout":0,"until":"==","where":[["name","==","intp10"]]}`,
+		`{"columns":["name"],"op":"wait","rows":[],"table":"Interface","timeout":0,"until":"==","where":[["name","==","intp10"]]}`,
+		`"op":"insert","row":{"external_ids":["map",[["iface-id","ls-blue-bm-l2gw"]]],"name":"intp10","type":"internal"},"table":"Interface"`,
+		`"op":"insert","row":{"interfaces":["named-uuid","iface"],"name":"intp10"},"table":"Port"`,
+		`"mutations":[["ports","insert",["set",[["named-uuid","port"]]]]],"op":"mutate","table":"Bridge","where":[["name","==","br-int"]]`,
+	)
+}
+
+func TestOVSDBEnsureExistingPort(t *testing.T) {
+	bound := `{"rows":[{"_uuid":["uuid","i1"],"type":"internal","external_ids":["map",[["iface-id","ls-blue-bm-l2gw"]]]}]}`
+	ovs, server := newOVSDBFixture(t, `[`+bridgeRow+`,`+portRow+`,`+bound+`]`)
+	changed, err := ovs.EnsurePort("br-int", "intp10", "ls-blue-bm-l2gw")
+	if err != nil || changed {
+		t.Fatalf("expected nothing to change, got %v, %v", changed, err)
+	}
+
+	// the port is bound to another logical switch
+	ovs, server = newOVSDBFixture(t, `[`+bridgeRow+`,`+portRow+`,`+bound+`]`, `[{},{"count":1}]`)
+	changed, err = ovs.EnsurePort("br-int", "intp10", "ls-red-bm-l2gw")
+	if err != nil || !changed {
+		t.Fatalf("expected the port to be updated, got %v, %v", changed, err)
+	}
+	expectRequest(t, server.requests[1],
+		`{"columns":["type","external_ids"],"op":"wait","rows":[{"external_ids":["map",[["iface-id","ls-blue-bm-l2gw"]]],"type":"internal"}],"table":"Interface","timeout":0,"until":"==","where":[["_uuid","==",["uuid","i1"]]]}`,
+		`"op":"update","row":{"external_ids":["map",[["iface-id","ls-red-bm-l2gw"]]],"type":"internal"},"table":"Interface","where":[["_uuid","==",["uuid","i1"]]]`,
+	)
+}
+
+func TestOVSDBEnsurePortErrors(t *testing.T) {
+	ovs, _ := newOVSDBFixture(t, `[`+noRows+`,`+noRows+`,`+noRows+`]`)
+	if _, err := ovs.EnsurePort("br-int", "intp10", "ls-blue-bm-l2gw"); err == nil {
+		t.Error("expected an error for a missing bridge")
+	}
+
+	otherBridge := `{"rows":[{"_uuid":["uuid","b2"],"ports":["uuid","p0"]}]}`
+	ovs, _ = newOVSDBFixture(t, `[`+otherBridge+`,`+portRow+`,`+noRows+`]`)
+	if _, err := ovs.EnsurePort("br-int", "intp10", "ls-blue-bm-l2gw"); err == nil {
+		t.Error("expected an error for a port on another bridge")
+	}
+
+	ovs, _ = newOVSDBFixture(t,
+		`[`+bridgeRow+`,`+noRows+`,`+noRows+`]`,
+		`[{},{},{"uuid":["uuid","i1"]},{"error":"constraint violation","details":"duplicate name"},null,null]`,
+	)
+	if _, err := ovs.EnsurePort("br-int", "intp10", "ls-blue-bm-l2gw"); err == nil || !strings.Contains(err.Error(), "constraint violation") {
+		t.Errorf("expected a constraint violation, got %v", err)
+	}
+}
+
+func TestOVSDBEnsurePortConflict(t *testing.T) {
+	bound := `{"rows":[{"_uuid":["uuid","i1"],"type":"internal","external_ids":["map",[["iface-id","ls-blue-bm-l2gw"]]]}]}`
+	// another client adds the port between the select and the insert, the
+	// insert is aborted and the port found on the next attempt
+	ovs, server := newOVSDBFixture(t,
+		`[`+bridgeRow+`,`+noRows+`,`+noRows+`]`,
+		`[{"error":"timed out"},null,null,null,null]`,
+		`[`+bridgeRow+`,`+portRow+`,`+bound+`]`,
+	)
+	changed, err := ovs.EnsurePort("br-int", "intp10", "ls-blue-bm-l2gw")
+	if err != nil || changed {
+		t.Fatalf("expected the port added by the other client to be kept, got %v, %v", changed, err)
+	}
+	if len(server.requests) != 3 {
+		t.Fatalf("expected 3 transactions, got %d", len(server.requests))
+	}
+
+	// the database keeps changing
+	ovs, _ = newOVSDBFixture(t,
+		`[`+bridgeRow+`,`+noRows+`,`+noRows+`]`, `[{"error":"timed out"},null,null,null,null]`,
+		`[`+bridgeRow+`,`+noRows+`,`+noRows+`]`, `[{"error":"timed out"},null,null,null,null]`,
+		`[`+bridgeRow+`,`+noRows+`,`+noRows+`]`, `[{"error":"timed out"},null,null,null,null]`,
+	)
+	if _, err := ovs.EnsurePort("br-int", "intp10", "ls-blue-bm-l2gw"); err == nil {
+		t.Error("expected an error once the attempts are exhausted")
+	}
+}
+
+func TestOVSDBDeletePort(t *testing.T) {
+	ovs, server := newOVSDBFixture(t, `[`+portRow+`]`, `[{},{"count":1}]`)
+	deleted, err := ovs.DeletePort("br-int", "intp10")
+	if err != nil || !deleted {
+		t.Fatalf("expected the port to be deleted, got %v, %v", deleted, err)
+	}
+	expectRequest(t, server.requests[1],
+		`{"columns":["name"],"op":"wait","rows":[{"name":"intp10"}],"table":"Port","timeout":0,"until":"==","where":[["_uuid","==",["uuid","p1"]]]}`,
+		`"mutations":[["ports","delete",["set",[["uuid","p1"]]]]],"op":"mutate","table":"Bridge","where":[["name","==","br-int"]]`,
+	)
+
+	ovs, _ = newOVSDBFixture(t, `[`+noRows+`]`)
+	deleted, err = ovs.DeletePort("br-int", "intp10")
+	if err != nil || deleted {
+		t.Errorf("expected nothing to delete, got %v, %v", deleted, err)
+	}
+}
+
+func TestNewOVSDB(t *testing.T) {
+	for _, endpoint := range []string{DefaultOVSDB, "tcp:127.0.0.1:6640"} {
+		if _, err := NewOVSDB(endpoint); err != nil {
+			t.Errorf("%s: unexpected error: %v", endpoint, err)
+		}
+	}
+	for _, endpoint := range []string{"/var/run/openvswitch/db.sock", "ssl:127.0.0.1:6640"} {
+		if _, err := NewOVSDB(endpoint); err == nil {
+			t.Errorf("%s: expected an error", endpoint)
+		}
+	}
+}
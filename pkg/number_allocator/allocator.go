@@ -8,7 +8,7 @@ import (
 
 var (
 	ErrFull      = errors.New("range is full")
-	ErrAllocated = errors.New("provided IP is already allocated")
+	ErrAllocated = errors.New("provided number is already allocated")
 )
 
 type Range struct {
@@ -25,7 +25,8 @@ func maximum(a, b int) int {
 }
 
 func NewAllocatorRange(base, max int, allocatorFactory allocator.AllocatorFactory) (*Range, error) {
-	alloc_max := maximum(0, max-base)
+	// both ends of the range are usable
+	alloc_max := maximum(0, max-base+1)
 	r := Range{
 		base: base,
 		max:  max,
@@ -52,7 +53,7 @@ func (r *Range) contains(vni int) (bool, int) {
 func (r *Range) Allocate(vni int) error {
 	ok, offset := r.contains(vni)
 	if !ok {
-		return fmt.Errorf("vni %d is not in range %d-%d", vni, r.base, r.max)
+		return fmt.Errorf("%d is not in range %d-%d", vni, r.base, r.max)
 	}
 
 	allocated, err := r.alloc.Allocate(offset)
@@ -75,6 +76,16 @@ func (r *Range) Used() int {
 	return r.max - r.base + 1 - r.alloc.Free()
 }
 
+// Base returns the first number of the range
+func (r *Range) Base() int {
+	return r.base
+}
+
+// Max returns the last number of the range
+func (r *Range) Max() int {
+	return r.max
+}
+
 // AllocateNext returns the next available vni in the range
 func (r *Range) AllocateNext() (int, error) {
 	offset, ok, err := r.alloc.AllocateNext()
@@ -112,6 +123,27 @@ func (r *Range) Has(vni int) bool {
 	return r.alloc.Has(offset)
 }
 
+// Snapshot saves the current state of the range. It fails if the underlying
+// allocator cannot be snapshotted.
+func (r *Range) Snapshot() (string, []byte, error) {
+	snapshottable, ok := r.alloc.(allocator.Snapshottable)
+	if !ok {
+		return "", nil, fmt.Errorf("%s does not support snapshots", r.Desc())
+	}
+	rangeSpec, data := snapshottable.Snapshot()
+	return rangeSpec, data, nil
+}
+
+// Restore restores the range to a state previously captured by Snapshot
+func (r *Range) Restore(rangeSpec string, data []byte) error {
+	snapshottable, ok := r.alloc.(allocator.Snapshottable)
+	if !ok {
+		return fmt.Errorf("%s does not support snapshots", r.Desc())
+	}
+	return snapshottable.Restore(rangeSpec, data)
+}
+
+// Desc describes the range, whatever numbers it holds
 func (r *Range) Desc() string {
-	return fmt.Sprintf("VNI range [%d-%d]", r.base, r.max)
+	return fmt.Sprintf("range [%d-%d]", r.base, r.max)
 }
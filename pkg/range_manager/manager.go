@@ -1,8 +1,12 @@
 package rangemanager
 
 import (
+	"fmt"
+	"strings"
 	"sync"
 
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+
 	"github.com/guohao117/frr-controller/pkg/number_allocator"
 )
 
@@ -60,3 +64,180 @@ func (m *RangeManager) Reserve(name string, vni int) error {
 	m.cache[name] = vni
 	return nil
 }
+
+// Reassign moves name to the provided number, releasing the one it held
+// before. If the number cannot be reserved name keeps its current number.
+func (m *RangeManager) Reassign(name string, vni int) error {
+	m.Lock()
+	defer m.Unlock()
+	current, ok := m.cache[name]
+	if ok && current == vni {
+		return nil
+	}
+	if err := m.alloc.Allocate(vni); err != nil {
+		return err
+	}
+	if ok {
+		m.alloc.Release(current)
+	}
+	m.cache[name] = vni
+	return nil
+}
+
+// Rename hands the number held by from over to to, which must hold none,
+// without releasing it in between
+func (m *RangeManager) Rename(from, to string) error {
+	m.Lock()
+	defer m.Unlock()
+	vni, ok := m.cache[from]
+	if !ok {
+		return fmt.Errorf("%s holds no number", from)
+	}
+	if _, ok := m.cache[to]; ok {
+		return fmt.Errorf("%s already holds a number", to)
+	}
+	delete(m.cache, from)
+	m.cache[to] = vni
+	return nil
+}
+
+// Get returns the number currently held by name, if any
+func (m *RangeManager) Get(name string) (int, bool) {
+	m.Lock()
+	defer m.Unlock()
+	vni, ok := m.cache[name]
+	return vni, ok
+}
+
+// Held returns the numbers held by owner, keyed by name: owner itself and
+// every name below it, owner/<suffix>. An owner holding several numbers
+// allocates each of them under its own name below owner.
+func (m *RangeManager) Held(owner string) map[string]int {
+	m.Lock()
+	defer m.Unlock()
+	held := make(map[string]int)
+	for name, vni := range m.cache {
+		if name == owner || strings.HasPrefix(name, owner+"/") {
+			held[name] = vni
+		}
+	}
+	return held
+}
+
+// Owner returns the name holding the provided number, if any
+func (m *RangeManager) Owner(vni int) (string, bool) {
+	m.Lock()
+	defer m.Unlock()
+	for name, v := range m.cache {
+		if v == vni {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// Snapshot is the persisted state of a RangeManager: the allocator bitmap
+// and the name each number was handed out to.
+type Snapshot struct {
+	Range string         `json:"range"`
+	Data  []byte         `json:"data"`
+	Names map[string]int `json:"names"`
+}
+
+// Snapshot captures the current state of the manager
+func (m *RangeManager) Snapshot() (*Snapshot, error) {
+	m.Lock()
+	defer m.Unlock()
+	rangeSpec, data, err := m.alloc.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[string]int, len(m.cache))
+	for name, vni := range m.cache {
+		names[name] = vni
+	}
+	return &Snapshot{Range: rangeSpec, Data: data, Names: names}, nil
+}
+
+// Restore loads a previously captured snapshot into the manager, once on
+// startup. Names already held by the manager are kept. If the snapshot was taken for a
+// different range the bitmap is discarded and each name is reserved on its
+// own; names which no longer fit are reported in the returned error.
+func (m *RangeManager) Restore(s *Snapshot) error {
+	m.Lock()
+	defer m.Unlock()
+	if len(m.cache) == 0 {
+		if err := m.alloc.Restore(s.Range, s.Data); err == nil {
+			for name, vni := range s.Names {
+				m.cache[name] = vni
+				// keep the bitmap consistent with the names
+				m.alloc.Allocate(vni)
+			}
+			return nil
+		}
+	}
+
+	var errs []error
+	for name, vni := range s.Names {
+		if _, ok := m.cache[name]; ok {
+			continue
+		}
+		if err := m.alloc.Allocate(vni); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %d: %v", name, vni, err))
+			continue
+		}
+		m.cache[name] = vni
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// Min returns the first number of the managed range
+func (m *RangeManager) Min() int {
+	m.Lock()
+	defer m.Unlock()
+	return m.alloc.Base()
+}
+
+// Max returns the last number of the managed range
+func (m *RangeManager) Max() int {
+	m.Lock()
+	defer m.Unlock()
+	return m.alloc.Max()
+}
+
+// Used returns the count of numbers handed out
+func (m *RangeManager) Used() int {
+	m.Lock()
+	defer m.Unlock()
+	return m.alloc.Used()
+}
+
+// Free returns the count of numbers left
+func (m *RangeManager) Free() int {
+	m.Lock()
+	defer m.Unlock()
+	return m.alloc.Free()
+}
+
+// Resize moves the manager to the range [min, max], keeping every name and
+// number it holds. It fails, leaving the manager untouched, if any number
+// handed out does not fit the new range.
+func (m *RangeManager) Resize(min, max int) error {
+	resized, err := numberallocator.NewRange(min, max)
+	if err != nil {
+		return err
+	}
+	m.Lock()
+	defer m.Unlock()
+	var errs []error
+	for name, vni := range m.cache {
+		if err := resized.Allocate(vni); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", name, err))
+		}
+	}
+	if len(errs) > 0 {
+		return utilerrors.NewAggregate(errs)
+	}
+	m.alloc = resized
+	return nil
+}
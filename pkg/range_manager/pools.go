@@ -0,0 +1,50 @@
+package rangemanager
+
+import (
+	"sync"
+)
+
+// Pools is a set of RangeManagers keyed by pool name
+type Pools struct {
+	sync.RWMutex
+	managers map[string]*RangeManager
+}
+
+func NewPools() *Pools {
+	return &Pools{
+		managers: make(map[string]*RangeManager),
+	}
+}
+
+// Get returns the manager of the named pool
+func (p *Pools) Get(name string) (*RangeManager, bool) {
+	p.RLock()
+	defer p.RUnlock()
+	m, ok := p.managers[name]
+	return m, ok
+}
+
+// Set adds or replaces the manager of the named pool
+func (p *Pools) Set(name string, m *RangeManager) {
+	p.Lock()
+	defer p.Unlock()
+	p.managers[name] = m
+}
+
+// Delete removes the named pool
+func (p *Pools) Delete(name string) {
+	p.Lock()
+	defer p.Unlock()
+	delete(p.managers, name)
+}
+
+// List returns a copy of the set of pools
+func (p *Pools) List() map[string]*RangeManager {
+	p.RLock()
+	defer p.RUnlock()
+	managers := make(map[string]*RangeManager, len(p.managers))
+	for name, m := range p.managers {
+		managers[name] = m
+	}
+	return managers
+}
@@ -0,0 +1,131 @@
+package rangemanager
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Storage persists the snapshots of a set of RangeManagers, keyed by pool
+type Storage interface {
+	// Load returns the last saved snapshots
+	Load() (map[string]*Snapshot, error)
+	// Save replaces the saved snapshots. It returns a Conflict error if the
+	// stored state was changed by someone else since the last Load, Save or
+	// Refresh.
+	Save(map[string]*Snapshot) error
+	// Refresh catches up with the stored state without reading it, so that
+	// the next Save overwrites it
+	Refresh() error
+}
+
+// ConfigMapStorage keeps the snapshots in a ConfigMap, one data key per
+// pool. Writes are guarded by the resourceVersion of the ConfigMap.
+type ConfigMapStorage struct {
+	lock      sync.Mutex
+	client    kubernetes.Interface
+	namespace string
+	name      string
+	// exists tells whether the ConfigMap was found by the last read or write
+	exists bool
+	// resourceVersion of the ConfigMap last read or written
+	resourceVersion string
+}
+
+var _ Storage = &ConfigMapStorage{}
+
+func NewConfigMapStorage(client kubernetes.Interface, namespace, name string) *ConfigMapStorage {
+	return &ConfigMapStorage{
+		client:    client,
+		namespace: namespace,
+		name:      name,
+	}
+}
+
+func (s *ConfigMapStorage) Load() (map[string]*Snapshot, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	snapshots := make(map[string]*Snapshot)
+	cm, err := s.client.CoreV1().ConfigMaps(s.namespace).Get(context.TODO(), s.name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		s.exists = false
+		s.resourceVersion = ""
+		return snapshots, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for pool, data := range cm.Data {
+		snapshot := &Snapshot{}
+		if err := json.Unmarshal([]byte(data), snapshot); err != nil {
+			return nil, fmt.Errorf("failed to decode %s in configmap %s/%s: %v", pool, s.namespace, s.name, err)
+		}
+		snapshots[pool] = snapshot
+	}
+	s.exists = true
+	s.resourceVersion = cm.ResourceVersion
+	return snapshots, nil
+}
+
+func (s *ConfigMapStorage) Refresh() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	cm, err := s.client.CoreV1().ConfigMaps(s.namespace).Get(context.TODO(), s.name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		s.exists = false
+		s.resourceVersion = ""
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	s.exists = true
+	s.resourceVersion = cm.ResourceVersion
+	return nil
+}
+
+func (s *ConfigMapStorage) Save(snapshots map[string]*Snapshot) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            s.name,
+			Namespace:       s.namespace,
+			ResourceVersion: s.resourceVersion,
+		},
+		Data: make(map[string]string, len(snapshots)),
+	}
+	for pool, snapshot := range snapshots {
+		data, err := json.Marshal(snapshot)
+		if err != nil {
+			return err
+		}
+		cm.Data[pool] = string(data)
+	}
+
+	var err error
+	if !s.exists {
+		cm, err = s.client.CoreV1().ConfigMaps(s.namespace).Create(context.TODO(), cm, metav1.CreateOptions{})
+		if errors.IsAlreadyExists(err) {
+			// someone else created it since we last looked
+			return errors.NewConflict(corev1.Resource("configmaps"), s.name, err)
+		}
+	} else {
+		cm, err = s.client.CoreV1().ConfigMaps(s.namespace).Update(context.TODO(), cm, metav1.UpdateOptions{})
+	}
+	if err != nil {
+		return err
+	}
+	s.exists = true
+	s.resourceVersion = cm.ResourceVersion
+	return nil
+}
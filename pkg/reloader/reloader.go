@@ -0,0 +1,110 @@
+// Package reloader applies the frr.conf published by the controller to the
+// FRR daemons of a running pod, so that configuration changes do not restart
+// the pod.
+package reloader
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+
+	"github.com/guohao117/frr-controller/pkg/frrconf"
+	"github.com/guohao117/frr-controller/pkg/utils"
+)
+
+// Reloader watches frr.conf as mounted from the Secret of a Frr and
+// applies it to the running daemons when it changes
+type Reloader struct {
+	// ConfigPath is frr.conf as published by the controller
+	ConfigPath string
+	// OutputPath is where frr.conf of the pod is written before it is
+	// applied
+	OutputPath string
+	// VTEPLocal is the address of the pod, it replaces
+	// frrconf.VTEPLocalPlaceholder
+	VTEPLocal string
+	// Vtysh and FrrReload are the paths of vtysh and frr-reload.py
+	Vtysh     string
+	FrrReload string
+	// Report is called with the outcome of every reload
+	Report func(status utils.FrrConfigStatus) error
+
+	last     utils.FrrConfigStatus
+	reported bool
+}
+
+// Run syncs the configuration every interval until stopCh is closed
+func (r *Reloader) Run(interval time.Duration, stopCh <-chan struct{}) {
+	wait.Until(func() {
+		if err := r.Sync(); err != nil {
+			klog.Errorf("Error reloading %s: %v", r.ConfigPath, err)
+		}
+	}, interval, stopCh)
+}
+
+// Sync applies the configuration unless it was applied successfully already,
+// and reports the outcome. A configuration which failed to apply is tried
+// again on every call, as the daemons may not have been started yet.
+func (r *Reloader) Sync() error {
+	config, err := os.ReadFile(r.ConfigPath)
+	if err != nil {
+		return err
+	}
+	hash := frrconf.Hash(config)
+	if hash != r.last.Hash || r.last.Error != "" {
+		status := utils.FrrConfigStatus{Hash: hash, VTEPAddress: r.VTEPLocal}
+		if err := r.apply(config); err != nil {
+			status.Error = err.Error()
+		} else {
+			klog.Infof("Applied frr.conf %s", hash)
+		}
+		if status != r.last {
+			r.last = status
+			r.reported = false
+		}
+	}
+
+	if !r.reported {
+		if err := r.Report(r.last); err != nil {
+			return err
+		}
+		r.reported = true
+	}
+	if r.last.Error != "" {
+		return fmt.Errorf("%s", r.last.Error)
+	}
+	return nil
+}
+
+// apply writes the configuration of the pod and applies it. vtysh checks the
+// whole configuration first, so that nothing is applied from an invalid one,
+// then frr-reload.py diffs it against the running configuration and applies
+// the difference only.
+func (r *Reloader) apply(config []byte) error {
+	config = bytes.ReplaceAll(config, []byte(frrconf.VTEPLocalPlaceholder), []byte(r.VTEPLocal))
+	if err := os.WriteFile(r.OutputPath, config, 0644); err != nil {
+		return err
+	}
+	if err := run(r.Vtysh, "--dryrun", "--inputfile", r.OutputPath); err != nil {
+		return fmt.Errorf("invalid configuration: %v", err)
+	}
+	if err := run(r.FrrReload, "--reload", "--stdout", "--bindir", filepath.Dir(r.Vtysh), r.OutputPath); err != nil {
+		return fmt.Errorf("reload failed: %v", err)
+	}
+	return nil
+}
+
+func run(name string, args ...string) error {
+	out, err := exec.Command(name, args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s: %v: %s", filepath.Base(name), err, bytes.TrimSpace(out))
+	}
+	klog.V(4).Infof("%s: %s", filepath.Base(name), out)
+	return nil
+}
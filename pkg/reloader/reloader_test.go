@@ -0,0 +1,134 @@
+package reloader
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/guohao117/frr-controller/pkg/frrconf"
+	"github.com/guohao117/frr-controller/pkg/utils"
+)
+
+type fixture struct {
+	t        *testing.T
+	reloader *Reloader
+	log      string
+	reports  []utils.FrrConfigStatus
+}
+
+// newFixture returns a Reloader running the fake vtysh and frr-reload.py of
+// testdata/bin
+func newFixture(t *testing.T) *fixture {
+	bin, err := filepath.Abs(filepath.Join("testdata", "bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	f := &fixture{t: t, log: filepath.Join(dir, "vtysh.log")}
+	t.Setenv("FAKE_VTYSH_LOG", f.log)
+	f.reloader = &Reloader{
+		ConfigPath: filepath.Join(dir, "frr-conf"),
+		OutputPath: filepath.Join(dir, "frr.conf"),
+		VTEPLocal:  "10.0.0.1",
+		Vtysh:      filepath.Join(bin, "vtysh"),
+		FrrReload:  filepath.Join(bin, "frr-reload.py"),
+		Report: func(status utils.FrrConfigStatus) error {
+			f.reports = append(f.reports, status)
+			return nil
+		},
+	}
+	return f
+}
+
+func (f *fixture) publish(config string) string {
+	if err := os.WriteFile(f.reloader.ConfigPath, []byte(config), 0644); err != nil {
+		f.t.Fatal(err)
+	}
+	return frrconf.Hash([]byte(config))
+}
+
+func (f *fixture) applied() string {
+	log, err := os.ReadFile(f.log)
+	if err != nil && !os.IsNotExist(err) {
+		f.t.Fatal(err)
+	}
+	return string(log)
+}
+
+func (f *fixture) expectReports(expected ...utils.FrrConfigStatus) {
+	f.t.Helper()
+	if len(f.reports) != len(expected) {
+		f.t.Fatalf("expected reports %+v, got %+v", expected, f.reports)
+	}
+	for i := range expected {
+		if f.reports[i] != expected[i] {
+			f.t.Errorf("expected report %d to be %+v, got %+v", i, expected[i], f.reports[i])
+		}
+	}
+}
+
+func TestSyncAppliesChanges(t *testing.T) {
+	f := newFixture(t)
+	first := f.publish("router bgp 65001\n bgp router-id " + frrconf.VTEPLocalPlaceholder + "\n")
+	if err := f.reloader.Sync(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if applied := f.applied(); applied != "router bgp 65001\n bgp router-id 10.0.0.1\n" {
+		t.Errorf("expected the address of the pod to be filled in, applied %q", applied)
+	}
+
+	// An unchanged configuration is neither applied nor reported again
+	if err := f.reloader.Sync(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	second := f.publish("router bgp 65002\n")
+	if err := f.reloader.Sync(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if applied := f.applied(); !strings.HasSuffix(applied, "bgp router-id 10.0.0.1\nrouter bgp 65002\n") {
+		t.Errorf("expected the changed configuration to be applied once, applied %q", applied)
+	}
+	f.expectReports(utils.FrrConfigStatus{Hash: first, VTEPAddress: "10.0.0.1"}, utils.FrrConfigStatus{Hash: second, VTEPAddress: "10.0.0.1"})
+}
+
+func TestSyncRejectsInvalidConfig(t *testing.T) {
+	f := newFixture(t)
+	hash := f.publish("router bgp 65001\ninvalid\n")
+	if err := f.reloader.Sync(); err == nil {
+		t.Fatalf("expected an error")
+	}
+	if applied := f.applied(); applied != "" {
+		t.Errorf("expected nothing to be applied, applied %q", applied)
+	}
+	// The same failure is reported once
+	if err := f.reloader.Sync(); err == nil {
+		t.Fatalf("expected an error")
+	}
+	if len(f.reports) != 1 || f.reports[0].Hash != hash || !strings.Contains(f.reports[0].Error, "Unknown command: invalid") {
+		t.Errorf("expected the vtysh error to be reported once, got %+v", f.reports)
+	}
+}
+
+func TestSyncRetriesFailedReload(t *testing.T) {
+	f := newFixture(t)
+	t.Setenv("FAKE_VTYSH_DOWN", "1")
+	hash := f.publish("router bgp 65001\n")
+	if err := f.reloader.Sync(); err == nil {
+		t.Fatalf("expected an error while the daemons are down")
+	}
+
+	os.Unsetenv("FAKE_VTYSH_DOWN")
+	if err := f.reloader.Sync(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if applied := f.applied(); applied != "router bgp 65001\n" {
+		t.Errorf("expected the configuration to be applied, applied %q", applied)
+	}
+	if len(f.reports) != 2 || !strings.Contains(f.reports[0].Error, "reload failed") {
+		t.Fatalf("expected the failure then the success to be reported, got %+v", f.reports)
+	}
+	if f.reports[1] != (utils.FrrConfigStatus{Hash: hash, VTEPAddress: "10.0.0.1"}) {
+		t.Errorf("expected the success to be reported, got %+v", f.reports[1])
+	}
+}
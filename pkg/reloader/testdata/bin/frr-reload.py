@@ -0,0 +1,11 @@
+#!/bin/sh
+# Fake frr-reload.py for the tests. It applies the whole configuration
+# through the vtysh of --bindir instead of the difference.
+bindir=
+while [ $# -gt 1 ]; do
+	case "$1" in
+	--bindir) shift; bindir="$1" ;;
+	esac
+	shift
+done
+exec "$bindir/vtysh" --inputfile "$1"
@@ -1,9 +1,64 @@
 package utils
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 
-	frrapi "github.com/guohao117/frr-controller/pkg/apis/frrcontroller/v1alpha1"
 	kapi "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
 )
+
+// FrrConfigAnnotation is set by frr-reloader on the pod it runs in to the
+// FrrConfigStatus of the last frr.conf it applied
+const FrrConfigAnnotation = "frrcontroller.nocsys.cn/config-status"
+
+// FrrConfigStatus is the outcome of the last reload of frr.conf in a pod
+type FrrConfigStatus struct {
+	// Hash is the hash of frr.conf as published by the controller, before
+	// the pod fills in its own address
+	Hash string `json:"hash"`
+	// Error is set if the configuration could not be applied
+	Error string `json:"error,omitempty"`
+	// VTEPAddress is the local address of the VTEP the pod filled into
+	// frr.conf, read from the source the Frr asks for
+	VTEPAddress string `json:"vtepAddress,omitempty"`
+}
+
+// GetFrrConfigStatus returns the FrrConfigStatus set on a pod, false if
+// none is set or it cannot be decoded
+func GetFrrConfigStatus(pod *kapi.Pod) (FrrConfigStatus, bool) {
+	var status FrrConfigStatus
+	value, ok := pod.Annotations[FrrConfigAnnotation]
+	if !ok {
+		return status, false
+	}
+	if err := json.Unmarshal([]byte(value), &status); err != nil {
+		return status, false
+	}
+	return status, true
+}
+
+// SetFrrConfigStatus sets the FrrConfigStatus annotation of a pod
+func SetFrrConfigStatus(ctx context.Context, client kubernetes.Interface, namespace, name string, status FrrConfigStatus) error {
+	value, err := json.Marshal(status)
+	if err != nil {
+		return err
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{
+				FrrConfigAnnotation: string(value),
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := client.CoreV1().Pods(namespace).Patch(ctx, name, types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+		return fmt.Errorf("error annotating pod %s/%s: %v", namespace, name, err)
+	}
+	return nil
+}
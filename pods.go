@@ -0,0 +1,136 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/tools/cache"
+
+	frrv1alpha1 "github.com/guohao117/frr-controller/pkg/apis/frrcontroller/v1alpha1"
+	"github.com/guohao117/frr-controller/pkg/utils"
+)
+
+const (
+	// frrApp is the app label of every pod run for a Frr
+	frrApp = "frr"
+	// frrObjectSelector selects the pods, the frr.conf Secrets, the service
+	// accounts, their RoleBindings and the teardown Jobs of every Frr, the
+	// only ones the controller watches.
+	frrObjectSelector = "app in (" + frrApp + "," + teardownApp + ")"
+)
+
+// podLabels returns the labels of the pods run for a Frr, also set on its
+// Secret
+func podLabels(frr *frrv1alpha1.Frr) map[string]string {
+	return map[string]string{
+		"app":        frrApp,
+		"controller": frr.Name,
+	}
+}
+
+// handlePod enqueues the Frr a pod is run for, found through the labels
+// set by newDeployment.
+func (c *Controller) handlePod(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	pod, ok := obj.(*corev1.Pod)
+	if !ok {
+		utilruntime.HandleError(fmt.Errorf("error decoding pod, invalid type"))
+		return
+	}
+	name := pod.Labels["controller"]
+	if pod.Labels["app"] != frrApp || name == "" {
+		return
+	}
+	c.workqueue.Add(pod.Namespace + "/" + name)
+}
+
+// frrPodStatus lists the pods run for a Frr and returns the nodes they are
+// scheduled to, comma separated, and the status of each pod, including the
+// frr.conf its frr-reloader last applied and the failure of its network
+// setup.
+func (c *Controller) frrPodStatus(frr *frrv1alpha1.Frr) (string, []frrv1alpha1.FrrPodStatus, error) {
+	pods, err := c.podsLister.Pods(frr.Namespace).List(labels.SelectorFromSet(podLabels(frr)))
+	if err != nil {
+		return "", nil, err
+	}
+	sort.Slice(pods, func(i, j int) bool {
+		return pods[i].Name < pods[j].Name
+	})
+
+	var nodes []string
+	seen := make(map[string]bool)
+	var statuses []frrv1alpha1.FrrPodStatus
+	for _, pod := range pods {
+		status := frrv1alpha1.FrrPodStatus{
+			Name:        pod.Name,
+			Node:        pod.Spec.NodeName,
+			VTEPAddress: podVTEPAddress(frr, pod),
+			Phase:       pod.Status.Phase,
+			Ready:       podReady(pod),
+		}
+		status.NetworkError = networkSetupError(pod)
+		if config, ok := utils.GetFrrConfigStatus(pod); ok {
+			status.ConfigHash = config.Hash
+			status.ConfigError = config.Error
+			if config.VTEPAddress != "" {
+				status.VTEPAddress = config.VTEPAddress
+			}
+		}
+		statuses = append(statuses, status)
+		if node := pod.Spec.NodeName; node != "" && !seen[node] {
+			seen[node] = true
+			nodes = append(nodes, node)
+		}
+	}
+	sort.Strings(nodes)
+	return strings.Join(nodes, ","), statuses, nil
+}
+
+// podVTEPAddress returns the local address of the VTEP of the pod as read
+// from its status, until the pod reports the one it uses. The address of an
+// interface of the node is only known once reported.
+func podVTEPAddress(frr *frrv1alpha1.Frr, pod *corev1.Pod) string {
+	source := frrv1alpha1.VXLANLocalAddressPodIP
+	if frr.Spec.VXLAN != nil && frr.Spec.VXLAN.LocalAddressSource != "" {
+		source = frr.Spec.VXLAN.LocalAddressSource
+	}
+	switch source {
+	case frrv1alpha1.VXLANLocalAddressNodeInternalIP:
+		return pod.Status.HostIP
+	case frrv1alpha1.VXLANLocalAddressInterface:
+		return ""
+	default:
+		return pod.Status.PodIP
+	}
+}
+
+func podReady(pod *corev1.Pod) bool {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodReady {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
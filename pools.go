@@ -0,0 +1,356 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+
+	frrv1alpha1 "github.com/guohao117/frr-controller/pkg/apis/frrcontroller/v1alpha1"
+	"github.com/guohao117/frr-controller/pkg/metrics"
+	rangemanager "github.com/guohao117/frr-controller/pkg/range_manager"
+)
+
+const (
+	vniPoolKind = "VNIPool"
+	asnPoolKind = "ASNPool"
+
+	// defaultPool is the pool used by Frrs which do not name one. When no
+	// pool of that name exists the range given on the command line is
+	// used.
+	defaultPool = "default"
+
+	// poolIndex indexes the Frrs by the pools they allocate from
+	poolIndex = "pool"
+)
+
+// poolRange is the static range of a pool given on the command line
+type poolRange struct {
+	start int
+	end   int
+}
+
+func (r poolRange) configured() bool {
+	return r.end > 0
+}
+
+// pools returns the set of pools and the static default range of a kind
+func (c *Controller) pools(kind string) (*rangemanager.Pools, poolRange) {
+	if kind == asnPoolKind {
+		return c.asnPools, c.staticASNRange
+	}
+	return c.vniPools, c.staticVNIRange
+}
+
+// poolName returns the pool a Frr allocates numbers of the given kind from
+func poolName(frr *frrv1alpha1.Frr, kind string) string {
+	name := frr.Spec.VNIPool
+	if kind == asnPoolKind {
+		name = frr.Spec.ASNPool
+	}
+	if name == "" {
+		return defaultPool
+	}
+	return name
+}
+
+// rangeManagerFor returns the allocator a Frr gets numbers of the given kind
+// from.
+func (c *Controller) rangeManagerFor(frr *frrv1alpha1.Frr, kind string) (*rangemanager.RangeManager, error) {
+	pools, _ := c.pools(kind)
+	name := poolName(frr, kind)
+	manager, ok := pools.Get(name)
+	if !ok {
+		return nil, fmt.Errorf("%s %q not found", kind, name)
+	}
+	return manager, nil
+}
+
+// initPools builds the allocators of every pool known to the informer
+// caches, and the static default pools. It must run before allocations are
+// restored so that every snapshot finds its pool.
+func (c *Controller) initPools() error {
+	for _, kind := range []string{vniPoolKind, asnPoolKind} {
+		names, err := c.listPoolNames(kind)
+		if err != nil {
+			return err
+		}
+		names = append(names, defaultPool)
+		for _, name := range names {
+			// every Frr is synced once the workers start
+			if err := c.syncPoolAllocator(kind+"/"+name, false); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (c *Controller) listPoolNames(kind string) ([]string, error) {
+	var names []string
+	if kind == asnPoolKind {
+		pools, err := c.asnPoolsLister.List(labels.Everything())
+		if err != nil {
+			return nil, err
+		}
+		for _, pool := range pools {
+			names = append(names, pool.Name)
+		}
+		return names, nil
+	}
+	pools, err := c.vniPoolsLister.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	for _, pool := range pools {
+		names = append(names, pool.Name)
+	}
+	return names, nil
+}
+
+// getPool returns the pool object of the given kind and name, with its spec
+// and status.
+func (c *Controller) getPool(kind, name string) (runtime.Object, *frrv1alpha1.PoolSpec, *frrv1alpha1.PoolStatus, error) {
+	if kind == asnPoolKind {
+		pool, err := c.asnPoolsLister.Get(name)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		return pool, &pool.Spec, &pool.Status, nil
+	}
+	pool, err := c.vniPoolsLister.Get(name)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return pool, &pool.Spec, &pool.Status, nil
+}
+
+// syncPool brings the allocator of a pool in line with its spec and
+// reports its usage in the pool status. A pool is never shrunk below the
+// numbers already handed out from it, the Resized condition tells when the
+// spec is not in effect. The Frrs allocating from the pool are synced again
+// when it is built or resized.
+func (c *Controller) syncPool(key string) error {
+	return c.syncPoolAllocator(key, true)
+}
+
+// syncPoolAllocator is syncPool, enqueueing the Frrs of the pool only if
+// enqueueFrrs is set
+func (c *Controller) syncPoolAllocator(key string, enqueueFrrs bool) error {
+	kind, name, ok := strings.Cut(key, "/")
+	if !ok || (kind != vniPoolKind && kind != asnPoolKind) {
+		utilruntime.HandleError(fmt.Errorf("invalid pool key: %s", key))
+		return nil
+	}
+	pools, static := c.pools(kind)
+	manager, found := pools.Get(name)
+
+	pool, spec, status, err := c.getPool(kind, name)
+	if errors.IsNotFound(err) {
+		switch {
+		case name == defaultPool && static.configured():
+			// Fall back to the range given on the command line
+			spec = &frrv1alpha1.PoolSpec{Start: static.start, End: static.end}
+		case found && manager.Used() > 0:
+			// Keep the allocator so that numbers still in use are not
+			// handed out again if the pool is recreated.
+			klog.Warningf("%s %q was deleted while %d numbers are allocated from it", kind, name, manager.Used())
+			return nil
+		default:
+			pools.Delete(name)
+			return nil
+		}
+	} else if err != nil {
+		return err
+	}
+
+	resized := metav1.Condition{
+		Type:    frrv1alpha1.PoolConditionResized,
+		Status:  metav1.ConditionTrue,
+		Reason:  ReasonRangeApplied,
+		Message: fmt.Sprintf("%d-%d", spec.Start, spec.End),
+	}
+	if !found {
+		manager, err = rangemanager.NewRangeManager(spec.Start, spec.End)
+		if err != nil {
+			if pool != nil {
+				c.recorder.Event(pool, corev1.EventTypeWarning, ErrPoolInvalid, fmt.Sprintf(MessagePoolInvalid, err))
+			}
+			utilruntime.HandleError(fmt.Errorf("%s %q: %v", kind, name, err))
+			return nil
+		}
+		pools.Set(name, manager)
+		// Frrs which failed to find the pool may be allocated now
+		if enqueueFrrs {
+			c.enqueuePoolFrrs(kind, name)
+		}
+	} else if manager.Min() != spec.Start || manager.Max() != spec.End {
+		if err := manager.Resize(spec.Start, spec.End); err != nil {
+			msg := fmt.Sprintf(MessagePoolShrinkRefused, spec.Start, spec.End, err)
+			if pool != nil {
+				c.recorder.Event(pool, corev1.EventTypeWarning, ErrPoolShrinkRefused, msg)
+			}
+			klog.Warningf("%s %q: %s", kind, name, msg)
+			resized.Status = metav1.ConditionFalse
+			resized.Reason = ReasonShrinkRefused
+			resized.Message = msg
+		} else if enqueueFrrs {
+			// Frrs which exhausted the pool may be allocated now
+			c.enqueuePoolFrrs(kind, name)
+		}
+	}
+
+	if pool == nil {
+		return nil
+	}
+	newStatus := frrv1alpha1.PoolStatus{
+		Start:      manager.Min(),
+		End:        manager.Max(),
+		Used:       manager.Used(),
+		Free:       manager.Free(),
+		Conditions: append([]metav1.Condition(nil), status.Conditions...),
+	}
+	if object, err := meta.Accessor(pool); err == nil {
+		resized.ObservedGeneration = object.GetGeneration()
+	}
+	meta.SetStatusCondition(&newStatus.Conditions, resized)
+	if equality.Semantic.DeepEqual(*status, newStatus) {
+		return nil
+	}
+	return c.updatePoolStatus(pool, newStatus)
+}
+
+// frrPoolKeys is the index function of poolIndex, returning the pools a Frr
+// allocates from as kind/name
+func frrPoolKeys(obj interface{}) ([]string, error) {
+	frr, ok := obj.(*frrv1alpha1.Frr)
+	if !ok {
+		return nil, nil
+	}
+	return []string{
+		vniPoolKind + "/" + poolName(frr, vniPoolKind),
+		asnPoolKind + "/" + poolName(frr, asnPoolKind),
+	}, nil
+}
+
+// enqueuePoolFrrs enqueues the Frrs allocating from a pool
+func (c *Controller) enqueuePoolFrrs(kind, name string) {
+	frrs, err := c.frrsIndexer.ByIndex(poolIndex, kind+"/"+name)
+	if err != nil {
+		utilruntime.HandleError(err)
+		return
+	}
+	for _, obj := range frrs {
+		c.enqueueFrr(obj)
+	}
+}
+
+func (c *Controller) updatePoolStatus(pool runtime.Object, status frrv1alpha1.PoolStatus) error {
+	// NEVER modify objects from the store. It's a read-only, local cache.
+	var err error
+	switch p := pool.(type) {
+	case *frrv1alpha1.VNIPool:
+		poolCopy := p.DeepCopy()
+		poolCopy.Status = status
+		_, err = c.frrclientset.FrrcontrollerV1alpha1().VNIPools().UpdateStatus(context.TODO(), poolCopy, metav1.UpdateOptions{})
+	case *frrv1alpha1.ASNPool:
+		poolCopy := p.DeepCopy()
+		poolCopy.Status = status
+		_, err = c.frrclientset.FrrcontrollerV1alpha1().ASNPools().UpdateStatus(context.TODO(), poolCopy, metav1.UpdateOptions{})
+	}
+	return err
+}
+
+// poolUsage returns the utilization of every pool, for the metrics
+func (c *Controller) poolUsage() []metrics.PoolUsage {
+	var usage []metrics.PoolUsage
+	for _, kind := range []string{vniPoolKind, asnPoolKind} {
+		pools, _ := c.pools(kind)
+		for name, manager := range pools.List() {
+			usage = append(usage, metrics.PoolUsage{
+				Kind: kind,
+				Name: name,
+				Used: manager.Used(),
+				Free: manager.Free(),
+			})
+		}
+	}
+	return usage
+}
+
+// enqueuePool puts the key of a pool onto the pool work queue
+func (c *Controller) enqueuePool(kind, name string) {
+	c.poolqueue.Add(kind + "/" + name)
+}
+
+// handlePool enqueues a VNIPool or ASNPool received from an informer,
+// including tombstones of deleted pools.
+func (c *Controller) handlePool(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	switch pool := obj.(type) {
+	case *frrv1alpha1.VNIPool:
+		c.enqueuePool(vniPoolKind, pool.Name)
+	case *frrv1alpha1.ASNPool:
+		c.enqueuePool(asnPoolKind, pool.Name)
+	default:
+		utilruntime.HandleError(fmt.Errorf("error decoding pool, invalid type"))
+	}
+}
+
+// runPoolWorker processes the pool work queue until it is shut down
+func (c *Controller) runPoolWorker() {
+	for c.processNextPoolItem() {
+	}
+}
+
+// processNextPoolItem reads a single pool key off the pool work queue and
+// syncs it.
+func (c *Controller) processNextPoolItem() bool {
+	obj, shutdown := c.poolqueue.Get()
+	if shutdown {
+		return false
+	}
+	defer c.poolqueue.Done(obj)
+
+	key, ok := obj.(string)
+	if !ok {
+		c.poolqueue.Forget(obj)
+		utilruntime.HandleError(fmt.Errorf("expected string in pool workqueue but got %#v", obj))
+		return true
+	}
+	if err := c.syncPool(key); err != nil {
+		c.poolqueue.AddRateLimited(key)
+		utilruntime.HandleError(fmt.Errorf("error syncing pool '%s': %s, requeuing", key, err.Error()))
+		return true
+	}
+	c.poolqueue.Forget(obj)
+	return true
+}
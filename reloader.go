@@ -0,0 +1,179 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"reflect"
+
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+
+	frrv1alpha1 "github.com/guohao117/frr-controller/pkg/apis/frrcontroller/v1alpha1"
+)
+
+const (
+	// defaultReloaderImage runs frr-reloader for Frrs created before
+	// spec.reloaderImage had a default
+	defaultReloaderImage = "nocsyscn/frr_reloader:0.1"
+	// frrRunVolume shares the vty sockets of the FRR daemons, in frrRunPath,
+	// with frr-reloader
+	frrRunVolume = "frr-run"
+	frrRunPath   = "/var/run/frr"
+	// reloaderClusterRole lets frr-reloader annotate its pod. The
+	// controller binds it to the service account of the pods of every Frr.
+	reloaderClusterRole = "frr-reloader"
+)
+
+// reloaderServiceAccountName returns the name of the service account the pods
+// of a Frr run as, and of its RoleBinding
+func reloaderServiceAccountName(frr *frrv1alpha1.Frr) string {
+	return frr.Name + "-frr-reloader"
+}
+
+// newReloaderServiceAccount returns the service account of the pods of a Frr
+func newReloaderServiceAccount(frr *frrv1alpha1.Frr) *corev1.ServiceAccount {
+	return &corev1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      reloaderServiceAccountName(frr),
+			Namespace: frr.Namespace,
+			Labels:    podLabels(frr),
+			OwnerReferences: []metav1.OwnerReference{
+				*metav1.NewControllerRef(frr, frrv1alpha1.SchemeGroupVersion.WithKind("Frr")),
+			},
+		},
+	}
+}
+
+// newReloaderRoleBinding returns the RoleBinding granting the service account
+// of the pods of a Frr the frr-reloader ClusterRole in their namespace
+func newReloaderRoleBinding(frr *frrv1alpha1.Frr) *rbacv1.RoleBinding {
+	return &rbacv1.RoleBinding{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      reloaderServiceAccountName(frr),
+			Namespace: frr.Namespace,
+			Labels:    podLabels(frr),
+			OwnerReferences: []metav1.OwnerReference{
+				*metav1.NewControllerRef(frr, frrv1alpha1.SchemeGroupVersion.WithKind("Frr")),
+			},
+		},
+		RoleRef: rbacv1.RoleRef{
+			APIGroup: rbacv1.GroupName,
+			Kind:     "ClusterRole",
+			Name:     reloaderClusterRole,
+		},
+		Subjects: []rbacv1.Subject{{
+			Kind:      rbacv1.ServiceAccountKind,
+			Name:      reloaderServiceAccountName(frr),
+			Namespace: frr.Namespace,
+		}},
+	}
+}
+
+// syncReloaderAccess makes sure the service account of the pods of a Frr
+// exists in its namespace, bound to the frr-reloader ClusterRole. Both are
+// owned by the Frr and go away with it.
+func (c *Controller) syncReloaderAccess(frr *frrv1alpha1.Frr) error {
+	desiredAccount := newReloaderServiceAccount(frr)
+	account, err := c.serviceAccountsLister.ServiceAccounts(frr.Namespace).Get(desiredAccount.Name)
+	if errors.IsNotFound(err) {
+		klog.V(4).Infof("Frr %s/%s: creating service account %s", frr.Namespace, frr.Name, desiredAccount.Name)
+		account, err = c.kubeclientset.CoreV1().ServiceAccounts(frr.Namespace).Create(context.TODO(), desiredAccount, metav1.CreateOptions{})
+	}
+	if err != nil {
+		return err
+	}
+	if !metav1.IsControlledBy(account, frr) {
+		msg := fmt.Sprintf(MessageResourceExists, account.Name)
+		c.recorder.Event(frr, corev1.EventTypeWarning, ErrResourceExists, msg)
+		return fmt.Errorf("%s", msg)
+	}
+
+	desiredBinding := newReloaderRoleBinding(frr)
+	binding, err := c.roleBindingsLister.RoleBindings(frr.Namespace).Get(desiredBinding.Name)
+	if errors.IsNotFound(err) {
+		klog.V(4).Infof("Frr %s/%s: creating role binding %s", frr.Namespace, frr.Name, desiredBinding.Name)
+		_, err = c.kubeclientset.RbacV1().RoleBindings(frr.Namespace).Create(context.TODO(), desiredBinding, metav1.CreateOptions{})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	if !metav1.IsControlledBy(binding, frr) {
+		msg := fmt.Sprintf(MessageResourceExists, binding.Name)
+		c.recorder.Event(frr, corev1.EventTypeWarning, ErrResourceExists, msg)
+		return fmt.Errorf("%s", msg)
+	}
+	if reflect.DeepEqual(binding.RoleRef, desiredBinding.RoleRef) && reflect.DeepEqual(binding.Subjects, desiredBinding.Subjects) {
+		return nil
+	}
+	// The role of a RoleBinding cannot change, the binding is replaced
+	klog.V(4).Infof("Frr %s/%s: replacing role binding %s", frr.Namespace, frr.Name, binding.Name)
+	if err := c.kubeclientset.RbacV1().RoleBindings(frr.Namespace).Delete(context.TODO(), binding.Name, metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	_, err = c.kubeclientset.RbacV1().RoleBindings(frr.Namespace).Create(context.TODO(), desiredBinding, metav1.CreateOptions{})
+	return err
+}
+
+// reloaderContainer returns the frr-reloader sidecar of the pods of a Frr. It
+// applies the frr.conf published in the Secret of the Frr to the running
+// daemons and reports the outcome in an annotation of its pod.
+func reloaderContainer(frr *frrv1alpha1.Frr) corev1.Container {
+	image := frr.Spec.ReloaderImage
+	if image == "" {
+		image = defaultReloaderImage
+	}
+	return corev1.Container{
+		Name:            "frr-reloader",
+		Image:           image,
+		ImagePullPolicy: corev1.PullIfNotPresent,
+		Args: []string{
+			"--config=" + path.Join(frrConfMountPath, frrConfKey),
+		},
+		Env: append([]corev1.EnvVar{
+			fieldEnv("POD_NAME", "metadata.name"),
+			fieldEnv("POD_NAMESPACE", "metadata.namespace"),
+		}, vtepLocalEnv(frr)...),
+		VolumeMounts: []corev1.VolumeMount{{
+			Name:      "frr-conf",
+			MountPath: frrConfMountPath,
+			ReadOnly:  true,
+		}, {
+			Name:      frrRunVolume,
+			MountPath: frrRunPath,
+		}},
+	}
+}
+
+// fieldEnv returns an environment variable set to a field of the pod
+func fieldEnv(name, fieldPath string) corev1.EnvVar {
+	return corev1.EnvVar{
+		Name: name,
+		ValueFrom: &corev1.EnvVarSource{
+			FieldRef: &corev1.ObjectFieldSelector{
+				APIVersion: "v1",
+				FieldPath:  fieldPath,
+			},
+		},
+	}
+}
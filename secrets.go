@@ -0,0 +1,255 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+
+	frrv1alpha1 "github.com/guohao117/frr-controller/pkg/apis/frrcontroller/v1alpha1"
+)
+
+// passwordRefs returns the Secret key holding the password of every peer of
+// a Frr, keyed by address. spec.passwordSecretRef applies to the neighbors
+// and to the peers which do not set their own.
+func passwordRefs(frr *frrv1alpha1.Frr) map[string]*corev1.SecretKeySelector {
+	refs := make(map[string]*corev1.SecretKeySelector)
+	if ref := frr.Spec.PasswordSecretRef; ref != nil {
+		for _, neighbor := range frr.Spec.Neighbors {
+			refs[neighbor] = ref
+		}
+	}
+	for _, peer := range frr.Spec.Peers {
+		ref := peer.PasswordSecretRef
+		if ref == nil {
+			ref = frr.Spec.PasswordSecretRef
+		}
+		if ref != nil {
+			refs[peer.Address] = ref
+		}
+	}
+	return refs
+}
+
+// passwordSecretIndex indexes the Frrs by the Secrets, as namespace/name,
+// their BGP passwords are read from
+const passwordSecretIndex = "passwordSecret"
+
+// passwordSecretSyncTimeout is how long a sync waits for a Secret it starts
+// watching to be cached
+const passwordSecretSyncTimeout = 10 * time.Second
+
+// passwordSecretKeys is the index function of passwordSecretIndex
+func passwordSecretKeys(obj interface{}) ([]string, error) {
+	frr, ok := obj.(*frrv1alpha1.Frr)
+	if !ok {
+		return nil, nil
+	}
+	seen := make(map[string]bool)
+	var keys []string
+	for _, ref := range passwordRefs(frr) {
+		key := frr.Namespace + "/" + ref.Name
+		if !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+// passwordSecrets caches the Secrets the Frrs read their BGP passwords from.
+// Each of them is watched on its own, by name, so that no other Secret of the
+// cluster is cached.
+type passwordSecrets struct {
+	client  kubernetes.Interface
+	handler cache.ResourceEventHandler
+
+	lock    sync.Mutex
+	watches map[string]*passwordSecretWatch
+}
+
+type passwordSecretWatch struct {
+	informer cache.SharedIndexInformer
+	stopCh   chan struct{}
+}
+
+func newPasswordSecrets(client kubernetes.Interface, handler cache.ResourceEventHandler) *passwordSecrets {
+	return &passwordSecrets{
+		client:  client,
+		handler: handler,
+		watches: make(map[string]*passwordSecretWatch),
+	}
+}
+
+// sync watches the Secrets given as namespace/name, and only those
+func (p *passwordSecrets) sync(keys []string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	wanted := make(map[string]bool)
+	for _, key := range keys {
+		wanted[key] = true
+		if _, ok := p.watches[key]; !ok {
+			p.watches[key] = p.watch(key)
+		}
+	}
+	for key, w := range p.watches {
+		if !wanted[key] {
+			klog.V(4).Infof("Stopped watching password secret %s", key)
+			close(w.stopCh)
+			delete(p.watches, key)
+		}
+	}
+}
+
+func (p *passwordSecrets) watch(key string) *passwordSecretWatch {
+	namespace, name, _ := cache.SplitMetaNamespaceKey(key)
+	selector := fields.OneTermEqualSelector("metadata.name", name).String()
+	informer := cache.NewSharedIndexInformer(&cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			options.FieldSelector = selector
+			return p.client.CoreV1().Secrets(namespace).List(context.TODO(), options)
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			options.FieldSelector = selector
+			return p.client.CoreV1().Secrets(namespace).Watch(context.TODO(), options)
+		},
+	}, &corev1.Secret{}, 0, cache.Indexers{})
+	informer.AddEventHandler(p.handler)
+	stopCh := make(chan struct{})
+	go informer.Run(stopCh)
+	klog.V(4).Infof("Watching password secret %s", key)
+	return &passwordSecretWatch{informer: informer, stopCh: stopCh}
+}
+
+// get returns the cached Secret, once its watch is synced
+func (p *passwordSecrets) get(namespace, name string) (*corev1.Secret, error) {
+	key := namespace + "/" + name
+	p.lock.Lock()
+	w, ok := p.watches[key]
+	p.lock.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("secret %q is not watched", name)
+	}
+	if err := wait.PollImmediate(10*time.Millisecond, passwordSecretSyncTimeout, func() (bool, error) {
+		return w.informer.HasSynced(), nil
+	}); err != nil {
+		return nil, fmt.Errorf("secret %q is not cached yet", name)
+	}
+	obj, exists, err := w.informer.GetStore().GetByKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, errors.NewNotFound(corev1.Resource("secret"), name)
+	}
+	return obj.(*corev1.Secret), nil
+}
+
+// stop stops every watch
+func (p *passwordSecrets) stop() {
+	p.sync(nil)
+}
+
+// syncPasswordSecrets watches the Secrets the Frrs currently refer to
+func (c *Controller) syncPasswordSecrets() {
+	c.passwordSecrets.sync(c.frrsIndexer.ListIndexFuncValues(passwordSecretIndex))
+}
+
+// peerPasswords reads the passwords of the peers of a Frr from the Secrets
+// they refer to, keyed by address. A peer whose optional Secret or key is
+// missing has no password.
+func (c *Controller) peerPasswords(frr *frrv1alpha1.Frr) (map[string]string, error) {
+	c.syncPasswordSecrets()
+	refs := passwordRefs(frr)
+	addresses := make([]string, 0, len(refs))
+	for address := range refs {
+		addresses = append(addresses, address)
+	}
+	// The first missing password is reported, always the same one
+	sort.Strings(addresses)
+	passwords := make(map[string]string)
+	for _, address := range addresses {
+		ref := refs[address]
+		optional := ref.Optional != nil && *ref.Optional
+		secret, err := c.passwordSecrets.get(frr.Namespace, ref.Name)
+		if errors.IsNotFound(err) && optional {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("neighbor %s: %v", address, err)
+		}
+		password, ok := secret.Data[ref.Key]
+		if !ok {
+			if optional {
+				continue
+			}
+			return nil, fmt.Errorf("neighbor %s: key %q not found in secret %q", address, ref.Key, ref.Name)
+		}
+		passwords[address] = string(password)
+	}
+	return passwords, nil
+}
+
+// handleSecret enqueues the Frr owning a Secret, so that edits of frr.conf
+// are reverted.
+func (c *Controller) handleSecret(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	if _, ok := obj.(*corev1.Secret); !ok {
+		utilruntime.HandleError(fmt.Errorf("error decoding secret, invalid type"))
+		return
+	}
+	c.handleObject(obj)
+}
+
+// handlePasswordSecret enqueues the Frrs reading their BGP passwords from a
+// Secret, so that a rotated password is rendered into their frr.conf.
+func (c *Controller) handlePasswordSecret(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	secret, ok := obj.(*corev1.Secret)
+	if !ok {
+		utilruntime.HandleError(fmt.Errorf("error decoding secret, invalid type"))
+		return
+	}
+	frrs, err := c.frrsIndexer.ByIndex(passwordSecretIndex, secret.Namespace+"/"+secret.Name)
+	if err != nil {
+		utilruntime.HandleError(err)
+		return
+	}
+	for _, frr := range frrs {
+		klog.V(4).Infof("Processing Frr %s/%s using password secret %s", frr.(*frrv1alpha1.Frr).Namespace, frr.(*frrv1alpha1.Frr).Name, secret.Name)
+		c.enqueueFrr(frr)
+	}
+}
@@ -0,0 +1,453 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/klog/v2"
+
+	frrv1alpha1 "github.com/guohao117/frr-controller/pkg/apis/frrcontroller/v1alpha1"
+)
+
+const (
+	// teardownApp is the app label of the Jobs removing the network of a
+	// Frr from a node, and of their pods
+	teardownApp = "frr-teardown"
+	// teardownNodeAnnotation names the node a teardown Job runs on
+	teardownNodeAnnotation = "frrcontroller.nocsys.cn/node"
+	// teardownBackoffLimit is how many times a teardown is retried before
+	// its Job fails
+	teardownBackoffLimit int32 = 3
+)
+
+func teardownLabels(frr *frrv1alpha1.Frr) map[string]string {
+	return map[string]string{
+		"app":        teardownApp,
+		"controller": frr.Name,
+	}
+}
+
+// retiredAllocationName returns the name a VNI the Frr no longer uses is
+// held under until it is removed from the nodes
+func retiredAllocationName(frrscopedName string, vni int) string {
+	return fmt.Sprintf("%s/retired/%d", frrscopedName, vni)
+}
+
+func isRetiredAllocationName(frrscopedName, name string) bool {
+	return strings.HasPrefix(name, frrscopedName+"/retired/")
+}
+
+// tearsDownNetwork tells whether the VNIs of the Frr need to be removed from
+// the nodes before they are given back: connect-frr set up the network of the
+// Frr on some node, whatever the spec asks for now
+func tearsDownNetwork(frr *frrv1alpha1.Frr) bool {
+	return len(frr.Status.NetworkNodes) > 0
+}
+
+// runsNetworkSetup tells whether connect-frr sets up the network of the pod
+func runsNetworkSetup(pod *corev1.Pod) bool {
+	for i := range pod.Spec.InitContainers {
+		if pod.Spec.InitContainers[i].Name == networkSetupContainerName {
+			return true
+		}
+	}
+	return false
+}
+
+// networkNodes returns the nodes listed in the status of the Frr as holding
+// its network, and the nodes its pods running connect-frr are scheduled to
+func networkNodes(frr *frrv1alpha1.Frr, pods []*corev1.Pod) []string {
+	seen := make(map[string]bool)
+	var nodes []string
+	add := func(node string) {
+		if node != "" && !seen[node] {
+			seen[node] = true
+			nodes = append(nodes, node)
+		}
+	}
+	for _, node := range frr.Status.NetworkNodes {
+		add(node)
+	}
+	for _, pod := range pods {
+		if runsNetworkSetup(pod) {
+			add(pod.Spec.NodeName)
+		}
+	}
+	sort.Strings(nodes)
+	return nodes
+}
+
+// retiredVNIs returns the VNIs the Frr no longer uses but still holds, keyed
+// by the name they are held under
+func (c *Controller) retiredVNIs(frr *frrv1alpha1.Frr) map[string]int {
+	retired := make(map[string]int)
+	manager, err := c.rangeManagerFor(frr, vniPoolKind)
+	if err != nil {
+		return retired
+	}
+	frrscopedName := frr.Namespace + "/" + frr.Name
+	for name, number := range manager.Held(frrscopedName) {
+		if isRetiredAllocationName(frrscopedName, name) {
+			retired[name] = number
+		}
+	}
+	return retired
+}
+
+// retireVNI keeps the VNI held by name under its retired name, so that it
+// is not handed out before it is removed from the nodes
+func (c *Controller) retireVNI(frr *frrv1alpha1.Frr, name string, number int) error {
+	manager, err := c.rangeManagerFor(frr, vniPoolKind)
+	if err != nil {
+		return err
+	}
+	if err := manager.Rename(name, retiredAllocationName(frr.Namespace+"/"+frr.Name, number)); err != nil {
+		return err
+	}
+	klog.Infof("Retired VNI %d of '%s' until it is removed from the nodes", number, name)
+	return nil
+}
+
+// retiredVNIStatus returns the VNIs the Frr no longer uses with the nodes
+// they were set up on. A VNI not yet in the status of the Frr was set up on
+// the given nodes.
+func (c *Controller) retiredVNIStatus(frr *frrv1alpha1.Frr, nodes []string) []frrv1alpha1.RetiredVNIStatus {
+	previous := make(map[int][]string)
+	for _, retired := range frr.Status.RetiredVNIs {
+		previous[retired.VNI] = retired.Nodes
+	}
+	var numbers []int
+	for _, number := range c.retiredVNIs(frr) {
+		numbers = append(numbers, number)
+	}
+	sort.Ints(numbers)
+	var statuses []frrv1alpha1.RetiredVNIStatus
+	for _, number := range numbers {
+		status := frrv1alpha1.RetiredVNIStatus{VNI: number}
+		if retiredNodes, ok := previous[number]; ok {
+			status.Nodes = append([]string(nil), retiredNodes...)
+		} else {
+			status.Nodes = append([]string(nil), nodes...)
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// teardownNetworks returns, by node, the network connect-frr removes from it
+// in the format it is built from: the L2VNIs and VRFs of the Frr which hold a
+// VNI, on the nodes listed in its status, if all is set, and its retired VNIs,
+// given by their number alone, on the nodes they were set up on.
+func (c *Controller) teardownNetworks(frr *frrv1alpha1.Frr, all bool) map[string][]corev1.EnvVar {
+	manager, err := c.rangeManagerFor(frr, vniPoolKind)
+	if err != nil {
+		return nil
+	}
+	frrscopedName := frr.Namespace + "/" + frr.Name
+	var vnis []l2vni
+	var vrfs []l3vni
+	if all {
+		for _, v := range specL2VNIs(frr) {
+			if number, ok := manager.Get(v.allocationName(frrscopedName)); ok {
+				v.number = number
+				vnis = append(vnis, v)
+			}
+		}
+		for _, v := range specL3VNIs(frr) {
+			if number, ok := manager.Get(vrfAllocationName(frrscopedName, v.name)); ok {
+				v.number = number
+				vrfs = append(vrfs, v)
+			}
+		}
+	}
+	entries := make(map[string][]string)
+	if len(vnis) > 0 {
+		for _, node := range frr.Status.NetworkNodes {
+			entries[node] = append(entries[node], formatVNIsEnv(vnis))
+		}
+	}
+	retiredNodes := make(map[int][]string)
+	for _, retired := range frr.Status.RetiredVNIs {
+		retiredNodes[retired.VNI] = retired.Nodes
+	}
+	var retired []int
+	for _, number := range c.retiredVNIs(frr) {
+		retired = append(retired, number)
+	}
+	sort.Ints(retired)
+	for _, number := range retired {
+		nodes, ok := retiredNodes[number]
+		if !ok {
+			// retired since the status was last saved
+			nodes = frr.Status.NetworkNodes
+		}
+		for _, node := range nodes {
+			entries[node] = append(entries[node], fmt.Sprintf("retired:%d::", number))
+		}
+	}
+
+	networks := make(map[string][]corev1.EnvVar)
+	for node, nodeEntries := range entries {
+		networks[node] = []corev1.EnvVar{{Name: vnisEnv, Value: strings.Join(nodeEntries, " ")}}
+	}
+	if len(vrfs) > 0 {
+		for _, node := range frr.Status.NetworkNodes {
+			networks[node] = append(networks[node], corev1.EnvVar{Name: vrfsEnv, Value: formatVRFsEnv(vrfs)})
+		}
+	}
+	return networks
+}
+
+// teardownJobName returns the name of the Job removing the network described
+// by env from node, which changes with the network
+func teardownJobName(frr *frrv1alpha1.Frr, node string, env []corev1.EnvVar) string {
+	hasher := fnv.New32a()
+	hasher.Write([]byte(node))
+	for _, e := range env {
+		hasher.Write([]byte("\x00" + e.Name + "=" + e.Value))
+	}
+	name := frr.Name
+	// leave room for the suffix in the 63 characters of a label value
+	if len(name) > 40 {
+		name = name[:40]
+	}
+	return fmt.Sprintf("%s-teardown-%08x", name, hasher.Sum32())
+}
+
+// newTeardownJob returns the Job running connect-frr on node to remove the
+// network described by env
+func newTeardownJob(frr *frrv1alpha1.Frr, node string, env []corev1.EnvVar) *batchv1.Job {
+	labels := teardownLabels(frr)
+	backoffLimit := teardownBackoffLimit
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      teardownJobName(frr, node, env),
+			Namespace: frr.Namespace,
+			Labels:    labels,
+			Annotations: map[string]string{
+				teardownNodeAnnotation: node,
+			},
+			OwnerReferences: []metav1.OwnerReference{
+				*metav1.NewControllerRef(frr, frrv1alpha1.SchemeGroupVersion.WithKind("Frr")),
+			},
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit: &backoffLimit,
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: labels,
+				},
+				Spec: corev1.PodSpec{
+					NodeName:      node,
+					HostNetwork:   true,
+					RestartPolicy: corev1.RestartPolicyNever,
+					// the network is removed from nodes the pods of
+					// the Frr ran on, whatever their taints are now
+					Tolerations: []corev1.Toleration{{Operator: corev1.TolerationOpExists}},
+					Volumes:     ovsVolumes(),
+					Containers: []corev1.Container{{
+						Name:                     networkSetupContainerName,
+						Image:                    networkSetupImage(frr),
+						ImagePullPolicy:          corev1.PullIfNotPresent,
+						Args:                     []string{"-teardown"},
+						Env:                      env,
+						VolumeMounts:             ovsVolumeMounts(),
+						SecurityContext:          networkSetupSecurityContext(),
+						TerminationMessagePolicy: corev1.TerminationMessageFallbackToLogsOnError,
+					}},
+				},
+			},
+		},
+	}
+}
+
+func jobCondition(job *batchv1.Job, conditionType batchv1.JobConditionType) *batchv1.JobCondition {
+	for i := range job.Status.Conditions {
+		if c := &job.Status.Conditions[i]; c.Type == conditionType && c.Status == corev1.ConditionTrue {
+			return c
+		}
+	}
+	return nil
+}
+
+// teardownJobs returns the teardown Jobs of the Frr, or those left without
+// owner by a Frr of that name which is gone if orphaned is set
+func (c *Controller) teardownJobs(frr *frrv1alpha1.Frr, orphaned bool) ([]*batchv1.Job, error) {
+	jobs, err := c.jobsLister.Jobs(frr.Namespace).List(labels.SelectorFromSet(teardownLabels(frr)))
+	if err != nil {
+		return nil, err
+	}
+	var owned []*batchv1.Job
+	for _, job := range jobs {
+		if orphaned && metav1.GetControllerOf(job) == nil || !orphaned && metav1.IsControlledBy(job, frr) {
+			owned = append(owned, job)
+		}
+	}
+	return owned, nil
+}
+
+// syncTeardown runs a Job on every node of networks removing the network
+// given for it, and tells whether it is removed from all of them. Nodes which are gone
+// have nothing left to remove. Teardown Jobs of the Frr for another network
+// are deleted. A failed Job is reported as a Warning event, and is run again
+// once deleted. The Jobs of a Frr which is gone are orphaned, so that they
+// outlive it.
+func (c *Controller) syncTeardown(frr *frrv1alpha1.Frr, networks map[string][]corev1.EnvVar, orphaned bool) (bool, error) {
+	if len(networks) == 0 {
+		return true, nil
+	}
+	jobs, err := c.teardownJobs(frr, orphaned)
+	if err != nil {
+		return false, err
+	}
+	existing := make(map[string]*batchv1.Job)
+	for _, job := range jobs {
+		existing[job.Name] = job
+	}
+
+	done := true
+	desired := make(map[string]bool)
+	var failed []string
+	var nodes []string
+	for node := range networks {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+	for _, node := range nodes {
+		if _, err := c.nodesLister.Get(node); errors.IsNotFound(err) {
+			klog.V(4).Infof("Frr %s/%s: node %s is gone, nothing to tear down there", frr.Namespace, frr.Name, node)
+			continue
+		} else if err != nil {
+			return false, err
+		}
+		job := newTeardownJob(frr, node, networks[node])
+		if orphaned {
+			job.OwnerReferences = nil
+		}
+		desired[job.Name] = true
+		current, ok := existing[job.Name]
+		if !ok {
+			klog.Infof("Frr %s/%s: tearing down the network of node %s", frr.Namespace, frr.Name, node)
+			if _, err := c.kubeclientset.BatchV1().Jobs(frr.Namespace).Create(context.TODO(), job, metav1.CreateOptions{}); err != nil && !errors.IsAlreadyExists(err) {
+				return false, err
+			}
+			done = false
+			continue
+		}
+		if jobCondition(current, batchv1.JobComplete) != nil {
+			continue
+		}
+		done = false
+		if condition := jobCondition(current, batchv1.JobFailed); condition != nil {
+			failed = append(failed, fmt.Sprintf("node %s: Job %s: %s", node, current.Name, condition.Message))
+		}
+	}
+
+	for name := range existing {
+		if !desired[name] {
+			if err := c.deleteJob(frr.Namespace, name); err != nil {
+				return false, err
+			}
+		}
+	}
+	if len(failed) > 0 {
+		msg := fmt.Sprintf(MessageTeardownFailed, strings.Join(failed, "; "))
+		c.recorder.Event(frr, corev1.EventTypeWarning, ErrTeardownFailed, msg)
+		return false, fmt.Errorf("%s", msg)
+	}
+	return done, nil
+}
+
+func (c *Controller) deleteJob(namespace, name string) error {
+	propagation := metav1.DeletePropagationBackground
+	err := c.kubeclientset.BatchV1().Jobs(namespace).Delete(context.TODO(), name, metav1.DeleteOptions{
+		PropagationPolicy: &propagation,
+	})
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// deploymentRolledOut tells whether every replica of the Deployment runs its
+// current pod template, so that the VNIs the Frr no longer uses are no
+// longer used on any node
+func deploymentRolledOut(deployment *appsv1.Deployment) bool {
+	var replicas int32 = 1
+	if deployment.Spec.Replicas != nil {
+		replicas = *deployment.Spec.Replicas
+	}
+	status := deployment.Status
+	return status.ObservedGeneration >= deployment.Generation &&
+		status.UpdatedReplicas == replicas &&
+		status.Replicas == replicas
+}
+
+// releaseRetiredVNIs removes the VNIs the Frr no longer uses from the nodes
+// they were set up on once its pods moved off them, then gives them back to
+// the pool
+func (c *Controller) releaseRetiredVNIs(frr *frrv1alpha1.Frr, deployment *appsv1.Deployment) error {
+	retired := c.retiredVNIs(frr)
+	if len(retired) == 0 || !deploymentRolledOut(deployment) {
+		return nil
+	}
+	done, err := c.syncTeardown(frr, c.teardownNetworks(frr, false), false)
+	if err != nil || !done {
+		return err
+	}
+
+	manager, err := c.rangeManagerFor(frr, vniPoolKind)
+	if err != nil {
+		return err
+	}
+	for name, number := range retired {
+		manager.Release(name)
+		klog.Infof("Released VNI %d of '%s' to pool %q", number, name, poolName(frr, vniPoolKind))
+	}
+	c.enqueuePool(vniPoolKind, poolName(frr, vniPoolKind))
+	if err := c.persistAllocations(); err != nil {
+		return err
+	}
+
+	return c.deleteTeardownJobs(frr, false)
+}
+
+// deleteTeardownJobs deletes the teardown Jobs of the Frr once they are done,
+// or those left by a Frr of that name which is gone if orphaned is set
+func (c *Controller) deleteTeardownJobs(frr *frrv1alpha1.Frr, orphaned bool) error {
+	jobs, err := c.teardownJobs(frr, orphaned)
+	if err != nil {
+		return err
+	}
+	for _, job := range jobs {
+		if err := c.deleteJob(job.Namespace, job.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	frrv1alpha1 "github.com/guohao117/frr-controller/pkg/apis/frrcontroller/v1alpha1"
+	"github.com/guohao117/frr-controller/pkg/frrconf"
+)
+
+// vnisEnv lists the L2VNIs of a Frr which lists them in spec.vnis, on the frr
+// container, as set by newDeployment. Every L2VNI is
+// name:vni:bridge:logicalSwitch and they are separated by spaces. The single
+// L2VNI of spec.vni is found in VNI instead.
+const vnisEnv = "VNIS"
+
+// l2vni is a L2VNI of a Frr with the VNI it holds
+type l2vni struct {
+	// name is empty for the L2VNI described by spec.vni
+	name          string
+	requested     int
+	logicalSwitch string
+	// bridgeName is the bridge requested in the spec, if any
+	bridgeName string
+	// routing is the RD and route targets of the spec, with the route
+	// targets derived by the controller
+	routing frrv1alpha1.EVPNRouting
+	numberAllocation
+}
+
+// specL2VNIs returns the L2VNIs of a Frr: spec.vnis, or the single L2VNI of
+// spec.vni and spec.logicalSwitch if it lists none.
+func specL2VNIs(frr *frrv1alpha1.Frr) []l2vni {
+	if len(frr.Spec.VNIs) == 0 {
+		return []l2vni{{
+			requested:     frr.Spec.VNI,
+			logicalSwitch: frr.Spec.LogicalSwitch,
+		}}
+	}
+	vnis := make([]l2vni, 0, len(frr.Spec.VNIs))
+	for _, vni := range frr.Spec.VNIs {
+		vnis = append(vnis, l2vni{
+			name:          vni.Name,
+			requested:     vni.ID,
+			logicalSwitch: vni.LogicalSwitch,
+			bridgeName:    vni.BridgeName,
+			routing:       *vni.EVPNRouting.DeepCopy(),
+		})
+	}
+	return vnis
+}
+
+// allocationName returns the name the VNI of the L2VNI is held under in the
+// pool. The VNI of spec.vni is held under the name of the Frr, as it always
+// was, the others below it.
+func (v *l2vni) allocationName(frrscopedName string) string {
+	if v.name == "" {
+		return frrscopedName
+	}
+	return frrscopedName + "/" + v.name
+}
+
+// bridge returns the Linux bridge of the L2VNI on the nodes
+func (v *l2vni) bridge() string {
+	if v.bridgeName != "" {
+		return v.bridgeName
+	}
+	return fmt.Sprintf("br-vx%d", v.number)
+}
+
+// l2vniStatus returns the L2VNI as reported in the Frr status
+func (v *l2vni) l2vniStatus() frrv1alpha1.L2VNIStatus {
+	return frrv1alpha1.L2VNIStatus{
+		Name:          v.name,
+		VNI:           v.number,
+		BridgeName:    v.bridge(),
+		LogicalSwitch: v.logicalSwitch,
+		Allocation:    v.status(),
+		EVPNRouting:   *v.routing.DeepCopy(),
+	}
+}
+
+// deriveRouteTargets fills the route targets of the L2VNIs of spec.vnis and
+// of the VRFs which list none, when the controller derives them
+func deriveRouteTargets(frr *frrv1alpha1.Frr, asn int, vnis []l2vni, vrfs []l3vni) {
+	if frr.Spec.RouteTargetDerivation != frrv1alpha1.RouteTargetDerivationController {
+		return
+	}
+	derive := func(routing *frrv1alpha1.EVPNRouting, vni int) {
+		if len(routing.ImportRTs) == 0 {
+			routing.ImportRTs = []string{frrconf.DerivedRouteTarget(asn, vni)}
+		}
+		if len(routing.ExportRTs) == 0 {
+			routing.ExportRTs = []string{frrconf.DerivedRouteTarget(asn, vni)}
+		}
+	}
+	for i := range vnis {
+		// The single L2VNI of spec.vni is left to FRR
+		if vnis[i].name != "" {
+			derive(&vnis[i].routing, vnis[i].number)
+		}
+	}
+	for i := range vrfs {
+		derive(&vrfs[i].routing, vrfs[i].number)
+	}
+}
+
+// formatVNIsEnv returns the value of vnisEnv for the L2VNIs of a Frr
+func formatVNIsEnv(vnis []l2vni) string {
+	entries := make([]string, 0, len(vnis))
+	for i := range vnis {
+		v := &vnis[i]
+		entries = append(entries, fmt.Sprintf("%s:%d:%s:%s", v.name, v.number, v.bridge(), v.logicalSwitch))
+	}
+	return strings.Join(entries, " ")
+}
+
+// parseVNIsEnv returns the VNI of every L2VNI listed in a value of vnisEnv,
+// keyed by name
+func parseVNIsEnv(value string) (map[string]int, error) {
+	vnis := make(map[string]int)
+	for _, entry := range strings.Fields(value) {
+		fields := strings.Split(entry, ":")
+		if len(fields) != 4 || fields[0] == "" {
+			return nil, fmt.Errorf("invalid L2VNI %q", entry)
+		}
+		number, err := strconv.Atoi(fields[1])
+		if err != nil || number <= 0 {
+			return nil, fmt.Errorf("invalid VNI of L2VNI %q", entry)
+		}
+		vnis[fields[0]] = number
+	}
+	return vnis, nil
+}
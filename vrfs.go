@@ -0,0 +1,98 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	frrv1alpha1 "github.com/guohao117/frr-controller/pkg/apis/frrcontroller/v1alpha1"
+)
+
+// vrfsEnv lists the VRFs of a Frr on the frr container, as set by
+// newDeployment. Every VRF is name:l3vni:routerMAC and they are separated by
+// spaces. The router MAC comes last as it holds colons itself.
+const vrfsEnv = "VRFS"
+
+// l3vni is a VRF of a Frr with the L3VNI it holds
+type l3vni struct {
+	name      string
+	requested int
+	routerMAC string
+	// routing is the RD and route targets of the spec, with the route
+	// targets derived by the controller
+	routing frrv1alpha1.EVPNRouting
+	numberAllocation
+}
+
+// specL3VNIs returns the VRFs of a Frr
+func specL3VNIs(frr *frrv1alpha1.Frr) []l3vni {
+	vrfs := make([]l3vni, 0, len(frr.Spec.VRFs))
+	for _, vrf := range frr.Spec.VRFs {
+		vrfs = append(vrfs, l3vni{
+			name:      vrf.Name,
+			requested: vrf.L3VNI,
+			routerMAC: vrf.RouterMAC,
+			routing:   *vrf.EVPNRouting.DeepCopy(),
+		})
+	}
+	return vrfs
+}
+
+// vrfAllocationName returns the name the L3VNI of the named VRF is held
+// under in the VNI pool. L2VNI names hold no slash, so they never clash.
+func vrfAllocationName(frrscopedName, vrf string) string {
+	return frrscopedName + "/vrf/" + vrf
+}
+
+// vrfStatus returns the VRF as reported in the Frr status
+func (v *l3vni) vrfStatus() frrv1alpha1.VRFStatus {
+	return frrv1alpha1.VRFStatus{
+		Name:        v.name,
+		L3VNI:       v.number,
+		Allocation:  v.status(),
+		EVPNRouting: *v.routing.DeepCopy(),
+	}
+}
+
+// formatVRFsEnv returns the value of vrfsEnv for the VRFs of a Frr
+func formatVRFsEnv(vrfs []l3vni) string {
+	entries := make([]string, 0, len(vrfs))
+	for i := range vrfs {
+		entries = append(entries, fmt.Sprintf("%s:%d:%s", vrfs[i].name, vrfs[i].number, vrfs[i].routerMAC))
+	}
+	return strings.Join(entries, " ")
+}
+
+// parseVRFsEnv returns the L3VNI of every VRF listed in a value of vrfsEnv,
+// keyed by name
+func parseVRFsEnv(value string) (map[string]int, error) {
+	vrfs := make(map[string]int)
+	for _, entry := range strings.Fields(value) {
+		fields := strings.SplitN(entry, ":", 3)
+		if len(fields) != 3 || fields[0] == "" {
+			return nil, fmt.Errorf("invalid VRF %q", entry)
+		}
+		number, err := strconv.Atoi(fields[1])
+		if err != nil || number <= 0 {
+			return nil, fmt.Errorf("invalid L3VNI of VRF %q", entry)
+		}
+		vrfs[fields[0]] = number
+	}
+	return vrfs, nil
+}
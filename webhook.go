@@ -0,0 +1,281 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	metav1validation "k8s.io/apimachinery/pkg/apis/meta/v1/validation"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+
+	frrv1alpha1 "github.com/guohao117/frr-controller/pkg/apis/frrcontroller/v1alpha1"
+	informers "github.com/guohao117/frr-controller/pkg/generated/informers/externalversions/frrcontroller/v1alpha1"
+	listers "github.com/guohao117/frr-controller/pkg/generated/listers/frrcontroller/v1alpha1"
+)
+
+// validateFrrPath is where the API server posts the AdmissionReviews of Frrs
+const validateFrrPath = "/validate-frr"
+
+// maxVNI is the largest VXLAN network identifier
+const maxVNI = 16777215
+
+// frrValidator is the validating admission webhook of Frrs. It rejects the
+// specs the controller could only report as failures once stored. The other
+// Frrs and the pools are read from the informer caches shared with the
+// controller.
+type frrValidator struct {
+	frrsLister     listers.FrrLister
+	frrsSynced     cache.InformerSynced
+	asnPoolsLister listers.ASNPoolLister
+	asnPoolsSynced cache.InformerSynced
+	// staticASNRange is the range of the default ASN pool given on the
+	// command line, used while no ASNPool named default exists
+	staticASNRange poolRange
+}
+
+func newFrrValidator(frrInformer informers.FrrInformer, asnPoolInformer informers.ASNPoolInformer, minASN, maxASN int) *frrValidator {
+	return &frrValidator{
+		frrsLister:     frrInformer.Lister(),
+		frrsSynced:     frrInformer.Informer().HasSynced,
+		asnPoolsLister: asnPoolInformer.Lister(),
+		asnPoolsSynced: asnPoolInformer.Informer().HasSynced,
+		staticASNRange: poolRange{start: minASN, end: maxASN},
+	}
+}
+
+// requestedVNI is a VNI set in the spec of a Frr, with the field it is set in
+type requestedVNI struct {
+	path *field.Path
+	vni  int
+}
+
+// requestedVNIs returns the VNIs set in the spec of a Frr: the one of each
+// L2VNI, as listed by specL2VNIs, and the L3VNI of each VRF
+func requestedVNIs(frr *frrv1alpha1.Frr) []requestedVNI {
+	spec := field.NewPath("spec")
+	var vnis []requestedVNI
+	if len(frr.Spec.VNIs) == 0 {
+		vnis = append(vnis, requestedVNI{spec.Child("vni"), frr.Spec.VNI})
+	}
+	for i, vni := range frr.Spec.VNIs {
+		vnis = append(vnis, requestedVNI{spec.Child("vnis").Index(i).Child("id"), vni.ID})
+	}
+	for i, vrf := range frr.Spec.VRFs {
+		vnis = append(vnis, requestedVNI{spec.Child("vrfs").Index(i).Child("l3vni"), vrf.L3VNI})
+	}
+	return vnis
+}
+
+// validate returns what is wrong with the spec of the Frr. It fails if the
+// pools or the other Frrs cannot be read.
+func (v *frrValidator) validate(frr *frrv1alpha1.Frr) (field.ErrorList, error) {
+	var errs field.ErrorList
+	spec := field.NewPath("spec")
+
+	if frr.Spec.DeploymentName == "" {
+		errs = append(errs, field.Required(spec.Child("deploymentName"), ""))
+	}
+	if frr.Spec.Replicas != nil && *frr.Spec.Replicas < 0 {
+		errs = append(errs, field.Invalid(spec.Child("replicas"), *frr.Spec.Replicas, "must be greater than or equal to 0"))
+	}
+	for i, neighbor := range frr.Spec.Neighbors {
+		if net.ParseIP(neighbor) == nil {
+			errs = append(errs, field.Invalid(spec.Child("neighbors").Index(i), neighbor, "must be an IP address"))
+		}
+	}
+	for i, peer := range frr.Spec.Peers {
+		if net.ParseIP(peer.Address) == nil {
+			errs = append(errs, field.Invalid(spec.Child("peers").Index(i).Child("address"), peer.Address, "must be an IP address"))
+		}
+	}
+	errs = append(errs, metav1validation.ValidateLabelSelector(&frr.Spec.NodeSelector, spec.Child("nodeSelector"))...)
+	if vxlan := frr.Spec.VXLAN; vxlan != nil && vxlan.LocalAddressSource == frrv1alpha1.VXLANLocalAddressInterface && vxlan.LocalInterface == "" {
+		errs = append(errs, field.Required(spec.Child("vxlan", "localInterface"), "must be set when localAddressSource is Interface"))
+	}
+
+	if frr.Spec.ASNumber != 0 {
+		asnErrs, err := v.validateASNumber(frr)
+		if err != nil {
+			return nil, err
+		}
+		errs = append(errs, asnErrs...)
+	}
+
+	vniErrs, err := v.validateVNIs(frr)
+	if err != nil {
+		return nil, err
+	}
+	return append(errs, vniErrs...), nil
+}
+
+// validateASNumber checks that the AS number set in the spec is part of the
+// ASN pool of the Frr. A pool which does not exist yet is left to the
+// controller to report.
+func (v *frrValidator) validateASNumber(frr *frrv1alpha1.Frr) (field.ErrorList, error) {
+	name := poolName(frr, asnPoolKind)
+	bounds := v.staticASNRange
+	pool, err := v.asnPoolsLister.Get(name)
+	switch {
+	case err == nil:
+		bounds = poolRange{start: pool.Spec.Start, end: pool.Spec.End}
+	case !errors.IsNotFound(err):
+		return nil, err
+	case name != defaultPool || !bounds.configured():
+		return nil, nil
+	}
+	asn := frr.Spec.ASNumber
+	if asn < bounds.start || asn > bounds.end {
+		msg := fmt.Sprintf("must be within %d-%d, the range of %s %q", bounds.start, bounds.end, asnPoolKind, name)
+		return field.ErrorList{field.Invalid(field.NewPath("spec", "asNumber"), asn, msg)}, nil
+	}
+	return nil, nil
+}
+
+// validateVNIs checks that the VNIs set in the spec are valid VXLAN network
+// identifiers, and that no other Frr, nor another L2VNI or VRF of the Frr,
+// sets the same one.
+func (v *frrValidator) validateVNIs(frr *frrv1alpha1.Frr) (field.ErrorList, error) {
+	var errs field.ErrorList
+	requested := make(map[int]string)
+	for _, r := range requestedVNIs(frr) {
+		switch {
+		case r.vni == 0:
+		case r.vni < 1 || r.vni > maxVNI:
+			errs = append(errs, field.Invalid(r.path, r.vni, fmt.Sprintf("must be between 1 and %d", maxVNI)))
+		case requested[r.vni] != "":
+			errs = append(errs, field.Duplicate(r.path, r.vni))
+		default:
+			requested[r.vni] = r.path.String()
+		}
+	}
+	if len(requested) == 0 {
+		return errs, nil
+	}
+
+	frrs, err := v.frrsLister.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	for _, other := range frrs {
+		if other.Namespace == frr.Namespace && other.Name == frr.Name {
+			continue
+		}
+		for _, r := range requestedVNIs(other) {
+			if path, ok := requested[r.vni]; ok {
+				msg := fmt.Sprintf("already requested by Frr %s/%s", other.Namespace, other.Name)
+				errs = append(errs, field.Invalid(field.NewPath(path), r.vni, msg))
+				delete(requested, r.vni)
+			}
+		}
+	}
+	return errs, nil
+}
+
+// review answers an AdmissionRequest for a Frr. Updates which leave the spec
+// alone, such as those of the finalizer, are always allowed.
+func (v *frrValidator) review(req *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse {
+	frr := &frrv1alpha1.Frr{}
+	if err := json.Unmarshal(req.Object.Raw, frr); err != nil {
+		return deniedResponse(http.StatusBadRequest, fmt.Sprintf("decoding Frr: %v", err))
+	}
+	if req.Operation == admissionv1.Update {
+		old := &frrv1alpha1.Frr{}
+		if err := json.Unmarshal(req.OldObject.Raw, old); err != nil {
+			return deniedResponse(http.StatusBadRequest, fmt.Sprintf("decoding Frr: %v", err))
+		}
+		if equality.Semantic.DeepEqual(old.Spec, frr.Spec) {
+			return &admissionv1.AdmissionResponse{Allowed: true}
+		}
+	}
+
+	errs, err := v.validate(frr)
+	if err != nil {
+		return deniedResponse(http.StatusInternalServerError, fmt.Sprintf("validating Frr: %v", err))
+	}
+	if len(errs) > 0 {
+		status := errors.NewInvalid(frrv1alpha1.Kind("Frr"), frr.Name, errs).Status()
+		return &admissionv1.AdmissionResponse{Result: &status}
+	}
+	return &admissionv1.AdmissionResponse{Allowed: true}
+}
+
+func deniedResponse(code int32, message string) *admissionv1.AdmissionResponse {
+	return &admissionv1.AdmissionResponse{
+		Result: &metav1.Status{
+			Status:  metav1.StatusFailure,
+			Code:    code,
+			Message: message,
+		},
+	}
+}
+
+// ServeHTTP answers the AdmissionReviews posted by the API server. Until the
+// caches are synced it fails the call, which the API server ignores.
+func (v *frrValidator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !v.frrsSynced() || !v.asnPoolsSynced() {
+		http.Error(w, "waiting for the caches to sync", http.StatusServiceUnavailable)
+		return
+	}
+	review := &admissionv1.AdmissionReview{}
+	if err := json.NewDecoder(r.Body).Decode(review); err != nil || review.Request == nil {
+		http.Error(w, "expected an AdmissionReview", http.StatusBadRequest)
+		return
+	}
+	review.Response = v.review(review.Request)
+	review.Response.UID = review.Request.UID
+	if !review.Response.Allowed {
+		klog.V(2).Infof("Denied %s of Frr %s/%s: %s", review.Request.Operation, review.Request.Namespace, review.Request.Name, review.Response.Result.Message)
+	}
+	review.Request = nil
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(review); err != nil {
+		klog.Errorf("Failed to write the AdmissionReview: %v", err)
+	}
+}
+
+// serveWebhook serves the validating admission webhook of Frrs over TLS on
+// address. Without a certificate the webhook is not served, the controller
+// runs all the same.
+func serveWebhook(address, certFile, keyFile string, validator *frrValidator) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		klog.Errorf("Not serving the validating webhook, failed to load its certificate: %v", err)
+		return
+	}
+	mux := http.NewServeMux()
+	mux.Handle(validateFrrPath, validator)
+	server := &http.Server{
+		Addr:      address,
+		Handler:   mux,
+		TLSConfig: &tls.Config{Certificates: []tls.Certificate{cert}},
+	}
+	klog.Infof("Serving the Frr validating webhook on %s", address)
+	if err := server.ListenAndServeTLS("", ""); err != nil {
+		klog.Fatalf("Error serving the validating webhook: %s", err.Error())
+	}
+}
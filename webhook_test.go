@@ -0,0 +1,321 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+
+	frrcontroller "github.com/guohao117/frr-controller/pkg/apis/frrcontroller/v1alpha1"
+	"github.com/guohao117/frr-controller/pkg/generated/clientset/versioned/fake"
+	informers "github.com/guohao117/frr-controller/pkg/generated/informers/externalversions"
+)
+
+func newASNPool(name string, start, end int) *frrcontroller.ASNPool {
+	return &frrcontroller.ASNPool{
+		TypeMeta:   metav1.TypeMeta{APIVersion: frrcontroller.SchemeGroupVersion.String()},
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec:       frrcontroller.PoolSpec{Start: start, End: end},
+	}
+}
+
+// newTestFrrValidator returns a frrValidator reading the given Frrs and
+// ASNPools from synced informers
+func newTestFrrValidator(t *testing.T, minASN, maxASN int, objects ...runtime.Object) *frrValidator {
+	t.Helper()
+	factory := informers.NewSharedInformerFactory(fake.NewSimpleClientset(objects...), noResyncPeriodFunc())
+	v := newFrrValidator(factory.Frrcontroller().V1alpha1().Frrs(), factory.Frrcontroller().V1alpha1().ASNPools(), minASN, maxASN)
+	stopCh := make(chan struct{})
+	t.Cleanup(func() { close(stopCh) })
+	factory.Start(stopCh)
+	for informer, synced := range factory.WaitForCacheSync(stopCh) {
+		if !synced {
+			t.Fatalf("failed to sync the %v informer", informer)
+		}
+	}
+	return v
+}
+
+func TestValidateFrr(t *testing.T) {
+	other := newFrr("other", int32Ptr(1))
+	other.Spec.VNIs = []frrcontroller.L2VNI{{Name: "blue", ID: 1500}}
+	other.Spec.VRFs = []frrcontroller.VRF{{Name: "red", L3VNI: 1600}}
+
+	tests := []struct {
+		name   string
+		mutate func(frr *frrcontroller.Frr)
+		// fields are the fields reported as invalid, none if the Frr is
+		// valid
+		fields []string
+	}{
+		{
+			name:   "valid",
+			mutate: func(frr *frrcontroller.Frr) {},
+		},
+		{
+			name: "valid with every field set",
+			mutate: func(frr *frrcontroller.Frr) {
+				frr.Spec.ASNumber = 65100
+				frr.Spec.Neighbors = []string{"10.0.0.1"}
+				frr.Spec.Peers = []frrcontroller.BGPPeer{{Address: "fd00::1"}}
+				frr.Spec.VNIs = []frrcontroller.L2VNI{{Name: "blue", ID: 1501}, {Name: "green"}}
+				frr.Spec.VRFs = []frrcontroller.VRF{{Name: "red", L3VNI: 1601}}
+				frr.Spec.NodeSelector = metav1.LabelSelector{MatchLabels: map[string]string{"frr": "true"}}
+			},
+		},
+		{
+			name:   "missing deployment name",
+			mutate: func(frr *frrcontroller.Frr) { frr.Spec.DeploymentName = "" },
+			fields: []string{"spec.deploymentName"},
+		},
+		{
+			name:   "negative replicas",
+			mutate: func(frr *frrcontroller.Frr) { frr.Spec.Replicas = int32Ptr(-1) },
+			fields: []string{"spec.replicas"},
+		},
+		{
+			name: "invalid neighbor and peer addresses",
+			mutate: func(frr *frrcontroller.Frr) {
+				frr.Spec.Neighbors = []string{"10.0.0.1", "10.0.0"}
+				frr.Spec.Peers = []frrcontroller.BGPPeer{{Address: "peer.example.com"}}
+			},
+			fields: []string{"spec.neighbors[1]", "spec.peers[0].address"},
+		},
+		{
+			name:   "AS number outside the default ASNPool",
+			mutate: func(frr *frrcontroller.Frr) { frr.Spec.ASNumber = 65300 },
+			fields: []string{"spec.asNumber"},
+		},
+		{
+			name: "AS number outside another ASNPool",
+			mutate: func(frr *frrcontroller.Frr) {
+				frr.Spec.ASNPool = "tenant"
+				frr.Spec.ASNumber = 65100
+			},
+			fields: []string{"spec.asNumber"},
+		},
+		{
+			name: "AS number of an ASNPool which does not exist yet",
+			mutate: func(frr *frrcontroller.Frr) {
+				frr.Spec.ASNPool = "missing"
+				frr.Spec.ASNumber = 1
+			},
+		},
+		{
+			name:   "VNI out of range",
+			mutate: func(frr *frrcontroller.Frr) { frr.Spec.VNI = maxVNI + 1 },
+			fields: []string{"spec.vni"},
+		},
+		{
+			name: "negative VNIs",
+			mutate: func(frr *frrcontroller.Frr) {
+				frr.Spec.VNIs = []frrcontroller.L2VNI{{Name: "blue", ID: -1}}
+				frr.Spec.VRFs = []frrcontroller.VRF{{Name: "red", L3VNI: -2}}
+			},
+			fields: []string{"spec.vnis[0].id", "spec.vrfs[0].l3vni"},
+		},
+		{
+			name: "VNI duplicated within the Frr",
+			mutate: func(frr *frrcontroller.Frr) {
+				frr.Spec.VNIs = []frrcontroller.L2VNI{{Name: "blue", ID: 1700}}
+				frr.Spec.VRFs = []frrcontroller.VRF{{Name: "red", L3VNI: 1700}}
+			},
+			fields: []string{"spec.vrfs[0].l3vni"},
+		},
+		{
+			name:   "VNI requested by another Frr",
+			mutate: func(frr *frrcontroller.Frr) { frr.Spec.VNI = 1500 },
+			fields: []string{"spec.vni"},
+		},
+		{
+			name: "L3VNI requested by another Frr",
+			mutate: func(frr *frrcontroller.Frr) {
+				frr.Spec.VRFs = []frrcontroller.VRF{{Name: "red", L3VNI: 1600}}
+			},
+			fields: []string{"spec.vrfs[0].l3vni"},
+		},
+		{
+			name: "malformed node selector",
+			mutate: func(frr *frrcontroller.Frr) {
+				frr.Spec.NodeSelector = metav1.LabelSelector{
+					MatchLabels: map[string]string{"frr zone": "true"},
+					MatchExpressions: []metav1.LabelSelectorRequirement{
+						{Key: "zone", Operator: metav1.LabelSelectorOpIn},
+					},
+				}
+			},
+			fields: []string{"spec.nodeSelector.matchLabels", "spec.nodeSelector.matchExpressions[0].values"},
+		},
+		{
+			name: "interface VTEP address without an interface",
+			mutate: func(frr *frrcontroller.Frr) {
+				frr.Spec.VXLAN = &frrcontroller.VXLAN{LocalAddressSource: frrcontroller.VXLANLocalAddressInterface}
+			},
+			fields: []string{"spec.vxlan.localInterface"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			v := newTestFrrValidator(t, 65001, 65200, other, newASNPool("tenant", 65200, 65299))
+
+			frr := newFrr("test", int32Ptr(1))
+			test.mutate(frr)
+			errs, err := v.validate(frr)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var fields []string
+			for _, e := range errs {
+				fields = append(fields, e.Field)
+			}
+			if fmt.Sprint(fields) != fmt.Sprint(test.fields) {
+				t.Errorf("expected invalid fields %v, got %v", test.fields, errs)
+			}
+		})
+	}
+}
+
+func TestValidateFrrDefaultASNPool(t *testing.T) {
+	frr := newFrr("test", int32Ptr(1))
+	frr.Spec.ASNumber = 65300
+
+	// the ASNPool named default takes over the static range
+	v := newTestFrrValidator(t, 65001, 65200, newASNPool(defaultPool, 65001, 65534))
+	errs, err := v.validate(frr)
+	if err != nil || len(errs) != 0 {
+		t.Errorf("expected the Frr to be valid, got %v, %v", errs, err)
+	}
+
+	// no range to check against
+	errs, err = newTestFrrValidator(t, 0, 0).validate(frr)
+	if err != nil || len(errs) != 0 {
+		t.Errorf("expected the Frr to be valid, got %v, %v", errs, err)
+	}
+}
+
+func TestValidateFrrIgnoresItself(t *testing.T) {
+	frr := newFrr("test", int32Ptr(1))
+	frr.Spec.VNI = 1500
+	errs, err := newTestFrrValidator(t, 0, 0, frr.DeepCopy()).validate(frr)
+	if err != nil || len(errs) != 0 {
+		t.Errorf("expected the Frr to be valid, got %v, %v", errs, err)
+	}
+}
+
+func TestServeAdmissionReviewNotSynced(t *testing.T) {
+	// the informers are never started
+	factory := informers.NewSharedInformerFactory(fake.NewSimpleClientset(), noResyncPeriodFunc())
+	v := newFrrValidator(factory.Frrcontroller().V1alpha1().Frrs(), factory.Frrcontroller().V1alpha1().ASNPools(), 0, 0)
+	w := httptest.NewRecorder()
+	v.ServeHTTP(w, httptest.NewRequest(http.MethodPost, validateFrrPath, bytes.NewReader([]byte("{}"))))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected status 503, got %d", w.Code)
+	}
+}
+
+func TestServeWebhookWithoutCertificate(t *testing.T) {
+	dir := t.TempDir()
+	// returns instead of serving, or exiting
+	serveWebhook("127.0.0.1:0", filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key"), newTestFrrValidator(t, 0, 0))
+}
+
+func postAdmissionReview(t *testing.T, v *frrValidator, operation admissionv1.Operation, frr, old *frrcontroller.Frr) *admissionv1.AdmissionResponse {
+	t.Helper()
+	raw := func(frr *frrcontroller.Frr) runtime.RawExtension {
+		if frr == nil {
+			return runtime.RawExtension{}
+		}
+		data, err := json.Marshal(frr)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return runtime.RawExtension{Raw: data}
+	}
+	review := admissionv1.AdmissionReview{
+		TypeMeta: metav1.TypeMeta{APIVersion: admissionv1.SchemeGroupVersion.String(), Kind: "AdmissionReview"},
+		Request: &admissionv1.AdmissionRequest{
+			UID:       types.UID("uid-1"),
+			Operation: operation,
+			Namespace: frr.Namespace,
+			Name:      frr.Name,
+			Object:    raw(frr),
+			OldObject: raw(old),
+		},
+	}
+	body, _ := json.Marshal(review)
+
+	w := httptest.NewRecorder()
+	v.ServeHTTP(w, httptest.NewRequest(http.MethodPost, validateFrrPath, bytes.NewReader(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var response admissionv1.AdmissionReview
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if response.Response == nil || response.Response.UID != "uid-1" {
+		t.Fatalf("expected a response to uid-1, got %+v", response.Response)
+	}
+	return response.Response
+}
+
+func TestServeAdmissionReview(t *testing.T) {
+	v := newTestFrrValidator(t, 65001, 65534)
+
+	frr := newFrr("test", int32Ptr(1))
+	if response := postAdmissionReview(t, v, admissionv1.Create, frr, nil); !response.Allowed {
+		t.Errorf("expected the Frr to be allowed, got %+v", response.Result)
+	}
+
+	invalid := frr.DeepCopy()
+	invalid.Spec.Neighbors = []string{"not-an-ip"}
+	response := postAdmissionReview(t, v, admissionv1.Create, invalid, nil)
+	if response.Allowed || response.Result == nil || response.Result.Code != http.StatusUnprocessableEntity {
+		t.Errorf("expected the Frr to be denied as invalid, got %+v", response.Result)
+	}
+
+	// updates of an invalid Frr go through as long as the spec is left
+	// alone, so that its finalizer can be removed
+	updated := invalid.DeepCopy()
+	updated.Finalizers = nil
+	if response := postAdmissionReview(t, v, admissionv1.Update, updated, invalid); !response.Allowed {
+		t.Errorf("expected the update to be allowed, got %+v", response.Result)
+	}
+	if response := postAdmissionReview(t, v, admissionv1.Update, invalid, frr); response.Allowed {
+		t.Error("expected the update to be denied")
+	}
+}
+
+func TestServeMalformedAdmissionReview(t *testing.T) {
+	v := newTestFrrValidator(t, 0, 0)
+	w := httptest.NewRecorder()
+	v.ServeHTTP(w, httptest.NewRequest(http.MethodPost, validateFrrPath, bytes.NewReader([]byte("{}"))))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400, got %d", w.Code)
+	}
+}